@@ -2,74 +2,204 @@ package auth
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"strings"
+	"time"
 )
 
-var jwtSecretKey = []byte("your_secret_key")
+// Authenticator signs and verifies the JWTs issued by the API. A single
+// instance is built from config at startup and shared by every Resource.
+type Authenticator struct {
+	keys        *KeyRing
+	expiry      time.Duration
+	revocations RevocationStore
+	apiKeys     APIKeyStore
+	sessions    SessionStore
+}
 
-func MustAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+func NewAuthenticator(keys *KeyRing, expiry time.Duration, revocations RevocationStore, apiKeys APIKeyStore, sessions SessionStore) *Authenticator {
+	return &Authenticator{
+		keys:        keys,
+		expiry:      expiry,
+		revocations: revocations,
+		apiKeys:     apiKeys,
+		sessions:    sessions,
+	}
+}
+
+// Expiry is the lifetime of access tokens minted by Sign.
+func (a *Authenticator) Expiry() time.Duration {
+	return a.expiry
+}
+
+// Sign adds the jti, iat and exp claims and returns the token signed with
+// the newest key of the ring, named in the kid header.
+func (a *Authenticator) Sign(claims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	key, err := a.keys.signingKey(now)
+	if err != nil {
+		return "", err
+	}
+
+	claims["jti"] = uuid.NewString()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(a.expiry).Unix()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// Revoke blocks the token described by claims until it would have expired.
+func (a *Authenticator) Revoke(ctx context.Context, claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	userID, _ := claims["user_id"].(string)
+	exp, _ := claims["exp"].(float64)
+	if jti == "" {
+		return nil
+	}
+	return a.revocations.Revoke(ctx, jti, userID, time.Unix(int64(exp), 0).UTC())
+}
+
+func (a *Authenticator) parse(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		key, err := a.keys.verificationKey(token, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	if _, ok := claims["user_id"].(string); !ok {
+		return nil, fmt.Errorf("token has no user_id claim")
+	}
+
+	// Tokens without a jti predate revocation support and cannot be revoked,
+	// so they are no longer accepted.
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return nil, fmt.Errorf("token has no jti claim")
+	}
+	revoked, err := a.revocations.IsRevoked(ctx, jti)
+	if err != nil {
+		log.WithError(err).Error("auth: failed to check token revocation")
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("token %s has been revoked", jti)
+	}
+
+	// Tokens minted before sessions existed have no sid and simply run out.
+	if sid, ok := claims["sid"].(string); ok && sid != "" {
+		active, err := a.sessions.Touch(ctx, sid)
+		if err != nil {
+			log.WithError(err).Error("auth: failed to check session")
+			return nil, err
 		}
+		if !active {
+			return nil, fmt.Errorf("session %s has been revoked", sid)
+		}
+	}
+
+	return claims, nil
+}
+
+// JWKSHandler publishes the public signing keys so other services can
+// verify our tokens without sharing a secret.
+func (a *Authenticator) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(a.keys.JWKS(time.Now()))
+}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtSecretKey, nil
-		})
+// authenticate verifies either a "Bearer <jwt>" or an "ApiKey <key>"
+// Authorization header and returns the context carrying the caller.
+func (a *Authenticator) authenticate(r *http.Request) (context.Context, error) {
+	authHeader := r.Header.Get("Authorization")
+	switch {
+	case strings.HasPrefix(authHeader, "Bearer "):
+		claims, err := a.parse(r.Context(), strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			return nil, err
+		}
+		// add the user_id and role to the context
+		return setClaimsInContext(r.Context(), claims), nil
+	case strings.HasPrefix(authHeader, "ApiKey "):
+		key, err := a.apiKeys.Lookup(r.Context(), HashAPIKey(strings.TrimPrefix(authHeader, "ApiKey ")))
+		if err != nil {
+			log.WithError(err).Error("auth: failed to look up api key")
+			return nil, err
+		}
+		if key == nil {
+			return nil, fmt.Errorf("invalid api key")
+		}
+		return setAPIKeyInContext(r.Context(), key), nil
+	}
+	return nil, fmt.Errorf("missing credentials")
+}
 
-		if err != nil || !token.Valid {
+func (a *Authenticator) MustAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := a.authenticate(r)
+		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		// add the user_id to the context
-		claims := token.Claims.(jwt.MapClaims)
-		r = r.WithContext(setUserIDInContext(r.Context(), claims["user_id"].(string)))
-
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func MayAuthMiddleware(next http.Handler) http.Handler {
+func (a *Authenticator) MayAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		if !strings.HasPrefix(authHeader, "Bearer ") && !strings.HasPrefix(authHeader, "ApiKey ") {
 			log.Println("a guest user signed in")
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtSecretKey, nil
-		})
-
-		if err != nil || !token.Valid {
+		ctx, err := a.authenticate(r)
+		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		// add the user_id to the context
-		claims := token.Claims.(jwt.MapClaims)
-		r = r.WithContext(setUserIDInContext(r.Context(), claims["user_id"].(string)))
-
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// SessionIDFromContext returns the session of the signed-in device, or ""
+// for API key and guest requests.
+func SessionIDFromContext(ctx context.Context) string {
+	sid, _ := ClaimsFromContext(ctx)["sid"].(string)
+	return sid
+}
+
+// ClaimsFromContext returns the claims of the verified token, or nil for
+// guest requests.
+func ClaimsFromContext(ctx context.Context) jwt.MapClaims {
+	claims, _ := ctx.Value("claims").(jwt.MapClaims)
+	return claims
+}
+
 func setUserIDInContext(ctx context.Context, userID string) context.Context {
 	return context.WithValue(ctx, "user_id", userID)
 }
+
+func setClaimsInContext(ctx context.Context, claims jwt.MapClaims) context.Context {
+	ctx = context.WithValue(ctx, "claims", claims)
+	ctx = setUserIDInContext(ctx, claims["user_id"].(string))
+	if role, ok := claims["role"].(string); ok {
+		ctx = setRoleInContext(ctx, role)
+	}
+	return ctx
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"Food/config"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+)
+
+// Key is one signing or verification key of the ring. Keys loaded from a
+// public key file only can verify tokens, which is how retired keys stay
+// valid until the last token they signed has expired.
+type Key struct {
+	ID        string
+	Algorithm string
+	NotBefore time.Time
+	ExpiresAt time.Time
+
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func (k *Key) canSign() bool {
+	return k.signKey != nil
+}
+
+func (k *Key) active(now time.Time) bool {
+	return !now.Before(k.NotBefore) && (k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt))
+}
+
+// KeyRing holds every key the API knows about, newest first.
+type KeyRing struct {
+	keys []*Key
+}
+
+func NewKeyRing(keys ...*Key) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("auth: key ring is empty")
+	}
+	sorted := append([]*Key(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].NotBefore.After(sorted[j].NotBefore)
+	})
+	return &KeyRing{keys: sorted}, nil
+}
+
+// NewKeyRingFromConfig loads the PEM files referenced by the configuration.
+func NewKeyRingFromConfig(cfg *config.Config) (*KeyRing, error) {
+	var keys []*Key
+	for _, kc := range cfg.SigningKeys() {
+		key, err := loadKey(kc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "auth: failed to load jwt key %q", kc.ID)
+		}
+		keys = append(keys, key)
+	}
+	return NewKeyRing(keys...)
+}
+
+func loadKey(kc config.SigningKey) (*Key, error) {
+	key := &Key{
+		ID:        kc.ID,
+		Algorithm: kc.Algorithm,
+		NotBefore: kc.NotBefore,
+		ExpiresAt: kc.ExpiresAt,
+		method:    jwt.GetSigningMethod(kc.Algorithm),
+	}
+	if key.method == nil {
+		return nil, fmt.Errorf("unsupported algorithm %q", kc.Algorithm)
+	}
+
+	switch kc.Algorithm {
+	case "HS256":
+		key.signKey = []byte(kc.Secret)
+		key.verifyKey = []byte(kc.Secret)
+	case "RS256":
+		if kc.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		} else {
+			pem, err := os.ReadFile(kc.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+	case "ES256":
+		if kc.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			private, err := jwt.ParseECPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		} else {
+			pem, err := os.ReadFile(kc.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if key.verifyKey, err = jwt.ParseECPublicKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return key, nil
+}
+
+// signingKey returns the newest active key that holds private material.
+func (kr *KeyRing) signingKey(now time.Time) (*Key, error) {
+	for _, k := range kr.keys {
+		if k.canSign() && k.active(now) {
+			return k, nil
+		}
+	}
+	return nil, errors.New("auth: no active signing key")
+}
+
+// verificationKey resolves the key named by the token's kid header. Tokens
+// minted before key rotation carry no kid and are looked up as "default",
+// the ID of the legacy single-secret key; once jwt.keys is configured
+// without a "default" entry they are rejected. Keys are only accepted
+// between NotBefore and ExpiresAt, so a staged key cannot be used early.
+func (kr *KeyRing) verificationKey(token *jwt.Token, now time.Time) (*Key, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = "default"
+	}
+	for _, k := range kr.keys {
+		if k.ID != kid {
+			continue
+		}
+		if now.Before(k.NotBefore) {
+			return nil, fmt.Errorf("key %q is not valid yet", kid)
+		}
+		if !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt) {
+			return nil, fmt.Errorf("key %q has expired", kid)
+		}
+		if token.Method.Alg() != k.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// JWK is a public key in RFC 7517 format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key that has not
+// expired, including keys that are published ahead of their NotBefore.
+// HMAC keys are shared secrets and are never published.
+func (kr *KeyRing) JWKS(now time.Time) JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range kr.keys {
+		if !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt) {
+			continue
+		}
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: k.Algorithm,
+				Kid: k.ID,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			set.Keys = append(set.Keys, JWK{
+				Kty: "EC",
+				Use: "sig",
+				Alg: k.Algorithm,
+				Kid: k.ID,
+				Crv: pub.Curve.Params().Name,
+				X:   base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+				Y:   base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+			})
+		}
+	}
+	return set
+}
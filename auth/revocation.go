@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// RevocationStore records access tokens that were revoked before they
+// expired, keyed by their jti claim.
+type RevocationStore interface {
+	Revoke(ctx context.Context, jti, userID string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type PostgresRevocationStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresRevocationStore(db *sqlx.DB) *PostgresRevocationStore {
+	return &PostgresRevocationStore{db: db}
+}
+
+func (s *PostgresRevocationStore) Revoke(ctx context.Context, jti, userID string, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING`, jti, userID, expiresAt)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to revoke token")
+	}
+
+	// Rows are only useful until the token would have expired anyway.
+	_, err = s.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP`)
+	return errors.Wrap(err, "ExecContext: failed to prune revoked tokens")
+}
+
+func (s *PostgresRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.db.GetContext(ctx, &revoked, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti)
+	if err != nil {
+		return false, errors.Wrap(err, "GetContext: failed to check revoked token")
+	}
+	return revoked, nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleUser   = "user"
+)
+
+// ValidRole reports whether role is one of the roles stored in users.role.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleEditor, RoleUser:
+		return true
+	}
+	return false
+}
+
+// RequireRole only lets the request through when the authenticated user has
+// one of the given roles. It must run after MustAuthMiddleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasRole(r.Context(), roles) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoleOrOwner behaves like RequireRole but also admits the user whose
+// ID matches the {param} URL parameter, e.g. a user deleting their own account.
+func RequireRoleOrOwner(param string, roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value("user_id").(string)
+			if (userID == "" || userID != chi.URLParam(r, param)) && !hasRole(r.Context(), roles) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RoleFromContext returns the role of the authenticated user, defaulting to
+// RoleUser for tokens minted before roles existed.
+func RoleFromContext(ctx context.Context) string {
+	if role, ok := ctx.Value("role").(string); ok && role != "" {
+		return role
+	}
+	return RoleUser
+}
+
+func hasRole(ctx context.Context, roles []string) bool {
+	if ctx.Value("user_id") == nil {
+		return false
+	}
+	role := RoleFromContext(ctx)
+	for _, allowed := range roles {
+		if role == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func setRoleInContext(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, "role", role)
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// SessionStore backs the sid claim of access tokens.
+type SessionStore interface {
+	// Touch reports whether the session is still active and records that
+	// it was just seen.
+	Touch(ctx context.Context, sessionID string) (bool, error)
+}
+
+type PostgresSessionStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresSessionStore(db *sqlx.DB) *PostgresSessionStore {
+	return &PostgresSessionStore{db: db}
+}
+
+func (s *PostgresSessionStore) Touch(ctx context.Context, sessionID string) (bool, error) {
+	var session struct {
+		RevokedAt  *time.Time `db:"revoked_at"`
+		LastSeenAt time.Time  `db:"last_seen_at"`
+	}
+	err := s.db.GetContext(ctx, &session, `SELECT revoked_at, last_seen_at FROM sessions WHERE id = $1`, sessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "GetContext: failed to get session")
+	}
+	if session.RevokedAt != nil {
+		return false, nil
+	}
+
+	// Like api_keys.last_used_at, last-seen only needs minute precision.
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND last_seen_at < CURRENT_TIMESTAMP - INTERVAL '1 minute'`, sessionID)
+	if err != nil {
+		return false, errors.Wrap(err, "ExecContext: failed to touch session")
+	}
+	return true, nil
+}
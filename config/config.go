@@ -0,0 +1,471 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds every setting the server needs at startup. Values are read
+// from an optional JSON or YAML file (CONFIG_FILE) and then overridden by
+// environment variables, so the same binary can run staging and production.
+type Config struct {
+	Env         string   `json:"env"`
+	Port        int      `json:"port"`
+	CORSOrigins []string `json:"cors_origins"`
+	Crawlers    []string `json:"crawlers"`
+	// PublicURL is the client-facing base URL used in links sent by email.
+	PublicURL string `json:"public_url"`
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies
+	// whose X-Forwarded-For and X-Real-IP headers are believed. Leave it
+	// empty when clients connect to the server directly.
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	Database Database `json:"database"`
+	JWT      JWT      `json:"jwt"`
+	Accounts Accounts `json:"accounts"`
+	Mail     Mail     `json:"mail"`
+}
+
+type Database struct {
+	URL             string   `json:"url"`
+	MaxOpenConns    int      `json:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+}
+
+type JWT struct {
+	// Secret is a shorthand for a single HS256 key with ID "default". It is
+	// ignored when Keys is set.
+	Secret        string       `json:"secret"`
+	Keys          []SigningKey `json:"keys"`
+	Expiry        Duration     `json:"expiry"`
+	RefreshExpiry Duration     `json:"refresh_expiry"`
+}
+
+// SigningKey describes one entry of the JWT key ring. The newest key whose
+// NotBefore has passed signs new tokens; every key whose NotBefore has
+// passed and that has not reached ExpiresAt is accepted when verifying.
+type SigningKey struct {
+	ID             string    `json:"id"`
+	Algorithm      string    `json:"algorithm"`
+	Secret         string    `json:"secret,omitempty"`
+	PrivateKeyFile string    `json:"private_key_file,omitempty"`
+	PublicKeyFile  string    `json:"public_key_file,omitempty"`
+	NotBefore      time.Time `json:"not_before"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+type Accounts struct {
+	PasswordResetExpiry     Duration      `json:"password_reset_expiry"`
+	EmailVerificationExpiry Duration      `json:"email_verification_expiry"`
+	LoginThrottle           LoginThrottle `json:"login_throttle"`
+	// MFAIssuer is the account label authenticator apps show next to codes.
+	MFAIssuer          string   `json:"mfa_issuer"`
+	MFAChallengeExpiry Duration `json:"mfa_challenge_expiry"`
+	// HouseholdInvitationExpiry is how long a household invitation code
+	// can be redeemed.
+	HouseholdInvitationExpiry Duration `json:"household_invitation_expiry"`
+}
+
+// LoginThrottle controls how failed logins are slowed down and locked out.
+// Counters are kept per account and per client IP; after FreeAttempts
+// failures each further attempt waits BaseDelay, doubling up to MaxDelay,
+// and reaching the max failures locks the key for LockoutDuration.
+type LoginThrottle struct {
+	Store              string   `json:"store"`
+	FreeAttempts       int      `json:"free_attempts"`
+	BaseDelay          Duration `json:"base_delay"`
+	MaxDelay           Duration `json:"max_delay"`
+	AccountMaxFailures int      `json:"account_max_failures"`
+	IPMaxFailures      int      `json:"ip_max_failures"`
+	LockoutDuration    Duration `json:"lockout_duration"`
+	Window             Duration `json:"window"`
+}
+
+// Mail selects how outgoing email is delivered. The "smtp" driver talks to
+// a real server; "file" appends messages to FilePath and "stdout" prints
+// them, which is what local development and tests use.
+type Mail struct {
+	Driver       string `json:"driver"`
+	From         string `json:"from"`
+	SMTPHost     string `json:"smtp_host"`
+	SMTPPort     int    `json:"smtp_port"`
+	SMTPUsername string `json:"smtp_username"`
+	SMTPPassword string `json:"smtp_password"`
+	FilePath     string `json:"file_path"`
+}
+
+// Duration lets durations be written as "72h" or "15m" in the config file.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.Wrap(err, "duration must be a string such as \"72h\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func defaults() Config {
+	return Config{
+		Env:         "development",
+		Port:        8085,
+		CORSOrigins: []string{"*"},
+		Crawlers:    []string{"maggi_ng"},
+		Database: Database{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: Duration{5 * time.Minute},
+		},
+		JWT: JWT{
+			Expiry:        Duration{15 * time.Minute},
+			RefreshExpiry: Duration{30 * 24 * time.Hour},
+		},
+		Accounts: Accounts{
+			PasswordResetExpiry:       Duration{time.Hour},
+			EmailVerificationExpiry:   Duration{48 * time.Hour},
+			MFAIssuer:                 "Food",
+			MFAChallengeExpiry:        Duration{5 * time.Minute},
+			HouseholdInvitationExpiry: Duration{7 * 24 * time.Hour},
+			LoginThrottle: LoginThrottle{
+				Store:              "postgres",
+				FreeAttempts:       3,
+				BaseDelay:          Duration{time.Second},
+				MaxDelay:           Duration{time.Minute},
+				AccountMaxFailures: 10,
+				IPMaxFailures:      50,
+				LockoutDuration:    Duration{15 * time.Minute},
+				Window:             Duration{15 * time.Minute},
+			},
+		},
+		Mail: Mail{
+			Driver:   "stdout",
+			From:     "no-reply@localhost",
+			SMTPPort: 587,
+		},
+		PublicURL: "http://localhost:8085",
+	}
+}
+
+// Load builds the configuration from defaults, the optional CONFIG_FILE and
+// the environment, in that order, and validates the result.
+func Load() (*Config, error) {
+	cfg := defaults()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// loadFile reads a JSON file, or a YAML one when its extension is .yaml or
+// .yml. YAML is converted to JSON first, so both formats use the json tags
+// and reject unknown keys alike.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "config: failed to open config file")
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return errors.Wrapf(err, "config: failed to decode %s", path)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return errors.Wrapf(err, "config: failed to decode %s", path)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return errors.Wrapf(err, "config: failed to decode %s", path)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	setString(&c.Env, "ENV")
+	setString(&c.Database.URL, "DATABASE_URL")
+	setString(&c.JWT.Secret, "JWT_SECRET")
+	setList(&c.CORSOrigins, "CORS_ALLOWED_ORIGINS")
+	setList(&c.Crawlers, "CRAWLERS")
+	setList(&c.TrustedProxies, "TRUSTED_PROXIES")
+	setString(&c.PublicURL, "PUBLIC_URL")
+	setString(&c.Mail.Driver, "MAIL_DRIVER")
+	setString(&c.Mail.From, "MAIL_FROM")
+	setString(&c.Mail.SMTPHost, "SMTP_HOST")
+	setString(&c.Mail.SMTPUsername, "SMTP_USERNAME")
+	setString(&c.Mail.SMTPPassword, "SMTP_PASSWORD")
+	setString(&c.Mail.FilePath, "MAIL_FILE")
+	setString(&c.Accounts.LoginThrottle.Store, "LOGIN_THROTTLE_STORE")
+	setString(&c.Accounts.MFAIssuer, "MFA_ISSUER")
+
+	if err := setInt(&c.Port, "PORT"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Mail.SMTPPort, "SMTP_PORT"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Accounts.PasswordResetExpiry, "PASSWORD_RESET_EXPIRY"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Accounts.EmailVerificationExpiry, "EMAIL_VERIFICATION_EXPIRY"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Accounts.MFAChallengeExpiry, "MFA_CHALLENGE_EXPIRY"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Accounts.HouseholdInvitationExpiry, "HOUSEHOLD_INVITATION_EXPIRY"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Database.MaxOpenConns, "DB_MAX_OPEN_CONNS"); err != nil {
+		return err
+	}
+	if err := setInt(&c.Database.MaxIdleConns, "DB_MAX_IDLE_CONNS"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.Database.ConnMaxLifetime, "DB_CONN_MAX_LIFETIME"); err != nil {
+		return err
+	}
+	if err := setDuration(&c.JWT.Expiry, "JWT_EXPIRY"); err != nil {
+		return err
+	}
+	return setDuration(&c.JWT.RefreshExpiry, "JWT_REFRESH_EXPIRY")
+}
+
+// Validate reports every missing or invalid setting at once so a broken
+// deployment fails on startup with a single readable message.
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Port <= 0 || c.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("port %d is out of range", c.Port))
+	}
+	if c.Database.URL == "" {
+		problems = append(problems, "DATABASE_URL is required")
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		problems = append(problems, "database connection limits must not be negative")
+	}
+	if len(c.JWT.Keys) == 0 {
+		if c.JWT.Secret == "" {
+			problems = append(problems, "JWT_SECRET or jwt.keys is required")
+		} else if c.IsProduction() && len(c.JWT.Secret) < 32 {
+			problems = append(problems, "JWT_SECRET must be at least 32 characters in production")
+		}
+	}
+	problems = append(problems, c.validateKeys()...)
+
+	if c.Accounts.PasswordResetExpiry.Duration <= 0 || c.Accounts.EmailVerificationExpiry.Duration <= 0 {
+		problems = append(problems, "account token expiries must be positive")
+	}
+	if c.Accounts.MFAIssuer == "" || strings.Contains(c.Accounts.MFAIssuer, ":") {
+		problems = append(problems, "MFA_ISSUER is required and must not contain a colon")
+	}
+	if c.Accounts.MFAChallengeExpiry.Duration <= 0 {
+		problems = append(problems, "MFA_CHALLENGE_EXPIRY must be positive")
+	}
+	if c.Accounts.HouseholdInvitationExpiry.Duration <= 0 {
+		problems = append(problems, "HOUSEHOLD_INVITATION_EXPIRY must be positive")
+	}
+	switch lt := c.Accounts.LoginThrottle; {
+	case lt.Store != "memory" && lt.Store != "postgres":
+		problems = append(problems, fmt.Sprintf("unknown login throttle store %q", lt.Store))
+	case lt.AccountMaxFailures <= lt.FreeAttempts || lt.IPMaxFailures <= lt.FreeAttempts:
+		problems = append(problems, "login throttle max failures must exceed free attempts")
+	case lt.LockoutDuration.Duration <= 0 || lt.Window.Duration <= 0:
+		problems = append(problems, "login throttle lockout duration and window must be positive")
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, err := parseNetwork(proxy); err != nil {
+			problems = append(problems, fmt.Sprintf("trusted proxy %q is not an IP address or CIDR range", proxy))
+		}
+	}
+	if c.Mail.From == "" {
+		problems = append(problems, "MAIL_FROM is required")
+	}
+	switch c.Mail.Driver {
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			problems = append(problems, "SMTP_HOST is required for the smtp mail driver")
+		}
+	case "file":
+		if c.Mail.FilePath == "" {
+			problems = append(problems, "MAIL_FILE is required for the file mail driver")
+		}
+	case "stdout":
+		if c.IsProduction() {
+			problems = append(problems, "the stdout mail driver cannot be used in production")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown mail driver %q", c.Mail.Driver))
+	}
+	if c.JWT.Expiry.Duration <= 0 {
+		problems = append(problems, "JWT_EXPIRY must be positive")
+	}
+	if c.JWT.RefreshExpiry.Duration <= c.JWT.Expiry.Duration {
+		problems = append(problems, "JWT_REFRESH_EXPIRY must be longer than JWT_EXPIRY")
+	}
+	if len(c.CORSOrigins) == 0 {
+		problems = append(problems, "at least one CORS origin is required")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (c *Config) validateKeys() []string {
+	var problems []string
+	seen := make(map[string]bool)
+	for i, k := range c.JWT.Keys {
+		if k.ID == "" {
+			problems = append(problems, fmt.Sprintf("jwt.keys[%d] has no id", i))
+		} else if seen[k.ID] {
+			problems = append(problems, fmt.Sprintf("jwt key id %q is used twice", k.ID))
+		}
+		seen[k.ID] = true
+
+		switch k.Algorithm {
+		case "HS256":
+			if k.Secret == "" {
+				problems = append(problems, fmt.Sprintf("jwt key %q needs a secret", k.ID))
+			}
+		case "RS256", "ES256":
+			if k.PrivateKeyFile == "" && k.PublicKeyFile == "" {
+				problems = append(problems, fmt.Sprintf("jwt key %q needs a private_key_file or public_key_file", k.ID))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("jwt key %q has unsupported algorithm %q", k.ID, k.Algorithm))
+		}
+	}
+	return problems
+}
+
+// SigningKeys returns the configured key ring, expanding the legacy
+// single-secret setting when no keys are listed.
+func (c *Config) SigningKeys() []SigningKey {
+	if len(c.JWT.Keys) > 0 {
+		return c.JWT.Keys
+	}
+	return []SigningKey{{ID: "default", Algorithm: "HS256", Secret: c.JWT.Secret}}
+}
+
+// TrustedProxyNetworks returns TrustedProxies as networks. Single addresses
+// become networks of one address. Validate has rejected anything else.
+func (c *Config) TrustedProxyNetworks() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, proxy := range c.TrustedProxies {
+		if network, err := parseNetwork(proxy); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+func parseNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", value)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
+
+func (c *Config) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// Addr returns the listen address for http.ListenAndServe.
+func (c *Config) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+func setString(dst *string, key string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = strings.TrimSpace(v)
+	}
+}
+
+func setList(dst *[]string, key string) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+func setInt(dst *int, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return errors.Wrapf(err, "config: %s must be an integer", key)
+	}
+	*dst = n
+	return nil
+}
+
+func setDuration(dst *Duration, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return errors.Wrapf(err, "config: %s must be a duration such as 15m", key)
+	}
+	dst.Duration = d
+	return nil
+}
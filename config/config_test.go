@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	fromJSON := defaults()
+	if err := fromJSON.loadFile("../config.example.json"); err != nil {
+		t.Fatal(err)
+	}
+	fromYAML := defaults()
+	if err := fromYAML.loadFile("../config.example.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON, fromYAML) {
+		t.Errorf("YAML example = %+v, want the JSON example %+v", fromYAML, fromJSON)
+	}
+	if fromYAML.Database.ConnMaxLifetime.Duration != 5*time.Minute {
+		t.Errorf("conn_max_lifetime = %v, want 5m", fromYAML.Database.ConnMaxLifetime)
+	}
+}
+
+func TestLoadFileRejectsUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"config.json": `{"prot": 8080}`,
+		"config.yml":  "prot: 8080\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg := defaults()
+		if err := cfg.loadFile(path); err == nil {
+			t.Errorf("loadFile(%s) accepted an unknown key", name)
+		}
+	}
+}
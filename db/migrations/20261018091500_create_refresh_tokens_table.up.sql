@@ -0,0 +1,24 @@
+-- Refresh tokens are stored as SHA-256 hashes; the raw value only ever
+-- exists on the client. Rotated tokens point at their replacement so reuse
+-- of an old token can be detected.
+CREATE TABLE refresh_tokens (
+                                id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+                                user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                token_hash TEXT NOT NULL UNIQUE,
+                                expires_at TIMESTAMP NOT NULL,
+                                revoked_at TIMESTAMP,
+                                replaced_by UUID REFERENCES refresh_tokens(id),
+                                created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+-- Access tokens revoked before their natural expiry, keyed by the jti claim.
+CREATE TABLE revoked_tokens (
+                                jti UUID PRIMARY KEY,
+                                user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                expires_at TIMESTAMP NOT NULL,
+                                revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
@@ -0,0 +1,16 @@
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Single-use tokens for password resets and email verification. Only the
+-- SHA-256 hash of the token sent by email is stored.
+CREATE TABLE user_tokens (
+                             id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+                             user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                             purpose VARCHAR(30) NOT NULL CHECK (purpose IN ('password_reset', 'email_verification')),
+                             token_hash TEXT NOT NULL UNIQUE,
+                             expires_at TIMESTAMP NOT NULL,
+                             used_at TIMESTAMP,
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_user_tokens_user_id_purpose ON user_tokens (user_id, purpose);
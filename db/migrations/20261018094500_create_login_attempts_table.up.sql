@@ -0,0 +1,7 @@
+-- Failed login counters, keyed by "account:<email>" or "ip:<address>".
+CREATE TABLE login_attempts (
+                                key TEXT PRIMARY KEY,
+                                failures INT NOT NULL DEFAULT 0,
+                                last_failure_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                blocked_until TIMESTAMP
+);
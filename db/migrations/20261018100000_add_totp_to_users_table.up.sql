@@ -0,0 +1,23 @@
+-- totp_secret is set at enrollment and only becomes active once the user
+-- confirms a code, which stamps totp_enabled_at. totp_last_step records the
+-- last accepted time step so a code cannot be replayed.
+ALTER TABLE users
+    ADD COLUMN totp_secret TEXT,
+    ADD COLUMN totp_enabled_at TIMESTAMP,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- One-time recovery codes, stored as SHA-256 hashes.
+CREATE TABLE user_recovery_codes (
+                                     id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+                                     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     code_hash TEXT NOT NULL,
+                                     used_at TIMESTAMP,
+                                     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                     UNIQUE (user_id, code_hash)
+);
+
+-- Logins with 2FA enabled receive a short-lived challenge token that is
+-- exchanged for the real JWT once a code has been checked.
+ALTER TABLE user_tokens DROP CONSTRAINT user_tokens_purpose_check;
+ALTER TABLE user_tokens ADD CONSTRAINT user_tokens_purpose_check
+    CHECK (purpose IN ('password_reset', 'email_verification', 'mfa_challenge'));
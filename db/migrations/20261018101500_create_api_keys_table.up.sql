@@ -0,0 +1,17 @@
+-- Personal API keys for machine clients. Only the SHA-256 hash of the key
+-- is stored; prefix is the first characters of the key, kept so users can
+-- tell their keys apart.
+CREATE TABLE api_keys (
+                          id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+                          user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                          name VARCHAR(100) NOT NULL,
+                          prefix VARCHAR(20) NOT NULL,
+                          key_hash TEXT NOT NULL UNIQUE,
+                          scope VARCHAR(10) NOT NULL CHECK (scope IN ('read', 'write')),
+                          expires_at TIMESTAMP,
+                          last_used_at TIMESTAMP,
+                          revoked_at TIMESTAMP,
+                          created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,29 @@
+-- One row per signed-in device. Access tokens carry the session id in their
+-- sid claim and refresh tokens point at their session, so revoking a
+-- session signs that device out everywhere at once.
+CREATE TABLE sessions (
+                          id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+                          user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                          user_agent TEXT NOT NULL DEFAULT '',
+                          ip TEXT NOT NULL DEFAULT '',
+                          created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                          last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                          revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN session_id UUID REFERENCES sessions(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+
+-- Refresh tokens that are still usable each become a session of their own,
+-- reusing the token id, so existing sign-ins show up in the list.
+INSERT INTO sessions (id, user_id, created_at, last_seen_at)
+SELECT id, user_id, created_at, created_at
+FROM refresh_tokens
+WHERE revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP;
+
+UPDATE refresh_tokens SET session_id = id
+WHERE revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP;
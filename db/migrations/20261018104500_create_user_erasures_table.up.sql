@@ -0,0 +1,13 @@
+-- Audit trail of account erasures. The users row is gone by the time this
+-- is read, so only the former id and a hash of the email are kept, enough
+-- to answer "was this account erased, when and by whom".
+CREATE TABLE user_erasures (
+                               id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+                               user_id UUID NOT NULL,
+                               email_hash TEXT NOT NULL,
+                               erased_by UUID,
+                               removed JSONB NOT NULL DEFAULT '{}',
+                               erased_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_user_erasures_user_id ON user_erasures (user_id);
@@ -0,0 +1,9 @@
+ALTER TABLE meal_plans DROP COLUMN IF EXISTS servings;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS units,
+    DROP COLUMN IF EXISTS locale,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS household_size,
+    DROP COLUMN IF EXISTS avatar_url,
+    DROP COLUMN IF EXISTS display_name;
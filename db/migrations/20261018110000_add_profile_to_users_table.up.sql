@@ -0,0 +1,16 @@
+ALTER TABLE users
+    ADD COLUMN display_name VARCHAR(100),
+    ADD COLUMN avatar_url TEXT,
+    ADD COLUMN household_size SMALLINT NOT NULL DEFAULT 1,
+    ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    ADD COLUMN locale VARCHAR(35) NOT NULL DEFAULT 'en',
+    ADD COLUMN units VARCHAR(10) NOT NULL DEFAULT 'metric';
+
+ALTER TABLE users
+    ADD CONSTRAINT users_household_size_check CHECK (household_size BETWEEN 1 AND 20),
+    ADD CONSTRAINT users_units_check CHECK (units IN ('metric', 'imperial'));
+
+-- Number of people the meal was planned for, copied from the household size
+-- when the plan is generated so later profile changes do not rewrite history.
+ALTER TABLE meal_plans
+    ADD COLUMN servings SMALLINT NOT NULL DEFAULT 1;
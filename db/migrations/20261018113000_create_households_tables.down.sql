@@ -0,0 +1,71 @@
+CREATE OR REPLACE FUNCTION recommend_recipes(p_user_id UUID, p_limit INT, p_meal_type TEXT)
+RETURNS TABLE (
+    recipe_id UUID,
+    similarity FLOAT
+) AS $$
+BEGIN
+RETURN QUERY
+    WITH user_likes AS (
+        SELECT
+            unnest(recipe_ids) AS recipe_id
+        FROM
+            user_preferences
+        WHERE
+            user_id = p_user_id
+    ),
+    candidate_recipes AS (
+        SELECT
+            rv2.recipe_id AS recipe_id,
+            MAX(compute_cosine_similarity(ul.recipe_id, rv2.recipe_id)) AS similarity
+        FROM
+            user_likes ul
+            JOIN recipe_vectors rv1 ON ul.recipe_id = rv1.recipe_id
+            JOIN recipe_vectors rv2 ON rv1.recipe_id <> rv2.recipe_id
+        GROUP BY
+            rv2.recipe_id
+    ),
+    filtered_recipes AS (
+        SELECT
+            cr.recipe_id,
+            cr.similarity
+        FROM
+            candidate_recipes cr
+            JOIN recipe_details rd ON cr.recipe_id = rd.recipe_id
+        WHERE
+            rd.meal_type = p_meal_type
+    )
+SELECT
+    fr.recipe_id,
+    fr.similarity
+FROM
+    filtered_recipes fr
+WHERE
+    fr.similarity IS NOT NULL
+ORDER BY
+    fr.similarity DESC
+    LIMIT p_limit;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS recommend_recipes_for_users(UUID[], INT, TEXT);
+
+ALTER TABLE meal_plans DROP CONSTRAINT IF EXISTS unique_household_day_weekstart_mealtype;
+ALTER TABLE meal_plans DROP COLUMN IF EXISTS household_id;
+
+-- A user who generated plans in more than one household can have several
+-- plans for the same meal. Keep the most recent so the per-user constraint
+-- can be restored.
+DELETE FROM meal_plans mp
+USING meal_plans newer
+WHERE newer.user_id = mp.user_id
+  AND newer.day_of_week = mp.day_of_week
+  AND newer.week_start_date = mp.week_start_date
+  AND newer.meal_type = mp.meal_type
+  AND (newer.updated_at, newer.id) > (mp.updated_at, mp.id);
+ALTER TABLE meal_plans
+    ADD CONSTRAINT unique_user_day_weekstart_mealtype
+        UNIQUE (user_id, day_of_week, week_start_date, meal_type);
+
+DROP TABLE IF EXISTS household_invitations;
+DROP TABLE IF EXISTS household_members;
+DROP TABLE IF EXISTS households;
@@ -0,0 +1,118 @@
+-- A household groups the people who eat together. Every user belongs to
+-- exactly one household; someone who cooks only for themselves is simply
+-- the owner of a household of one.
+CREATE TABLE households (
+                            id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+                            name VARCHAR(100) NOT NULL,
+                            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                            updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE household_members (
+                                   household_id UUID NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+                                   user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+                                   role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'member')),
+                                   joined_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                   PRIMARY KEY (household_id, user_id)
+);
+
+-- Invitations are redeemed with a short code. When email is set only the
+-- account with that address may accept. Only the SHA-256 hash of the code
+-- is stored.
+CREATE TABLE household_invitations (
+                                       id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+                                       household_id UUID NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+                                       email VARCHAR(255),
+                                       code_hash TEXT NOT NULL UNIQUE,
+                                       invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+                                       expires_at TIMESTAMP NOT NULL,
+                                       accepted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+                                       accepted_at TIMESTAMP,
+                                       revoked_at TIMESTAMP,
+                                       created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_household_invitations_household_id ON household_invitations (household_id);
+
+-- Existing users each become the owner of a household of one. The household
+-- reuses the user's id so their existing meal plans map onto it directly.
+INSERT INTO households (id, name)
+SELECT id, username || '''s household' FROM users;
+
+INSERT INTO household_members (household_id, user_id, role)
+SELECT id, id, 'owner' FROM users;
+
+-- Meal plans now belong to the household; user_id records who generated them.
+ALTER TABLE meal_plans
+    ADD COLUMN household_id UUID REFERENCES households(id) ON DELETE CASCADE;
+
+UPDATE meal_plans SET household_id = user_id;
+DELETE FROM meal_plans WHERE household_id IS NULL;
+
+ALTER TABLE meal_plans ALTER COLUMN household_id SET NOT NULL;
+ALTER TABLE meal_plans DROP CONSTRAINT unique_user_day_weekstart_mealtype;
+ALTER TABLE meal_plans
+    ADD CONSTRAINT unique_household_day_weekstart_mealtype
+        UNIQUE (household_id, day_of_week, week_start_date, meal_type);
+
+-- Recommend recipes from the merged likes of several users, e.g. every
+-- member of a household.
+CREATE OR REPLACE FUNCTION recommend_recipes_for_users(p_user_ids UUID[], p_limit INT, p_meal_type TEXT)
+RETURNS TABLE (
+    recipe_id UUID,
+    similarity FLOAT
+) AS $$
+BEGIN
+RETURN QUERY
+    WITH user_likes AS (
+        SELECT DISTINCT
+            unnest(recipe_ids) AS recipe_id
+        FROM
+            user_preferences
+        WHERE
+            user_id = ANY(p_user_ids)
+    ),
+    candidate_recipes AS (
+        SELECT
+            rv2.recipe_id AS recipe_id,
+            MAX(compute_cosine_similarity(ul.recipe_id, rv2.recipe_id)) AS similarity
+        FROM
+            user_likes ul
+            JOIN recipe_vectors rv1 ON ul.recipe_id = rv1.recipe_id
+            JOIN recipe_vectors rv2 ON rv1.recipe_id <> rv2.recipe_id
+        GROUP BY
+            rv2.recipe_id
+    ),
+    filtered_recipes AS (
+        SELECT
+            cr.recipe_id,
+            cr.similarity
+        FROM
+            candidate_recipes cr
+            JOIN recipe_details rd ON cr.recipe_id = rd.recipe_id
+        WHERE
+            rd.meal_type = p_meal_type
+    )
+SELECT
+    fr.recipe_id,
+    fr.similarity
+FROM
+    filtered_recipes fr
+WHERE
+    fr.similarity IS NOT NULL
+ORDER BY
+    fr.similarity DESC
+    LIMIT p_limit;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION recommend_recipes(p_user_id UUID, p_limit INT, p_meal_type TEXT)
+RETURNS TABLE (
+    recipe_id UUID,
+    similarity FLOAT
+) AS $$
+BEGIN
+RETURN QUERY
+SELECT * FROM recommend_recipes_for_users(ARRAY[p_user_id], p_limit, p_meal_type);
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,63 @@
+-- Restore recommendations without dietary filtering.
+CREATE OR REPLACE FUNCTION recommend_recipes_for_users(p_user_ids UUID[], p_limit INT, p_meal_type TEXT)
+RETURNS TABLE (
+    recipe_id UUID,
+    similarity FLOAT
+) AS $$
+BEGIN
+RETURN QUERY
+    WITH user_likes AS (
+        SELECT DISTINCT
+            unnest(recipe_ids) AS recipe_id
+        FROM
+            user_preferences
+        WHERE
+            user_id = ANY(p_user_ids)
+    ),
+    candidate_recipes AS (
+        SELECT
+            rv2.recipe_id AS recipe_id,
+            MAX(compute_cosine_similarity(ul.recipe_id, rv2.recipe_id)) AS similarity
+        FROM
+            user_likes ul
+            JOIN recipe_vectors rv1 ON ul.recipe_id = rv1.recipe_id
+            JOIN recipe_vectors rv2 ON rv1.recipe_id <> rv2.recipe_id
+        GROUP BY
+            rv2.recipe_id
+    ),
+    filtered_recipes AS (
+        SELECT
+            cr.recipe_id,
+            cr.similarity
+        FROM
+            candidate_recipes cr
+            JOIN recipe_details rd ON cr.recipe_id = rd.recipe_id
+        WHERE
+            rd.meal_type = p_meal_type
+    )
+SELECT
+    fr.recipe_id,
+    fr.similarity
+FROM
+    filtered_recipes fr
+WHERE
+    fr.similarity IS NOT NULL
+ORDER BY
+    fr.similarity DESC
+    LIMIT p_limit;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS recipe_cuisine_match(UUID, TEXT[]);
+DROP FUNCTION IF EXISTS recipe_disliked_count(UUID, TEXT[]);
+DROP VIEW IF EXISTS recipe_diet_conflicts;
+DROP TABLE IF EXISTS diet_exclusions;
+
+ALTER TABLE user_preferences
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS dietary_goals,
+    DROP COLUMN IF EXISTS additional_preferences,
+    DROP COLUMN IF EXISTS disliked_ingredients,
+    DROP COLUMN IF EXISTS cuisine_preference,
+    DROP COLUMN IF EXISTS gluten_free,
+    DROP COLUMN IF EXISTS vegetarian;
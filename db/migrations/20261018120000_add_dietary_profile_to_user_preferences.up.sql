@@ -0,0 +1,206 @@
+ALTER TABLE user_preferences
+    ADD COLUMN vegetarian BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN gluten_free BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN cuisine_preference VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN disliked_ingredients TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN additional_preferences JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN dietary_goals VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- Recipes carry no diet labels, so a diet rules a recipe out when one of its
+-- ingredients or main ingredients matches a pattern below. Patterns are
+-- case-insensitive regular expressions; \m anchors them to the start of a
+-- word so "chicken" also catches "chicken thighs".
+CREATE TABLE diet_exclusions (
+                                 diet VARCHAR(20) NOT NULL CHECK (diet IN ('vegetarian', 'gluten_free')),
+                                 pattern TEXT NOT NULL,
+                                 PRIMARY KEY (diet, pattern)
+);
+
+INSERT INTO diet_exclusions (diet, pattern) VALUES
+    ('vegetarian', '\mbeef'),
+    ('vegetarian', '\mchicken'),
+    ('vegetarian', '\mgoat'),
+    ('vegetarian', '\mmeat'),
+    ('vegetarian', '\mbush ?meat'),
+    ('vegetarian', '\mpork'),
+    ('vegetarian', '\mbacon'),
+    ('vegetarian', '\mham\M'),
+    ('vegetarian', '\msausage'),
+    ('vegetarian', '\mlamb'),
+    ('vegetarian', '\mmutton'),
+    ('vegetarian', '\mram\M'),
+    ('vegetarian', '\mturkey'),
+    ('vegetarian', '\mduck'),
+    ('vegetarian', '\mguinea fowl'),
+    ('vegetarian', '\mfish'),
+    ('vegetarian', '\mcatfish'),
+    ('vegetarian', '\mstockfish'),
+    ('vegetarian', '\mmackerel'),
+    ('vegetarian', '\mtitus'),
+    ('vegetarian', '\msardine'),
+    ('vegetarian', '\mtuna'),
+    ('vegetarian', '\msalmon'),
+    ('vegetarian', '\mtilapia'),
+    ('vegetarian', '\mshrimp'),
+    ('vegetarian', '\mprawn'),
+    ('vegetarian', '\mcrayfish'),
+    ('vegetarian', '\mcrab'),
+    ('vegetarian', '\mlobster'),
+    ('vegetarian', '\msnail'),
+    ('vegetarian', '\mperiwinkle'),
+    ('vegetarian', '\moyster'),
+    ('vegetarian', '\msquid'),
+    ('vegetarian', '\mponmo'),
+    ('vegetarian', '\mkpomo'),
+    ('vegetarian', '\mcow ?(skin|foot|leg|tail)'),
+    ('vegetarian', '\moxtail'),
+    ('vegetarian', '\mtripe'),
+    ('vegetarian', '\mshaki'),
+    ('vegetarian', '\mofal'),
+    ('vegetarian', '\moffal'),
+    ('vegetarian', '\mliver'),
+    ('vegetarian', '\mkidney\M(?! bean)'),
+    ('vegetarian', '\mgizzard'),
+    ('vegetarian', '\msuya'),
+    ('vegetarian', '\masun'),
+    ('vegetarian', '\mgelatin'),
+    ('gluten_free', '\mwheat'),
+    ('gluten_free', '^(?!.*\m(cassava|yam|plantain|rice|corn|maize|almond|coconut|bean|millet|sorghum|tapioca|potato)\M).*\mflour'),
+    ('gluten_free', '\msemolina'),
+    ('gluten_free', '\msemovita'),
+    ('gluten_free', '\mbread'),
+    ('gluten_free', '\mbreadcrumb'),
+    ('gluten_free', '\mspaghetti'),
+    ('gluten_free', '\mpasta'),
+    ('gluten_free', '\mmacaroni'),
+    ('gluten_free', '\mnoodle'),
+    ('gluten_free', '\mindomie'),
+    ('gluten_free', '\mcouscous'),
+    ('gluten_free', '\mbarley'),
+    ('gluten_free', '\mrye\M'),
+    ('gluten_free', '\mmalt'),
+    ('gluten_free', '\mbiscuit'),
+    ('gluten_free', '\mchin ?chin'),
+    ('gluten_free', '\mpuff ?puff'),
+    ('gluten_free', '\mdough'),
+    ('gluten_free', '\msoy sauce');
+
+-- recipe_diet_conflicts lists every (recipe, diet) pair the recipe breaks.
+CREATE VIEW recipe_diet_conflicts AS
+SELECT DISTINCT ri.recipe_id, de.diet
+FROM recipe_ingredients ri
+         JOIN ingredients i ON i.id = ri.ingredient_id
+         JOIN diet_exclusions de ON i.name ~* de.pattern
+UNION
+SELECT rd.recipe_id, de.diet
+FROM recipe_details rd
+         JOIN diet_exclusions de ON rd.main_ingredients ~* de.pattern;
+
+-- recipe_disliked_count counts the disliked ingredients a recipe uses, matched
+-- case-insensitively against ingredient names and main ingredients.
+CREATE OR REPLACE FUNCTION recipe_disliked_count(p_recipe_id UUID, p_disliked TEXT[])
+RETURNS INT AS $$
+SELECT COUNT(*)::INT
+FROM unnest(p_disliked) AS d(name)
+WHERE EXISTS (
+    SELECT 1
+    FROM recipe_ingredients ri
+             JOIN ingredients i ON i.id = ri.ingredient_id
+    WHERE ri.recipe_id = p_recipe_id
+      AND i.name ILIKE '%' || d.name || '%'
+) OR EXISTS (
+    SELECT 1
+    FROM recipe_details rd
+    WHERE rd.recipe_id = p_recipe_id
+      AND rd.main_ingredients ILIKE '%' || d.name || '%'
+);
+$$ LANGUAGE sql STABLE;
+
+-- recipe_cuisine_match reports whether the recipe's region or food class
+-- mentions one of the preferred cuisines.
+CREATE OR REPLACE FUNCTION recipe_cuisine_match(p_recipe_id UUID, p_cuisines TEXT[])
+RETURNS BOOLEAN AS $$
+SELECT EXISTS (
+    SELECT 1
+    FROM recipe_details rd
+             CROSS JOIN unnest(p_cuisines) AS c(name)
+    WHERE rd.recipe_id = p_recipe_id
+      AND c.name <> ''
+      AND (rd.region ILIKE '%' || c.name || '%' OR rd.food_class ILIKE '%' || c.name || '%')
+);
+$$ LANGUAGE sql STABLE;
+
+-- Recommendations now respect the merged dietary profile of the users: the
+-- strictest diet of any member applies, and each disliked ingredient costs a
+-- full point of similarity so those recipes sink below every other match.
+-- A preferred cuisine only nudges the order.
+CREATE OR REPLACE FUNCTION recommend_recipes_for_users(p_user_ids UUID[], p_limit INT, p_meal_type TEXT)
+RETURNS TABLE (
+    recipe_id UUID,
+    similarity FLOAT
+) AS $$
+BEGIN
+RETURN QUERY
+    WITH user_likes AS (
+        SELECT DISTINCT
+            unnest(recipe_ids) AS recipe_id
+        FROM
+            user_preferences
+        WHERE
+            user_id = ANY(p_user_ids)
+    ),
+    profile AS (
+        SELECT
+            COALESCE(bool_or(up.vegetarian), false) AS vegetarian,
+            COALESCE(bool_or(up.gluten_free), false) AS gluten_free,
+            COALESCE(array_agg(DISTINCT d.name) FILTER (WHERE d.name IS NOT NULL), '{}') AS disliked,
+            COALESCE(array_agg(DISTINCT up.cuisine_preference) FILTER (WHERE up.cuisine_preference <> ''), '{}') AS cuisines
+        FROM
+            user_preferences up
+            LEFT JOIN LATERAL unnest(up.disliked_ingredients) AS d(name) ON true
+        WHERE
+            up.user_id = ANY(p_user_ids)
+    ),
+    candidate_recipes AS (
+        SELECT
+            rv2.recipe_id AS recipe_id,
+            MAX(compute_cosine_similarity(ul.recipe_id, rv2.recipe_id)) AS similarity
+        FROM
+            user_likes ul
+            JOIN recipe_vectors rv1 ON ul.recipe_id = rv1.recipe_id
+            JOIN recipe_vectors rv2 ON rv1.recipe_id <> rv2.recipe_id
+        GROUP BY
+            rv2.recipe_id
+    ),
+    filtered_recipes AS (
+        SELECT
+            cr.recipe_id,
+            (cr.similarity
+                - recipe_disliked_count(cr.recipe_id, p.disliked)
+                + CASE WHEN recipe_cuisine_match(cr.recipe_id, p.cuisines) THEN 0.1 ELSE 0 END)::FLOAT AS similarity
+        FROM
+            candidate_recipes cr
+            JOIN recipe_details rd ON cr.recipe_id = rd.recipe_id
+            CROSS JOIN profile p
+        WHERE
+            rd.meal_type = p_meal_type
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_diet_conflicts c
+                WHERE c.recipe_id = cr.recipe_id
+                  AND ((c.diet = 'vegetarian' AND p.vegetarian) OR (c.diet = 'gluten_free' AND p.gluten_free))
+            )
+    )
+SELECT
+    fr.recipe_id,
+    fr.similarity
+FROM
+    filtered_recipes fr
+WHERE
+    fr.similarity IS NOT NULL
+ORDER BY
+    fr.similarity DESC
+    LIMIT p_limit;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,220 @@
+CREATE TABLE allergens (
+                           code VARCHAR(30) PRIMARY KEY,
+                           name VARCHAR(100) NOT NULL
+);
+
+INSERT INTO allergens (code, name) VALUES
+    ('peanut', 'Peanut (groundnut)'),
+    ('tree_nut', 'Tree nuts'),
+    ('shellfish', 'Shellfish'),
+    ('crayfish', 'Crayfish'),
+    ('fish', 'Fish'),
+    ('egg', 'Egg'),
+    ('dairy', 'Dairy'),
+    ('gluten', 'Gluten'),
+    ('soy', 'Soy'),
+    ('sesame', 'Sesame');
+
+-- Ingredients are tagged automatically from these patterns when they are
+-- created or renamed. Patterns are case-insensitive regular expressions.
+CREATE TABLE allergen_patterns (
+                                   allergen VARCHAR(30) NOT NULL REFERENCES allergens(code) ON DELETE CASCADE,
+                                   pattern TEXT NOT NULL,
+                                   PRIMARY KEY (allergen, pattern)
+);
+
+INSERT INTO allergen_patterns (allergen, pattern) VALUES
+    ('peanut', '\mpeanut'),
+    ('peanut', '\mground ?nut'),
+    ('peanut', '\mmonkey ?nut'),
+    ('peanut', '\mkuli ?kuli'),
+    ('peanut', '\marachis'),
+    ('tree_nut', '\malmond'),
+    ('tree_nut', '\mcashew'),
+    ('tree_nut', '\mwalnut'),
+    ('tree_nut', '\mhazelnut'),
+    ('tree_nut', '\mpecan'),
+    ('tree_nut', '\mpistachio'),
+    ('tree_nut', '\mmacadamia'),
+    ('tree_nut', '\mbrazil ?nut'),
+    ('shellfish', '\mshrimp'),
+    ('shellfish', '\mprawn'),
+    ('shellfish', '\mcray ?fish'),
+    ('shellfish', '\mcrab'),
+    ('shellfish', '\mlobster'),
+    ('shellfish', '\mperiwinkle'),
+    ('shellfish', '\moyster'),
+    ('shellfish', '\mmussel'),
+    ('shellfish', '\mclam'),
+    ('shellfish', '\mscallop'),
+    ('shellfish', '\msquid'),
+    ('shellfish', '\moctopus'),
+    ('shellfish', '\msnail'),
+    ('crayfish', '\mcray ?fish'),
+    ('fish', '\mfish'),
+    ('fish', '\mcatfish'),
+    ('fish', '\mstockfish'),
+    ('fish', '\mmackerel'),
+    ('fish', '\mtitus'),
+    ('fish', '\msardine'),
+    ('fish', '\mtuna'),
+    ('fish', '\msalmon'),
+    ('fish', '\mtilapia'),
+    ('fish', '\mherring'),
+    ('fish', '\manchov'),
+    ('fish', '\mcod\M'),
+    ('fish', '\mbonga'),
+    ('fish', '\mpanla'),
+    ('egg', '\meggs?\M'),
+    ('egg', '\mmayonnaise'),
+    ('egg', '\mmeringue'),
+    ('dairy', '^(?!.*\mcoconut).*\mmilk'),
+    ('dairy', '^(?!.*\m(peanut|shea|cocoa)).*\mbutter'),
+    ('dairy', '\mcheese'),
+    ('dairy', '\mcream'),
+    ('dairy', '\myog(h)?urt'),
+    ('dairy', '\mwara\M'),
+    ('dairy', '\mghee'),
+    ('dairy', '\mwhey'),
+    ('dairy', '\mcasein'),
+    ('soy', '\msoy'),
+    ('soy', '\mtofu'),
+    ('soy', '\mmiso\M'),
+    ('soy', '\medamame'),
+    ('sesame', '\msesame'),
+    ('sesame', '\mbeniseed'),
+    ('sesame', '\mbenne'),
+    ('sesame', '\mtahini');
+
+INSERT INTO allergen_patterns (allergen, pattern)
+SELECT 'gluten', pattern FROM diet_exclusions WHERE diet = 'gluten_free';
+
+-- Tags with source 'manual' are set by editors and survive renames.
+CREATE TABLE ingredient_allergens (
+                                      ingredient_id UUID NOT NULL REFERENCES ingredients(id) ON DELETE CASCADE,
+                                      allergen VARCHAR(30) NOT NULL REFERENCES allergens(code) ON DELETE CASCADE,
+                                      source VARCHAR(10) NOT NULL DEFAULT 'auto' CHECK (source IN ('auto', 'manual')),
+                                      PRIMARY KEY (ingredient_id, allergen)
+);
+
+CREATE INDEX idx_ingredient_allergens_allergen ON ingredient_allergens (allergen);
+
+CREATE OR REPLACE FUNCTION tag_ingredient_allergens()
+RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM ingredient_allergens WHERE ingredient_id = NEW.id AND source = 'auto';
+
+    INSERT INTO ingredient_allergens (ingredient_id, allergen, source)
+    SELECT DISTINCT NEW.id, ap.allergen, 'auto'
+    FROM allergen_patterns ap
+    WHERE NEW.name ~* ap.pattern
+    ON CONFLICT DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tag_ingredient_allergens_trigger
+    AFTER INSERT OR UPDATE OF name ON ingredients
+    FOR EACH ROW EXECUTE FUNCTION tag_ingredient_allergens();
+
+INSERT INTO ingredient_allergens (ingredient_id, allergen, source)
+SELECT DISTINCT i.id, ap.allergen, 'auto'
+FROM ingredients i
+         JOIN allergen_patterns ap ON i.name ~* ap.pattern;
+
+CREATE TABLE user_allergens (
+                                user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                allergen VARCHAR(30) NOT NULL REFERENCES allergens(code),
+                                created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                PRIMARY KEY (user_id, allergen)
+);
+
+-- recipe_allergens lists every allergen a recipe contains, from its tagged
+-- ingredients and, for recipes without ingredient rows, its main ingredients.
+CREATE VIEW recipe_allergens AS
+SELECT DISTINCT ri.recipe_id, ia.allergen
+FROM recipe_ingredients ri
+         JOIN ingredient_allergens ia ON ia.ingredient_id = ri.ingredient_id
+UNION
+SELECT rd.recipe_id, ap.allergen
+FROM recipe_details rd
+         JOIN allergen_patterns ap ON rd.main_ingredients ~* ap.pattern;
+
+-- Recipes containing an allergen of any of the users are never recommended.
+CREATE OR REPLACE FUNCTION recommend_recipes_for_users(p_user_ids UUID[], p_limit INT, p_meal_type TEXT)
+RETURNS TABLE (
+    recipe_id UUID,
+    similarity FLOAT
+) AS $$
+BEGIN
+RETURN QUERY
+    WITH user_likes AS (
+        SELECT DISTINCT
+            unnest(recipe_ids) AS recipe_id
+        FROM
+            user_preferences
+        WHERE
+            user_id = ANY(p_user_ids)
+    ),
+    profile AS (
+        SELECT
+            COALESCE(bool_or(up.vegetarian), false) AS vegetarian,
+            COALESCE(bool_or(up.gluten_free), false) AS gluten_free,
+            COALESCE(array_agg(DISTINCT d.name) FILTER (WHERE d.name IS NOT NULL), '{}') AS disliked,
+            COALESCE(array_agg(DISTINCT up.cuisine_preference) FILTER (WHERE up.cuisine_preference <> ''), '{}') AS cuisines
+        FROM
+            user_preferences up
+            LEFT JOIN LATERAL unnest(up.disliked_ingredients) AS d(name) ON true
+        WHERE
+            up.user_id = ANY(p_user_ids)
+    ),
+    candidate_recipes AS (
+        SELECT
+            rv2.recipe_id AS recipe_id,
+            MAX(compute_cosine_similarity(ul.recipe_id, rv2.recipe_id)) AS similarity
+        FROM
+            user_likes ul
+            JOIN recipe_vectors rv1 ON ul.recipe_id = rv1.recipe_id
+            JOIN recipe_vectors rv2 ON rv1.recipe_id <> rv2.recipe_id
+        GROUP BY
+            rv2.recipe_id
+    ),
+    filtered_recipes AS (
+        SELECT
+            cr.recipe_id,
+            (cr.similarity
+                - recipe_disliked_count(cr.recipe_id, p.disliked)
+                + CASE WHEN recipe_cuisine_match(cr.recipe_id, p.cuisines) THEN 0.1 ELSE 0 END)::FLOAT AS similarity
+        FROM
+            candidate_recipes cr
+            JOIN recipe_details rd ON cr.recipe_id = rd.recipe_id
+            CROSS JOIN profile p
+        WHERE
+            rd.meal_type = p_meal_type
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_diet_conflicts c
+                WHERE c.recipe_id = cr.recipe_id
+                  AND ((c.diet = 'vegetarian' AND p.vegetarian) OR (c.diet = 'gluten_free' AND p.gluten_free))
+            )
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_allergens ra
+                JOIN user_allergens ua ON ua.allergen = ra.allergen
+                WHERE ra.recipe_id = cr.recipe_id
+                  AND ua.user_id = ANY(p_user_ids)
+            )
+    )
+SELECT
+    fr.recipe_id,
+    fr.similarity
+FROM
+    filtered_recipes fr
+WHERE
+    fr.similarity IS NOT NULL
+ORDER BY
+    fr.similarity DESC
+    LIMIT p_limit;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,81 @@
+-- Restore recommendations seeded by likes only.
+CREATE OR REPLACE FUNCTION recommend_recipes_for_users(p_user_ids UUID[], p_limit INT, p_meal_type TEXT)
+RETURNS TABLE (
+    recipe_id UUID,
+    similarity FLOAT
+) AS $$
+BEGIN
+RETURN QUERY
+    WITH user_likes AS (
+        SELECT DISTINCT
+            unnest(recipe_ids) AS recipe_id
+        FROM
+            user_preferences
+        WHERE
+            user_id = ANY(p_user_ids)
+    ),
+    profile AS (
+        SELECT
+            COALESCE(bool_or(up.vegetarian), false) AS vegetarian,
+            COALESCE(bool_or(up.gluten_free), false) AS gluten_free,
+            COALESCE(array_agg(DISTINCT d.name) FILTER (WHERE d.name IS NOT NULL), '{}') AS disliked,
+            COALESCE(array_agg(DISTINCT up.cuisine_preference) FILTER (WHERE up.cuisine_preference <> ''), '{}') AS cuisines
+        FROM
+            user_preferences up
+            LEFT JOIN LATERAL unnest(up.disliked_ingredients) AS d(name) ON true
+        WHERE
+            up.user_id = ANY(p_user_ids)
+    ),
+    candidate_recipes AS (
+        SELECT
+            rv2.recipe_id AS recipe_id,
+            MAX(compute_cosine_similarity(ul.recipe_id, rv2.recipe_id)) AS similarity
+        FROM
+            user_likes ul
+            JOIN recipe_vectors rv1 ON ul.recipe_id = rv1.recipe_id
+            JOIN recipe_vectors rv2 ON rv1.recipe_id <> rv2.recipe_id
+        GROUP BY
+            rv2.recipe_id
+    ),
+    filtered_recipes AS (
+        SELECT
+            cr.recipe_id,
+            (cr.similarity
+                - recipe_disliked_count(cr.recipe_id, p.disliked)
+                + CASE WHEN recipe_cuisine_match(cr.recipe_id, p.cuisines) THEN 0.1 ELSE 0 END)::FLOAT AS similarity
+        FROM
+            candidate_recipes cr
+            JOIN recipe_details rd ON cr.recipe_id = rd.recipe_id
+            CROSS JOIN profile p
+        WHERE
+            rd.meal_type = p_meal_type
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_diet_conflicts c
+                WHERE c.recipe_id = cr.recipe_id
+                  AND ((c.diet = 'vegetarian' AND p.vegetarian) OR (c.diet = 'gluten_free' AND p.gluten_free))
+            )
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_allergens ra
+                JOIN user_allergens ua ON ua.allergen = ra.allergen
+                WHERE ra.recipe_id = cr.recipe_id
+                  AND ua.user_id = ANY(p_user_ids)
+            )
+    )
+SELECT
+    fr.recipe_id,
+    fr.similarity
+FROM
+    filtered_recipes fr
+WHERE
+    fr.similarity IS NOT NULL
+ORDER BY
+    fr.similarity DESC
+    LIMIT p_limit;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS recipe_rating_weight(SMALLINT);
+DROP VIEW IF EXISTS recipe_rating_stats;
+DROP TABLE IF EXISTS recipe_ratings;
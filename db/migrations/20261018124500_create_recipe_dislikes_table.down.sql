@@ -0,0 +1,113 @@
+-- Restore recommendations that ignore dislikes and hidden recipes.
+CREATE OR REPLACE FUNCTION recommend_recipes_for_users(p_user_ids UUID[], p_limit INT, p_meal_type TEXT)
+RETURNS TABLE (
+    recipe_id UUID,
+    similarity FLOAT
+) AS $$
+BEGIN
+RETURN QUERY
+    WITH member_seeds AS (
+        -- A like counts as a top rating unless the member also rated the
+        -- recipe, in which case the rating wins.
+        SELECT
+            up.user_id,
+            l.recipe_id,
+            1.0::FLOAT AS weight
+        FROM
+            user_preferences up
+            CROSS JOIN unnest(up.recipe_ids) AS l(recipe_id)
+        WHERE
+            up.user_id = ANY(p_user_ids)
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_ratings rr
+                WHERE rr.user_id = up.user_id AND rr.recipe_id = l.recipe_id
+            )
+        UNION ALL
+        SELECT
+            rr.user_id,
+            rr.recipe_id,
+            recipe_rating_weight(rr.rating)
+        FROM
+            recipe_ratings rr
+        WHERE
+            rr.user_id = ANY(p_user_ids)
+    ),
+    seeds AS (
+        SELECT
+            ms.recipe_id,
+            AVG(ms.weight) AS weight
+        FROM
+            member_seeds ms
+        GROUP BY
+            ms.recipe_id
+    ),
+    profile AS (
+        SELECT
+            COALESCE(bool_or(up.vegetarian), false) AS vegetarian,
+            COALESCE(bool_or(up.gluten_free), false) AS gluten_free,
+            COALESCE(array_agg(DISTINCT d.name) FILTER (WHERE d.name IS NOT NULL), '{}') AS disliked,
+            COALESCE(array_agg(DISTINCT up.cuisine_preference) FILTER (WHERE up.cuisine_preference <> ''), '{}') AS cuisines
+        FROM
+            user_preferences up
+            LEFT JOIN LATERAL unnest(up.disliked_ingredients) AS d(name) ON true
+        WHERE
+            up.user_id = ANY(p_user_ids)
+    ),
+    candidate_recipes AS (
+        -- Recipes close to well-rated ones score up to their similarity;
+        -- closeness to poorly rated ones takes up to half a point away.
+        SELECT
+            rv2.recipe_id AS recipe_id,
+            COALESCE(MAX(compute_cosine_similarity(s.recipe_id, rv2.recipe_id) * s.weight) FILTER (WHERE s.weight > 0), 0)
+                - 0.5 * COALESCE(MAX(compute_cosine_similarity(s.recipe_id, rv2.recipe_id) * -s.weight) FILTER (WHERE s.weight < 0), 0)
+                AS similarity
+        FROM
+            seeds s
+            JOIN recipe_vectors rv1 ON s.recipe_id = rv1.recipe_id
+            JOIN recipe_vectors rv2 ON rv1.recipe_id <> rv2.recipe_id
+        WHERE
+            s.weight <> 0
+        GROUP BY
+            rv2.recipe_id
+    ),
+    filtered_recipes AS (
+        SELECT
+            cr.recipe_id,
+            (cr.similarity
+                - recipe_disliked_count(cr.recipe_id, p.disliked)
+                + CASE WHEN recipe_cuisine_match(cr.recipe_id, p.cuisines) THEN 0.1 ELSE 0 END)::FLOAT AS similarity
+        FROM
+            candidate_recipes cr
+            JOIN recipe_details rd ON cr.recipe_id = rd.recipe_id
+            CROSS JOIN profile p
+        WHERE
+            rd.meal_type = p_meal_type
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_diet_conflicts c
+                WHERE c.recipe_id = cr.recipe_id
+                  AND ((c.diet = 'vegetarian' AND p.vegetarian) OR (c.diet = 'gluten_free' AND p.gluten_free))
+            )
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_allergens ra
+                JOIN user_allergens ua ON ua.allergen = ra.allergen
+                WHERE ra.recipe_id = cr.recipe_id
+                  AND ua.user_id = ANY(p_user_ids)
+            )
+    )
+SELECT
+    fr.recipe_id,
+    fr.similarity
+FROM
+    filtered_recipes fr
+WHERE
+    fr.similarity IS NOT NULL
+ORDER BY
+    fr.similarity DESC
+    LIMIT p_limit;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS recipe_dislikes;
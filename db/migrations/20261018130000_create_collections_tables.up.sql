@@ -0,0 +1,22 @@
+CREATE TABLE collections (
+                             id UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+                             user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                             name VARCHAR(100) NOT NULL,
+                             description TEXT NOT NULL DEFAULT '',
+                             cover_image_url TEXT NOT NULL DEFAULT '',
+                             visibility TEXT NOT NULL DEFAULT 'private' CHECK (visibility IN ('private', 'public')),
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             CONSTRAINT unique_collection_name_per_user UNIQUE (user_id, name)
+);
+
+-- position orders the recipes within a collection, lowest first.
+CREATE TABLE collection_recipes (
+                                    collection_id UUID NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+                                    recipe_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+                                    position INT NOT NULL,
+                                    added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                    PRIMARY KEY (collection_id, recipe_id)
+);
+
+CREATE INDEX idx_collection_recipes_recipe_id ON collection_recipes (recipe_id);
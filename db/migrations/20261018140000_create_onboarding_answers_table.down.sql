@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS popular_recipes_for_users(UUID[], INT, TEXT);
+DROP TABLE IF EXISTS onboarding_answers;
@@ -0,0 +1,92 @@
+-- onboarding_answers keeps what new users said about the quiz recipes. Each
+-- answer is also applied as a like or dislike.
+CREATE TABLE onboarding_answers (
+                                    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                    recipe_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+                                    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+                                    answered_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                    PRIMARY KEY (user_id, recipe_id)
+);
+
+-- popular_recipes_for_users is the fallback for members with too little
+-- feedback for recommend_recipes_for_users. It applies the same hard
+-- filters and ranks by how well a recipe fits the merged profile, then by
+-- recent popularity and star rating.
+CREATE OR REPLACE FUNCTION popular_recipes_for_users(p_user_ids UUID[], p_limit INT, p_meal_type TEXT)
+RETURNS TABLE (
+    recipe_id UUID,
+    similarity FLOAT
+) AS $$
+BEGIN
+RETURN QUERY
+    WITH profile AS (
+        SELECT
+            COALESCE(bool_or(up.vegetarian), false) AS vegetarian,
+            COALESCE(bool_or(up.gluten_free), false) AS gluten_free,
+            COALESCE(array_agg(DISTINCT d.name) FILTER (WHERE d.name IS NOT NULL), '{}') AS disliked,
+            COALESCE(array_agg(DISTINCT up.cuisine_preference) FILTER (WHERE up.cuisine_preference <> ''), '{}') AS cuisines
+        FROM
+            user_preferences up
+            LEFT JOIN LATERAL unnest(up.disliked_ingredients) AS d(name) ON true
+        WHERE
+            up.user_id = ANY(p_user_ids)
+    ),
+    -- Regions of recipes members liked or rated well in the quiz count as a
+    -- soft cuisine preference.
+    liked_regions AS (
+        SELECT DISTINCT
+            rd2.region
+        FROM
+            onboarding_answers oa
+            JOIN recipe_details rd2 ON rd2.recipe_id = oa.recipe_id
+        WHERE
+            oa.user_id = ANY(p_user_ids)
+            AND oa.rating >= 4
+            AND rd2.region IS NOT NULL
+    ),
+    scored AS (
+        SELECT
+            rd.recipe_id AS recipe_id,
+            (CASE WHEN recipe_cuisine_match(rd.recipe_id, p.cuisines) THEN 0.3 ELSE 0 END
+                + CASE WHEN rd.region IN (SELECT lr.region FROM liked_regions lr) THEN 0.2 ELSE 0 END
+                - recipe_disliked_count(rd.recipe_id, p.disliked)
+                + LEAST(COALESCE(pop.score, 0), 100) / 500.0
+                + COALESCE(rs.average_rating, 0) / 50.0)::FLOAT AS similarity
+        FROM
+            recipe_details rd
+            CROSS JOIN profile p
+            LEFT JOIN recipe_popularity pop ON pop.recipe_id = rd.recipe_id
+            LEFT JOIN recipe_rating_stats rs ON rs.recipe_id = rd.recipe_id
+        WHERE
+            rd.meal_type = p_meal_type
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_diet_conflicts c
+                WHERE c.recipe_id = rd.recipe_id
+                  AND ((c.diet = 'vegetarian' AND p.vegetarian) OR (c.diet = 'gluten_free' AND p.gluten_free))
+            )
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_dislikes dl
+                WHERE dl.recipe_id = rd.recipe_id
+                  AND dl.user_id = ANY(p_user_ids)
+            )
+            AND NOT EXISTS (
+                SELECT 1
+                FROM recipe_allergens ra
+                JOIN user_allergens ua ON ua.allergen = ra.allergen
+                WHERE ra.recipe_id = rd.recipe_id
+                  AND ua.user_id = ANY(p_user_ids)
+            )
+    )
+SELECT
+    s.recipe_id,
+    s.similarity
+FROM
+    scored s
+ORDER BY
+    s.similarity DESC,
+    random()
+    LIMIT p_limit;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS recipe_revisions;
+DROP FUNCTION IF EXISTS reject_recipe_revision_update();
+DROP FUNCTION IF EXISTS recipe_snapshot(UUID);
@@ -0,0 +1,69 @@
+-- recipe_snapshot is the editable state of a recipe as stored in a revision.
+-- Ingredients are sorted bytewise so equal recipes give equal snapshots.
+CREATE OR REPLACE FUNCTION recipe_snapshot(p_recipe_id UUID)
+RETURNS JSONB AS $$
+SELECT jsonb_build_object(
+           'name', r.name,
+           'description', COALESCE(r.description, ''),
+           'cooking_time', COALESCE(r.cooking_time, ''),
+           'instructions', to_jsonb(r.instructions),
+           'img_url', COALESCE(r.img_url, ''),
+           'ingredients', COALESCE((
+               SELECT jsonb_agg(jsonb_build_object('name', i.name, 'quantity', COALESCE(ri.quantity, ''))
+                                ORDER BY i.name COLLATE "C")
+               FROM recipe_ingredients ri
+               JOIN ingredients i ON i.id = ri.ingredient_id
+               WHERE ri.recipe_id = r.id
+           ), '[]'::jsonb),
+           'details', jsonb_build_object(
+               'meal_type', COALESCE(rd.meal_type, ''),
+               'food_class', COALESCE(rd.food_class, ''),
+               'region', COALESCE(rd.region, ''),
+               'spiciness_level', COALESCE(rd.spiciness_level, ''),
+               'main_ingredients', COALESCE(rd.main_ingredients, ''),
+               'cooking_method', COALESCE(rd.cooking_method, ''),
+               'description', COALESCE(rd.description, '')
+           )
+       )
+FROM recipes r
+LEFT JOIN recipe_details rd ON rd.recipe_id = r.id
+WHERE r.id = p_recipe_id;
+$$ LANGUAGE sql STABLE;
+
+-- recipe_revisions holds a snapshot of a recipe after every change. editor_id
+-- is NULL for crawler imports and for editors whose account was deleted.
+CREATE TABLE recipe_revisions (
+                                  recipe_id UUID NOT NULL REFERENCES recipes(id) ON DELETE CASCADE,
+                                  revision INT NOT NULL CHECK (revision > 0),
+                                  editor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+                                  source TEXT NOT NULL CHECK (source IN ('import', 'create', 'edit', 'revert', 'crawler')),
+                                  note TEXT NOT NULL DEFAULT '',
+                                  snapshot JSONB NOT NULL,
+                                  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  PRIMARY KEY (recipe_id, revision)
+);
+
+CREATE INDEX idx_recipe_revisions_editor_id ON recipe_revisions (editor_id);
+
+-- Revisions are immutable. The only update allowed is the ON DELETE SET NULL
+-- that forgets a deleted editor.
+CREATE OR REPLACE FUNCTION reject_recipe_revision_update()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.editor_id IS NULL
+        AND (NEW.recipe_id, NEW.revision, NEW.source, NEW.note, NEW.snapshot, NEW.created_at)
+            IS NOT DISTINCT FROM (OLD.recipe_id, OLD.revision, OLD.source, OLD.note, OLD.snapshot, OLD.created_at) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'recipe_revisions is immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER recipe_revisions_immutable
+    BEFORE UPDATE ON recipe_revisions
+    FOR EACH ROW EXECUTE FUNCTION reject_recipe_revision_update();
+
+-- Existing recipes start their history at the state they are in now.
+INSERT INTO recipe_revisions (recipe_id, revision, source, note, snapshot, created_at)
+SELECT r.id, 1, 'import', 'Recipe as it was when revision history started', recipe_snapshot(r.id), r.updated_at
+FROM recipes r;
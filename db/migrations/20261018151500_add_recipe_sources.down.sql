@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS recipes_source_url_key;
+ALTER TABLE recipes
+    DROP COLUMN IF EXISTS source_snapshot,
+    DROP COLUMN IF EXISTS source_url;
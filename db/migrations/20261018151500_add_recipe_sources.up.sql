@@ -0,0 +1,23 @@
+-- Crawled recipes are matched on re-import by the page they came from, so a
+-- recipe an editor renamed is not imported again as a duplicate.
+-- source_snapshot is the recipe as the source last had it, the base each
+-- re-import is merged against so only fields the source changed are
+-- applied.
+ALTER TABLE recipes
+    ADD COLUMN source_url TEXT,
+    ADD COLUMN source_snapshot JSONB;
+
+CREATE UNIQUE INDEX recipes_source_url_key ON recipes (source_url) WHERE source_url IS NOT NULL;
+
+-- Recipes imported before this have no URL yet. Their base is the last
+-- crawler revision, or the revision recorded when revisions were added;
+-- the next crawl finds them by name and records their URL.
+UPDATE recipes r
+SET source_snapshot = rv.snapshot
+FROM (
+    SELECT DISTINCT ON (recipe_id) recipe_id, snapshot
+    FROM recipe_revisions
+    WHERE source IN ('crawler', 'import')
+    ORDER BY recipe_id, source = 'crawler' DESC, revision DESC
+) rv
+WHERE rv.recipe_id = r.id;
@@ -0,0 +1,5 @@
+ALTER TABLE recipe_ingredients
+    DROP COLUMN IF EXISTS amount,
+    DROP COLUMN IF EXISTS amount_max,
+    DROP COLUMN IF EXISTS unit,
+    DROP COLUMN IF EXISTS note;
@@ -0,0 +1,8 @@
+-- The parsed form of recipe_ingredients.quantity, which is kept as written.
+-- note is NULL until a row has been parsed; POST /recipes/quantities/reparse
+-- fills in older rows.
+ALTER TABLE recipe_ingredients
+    ADD COLUMN amount NUMERIC,
+    ADD COLUMN amount_max NUMERIC,
+    ADD COLUMN unit TEXT,
+    ADD COLUMN note TEXT;
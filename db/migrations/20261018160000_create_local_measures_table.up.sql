@@ -0,0 +1,41 @@
+-- local_measures holds what the containers of Nigerian open markets hold
+-- for each kind of ingredient, since a derica of garri weighs much less than
+-- a derica of beans. Ingredients match a kind by name with pattern, a case
+-- insensitive regular expression; the longest matching pattern wins. Sizes
+-- vary between markets, so these are typical values.
+CREATE TABLE local_measures (
+                                ingredient_type TEXT NOT NULL,
+                                pattern TEXT NOT NULL,
+                                unit TEXT NOT NULL CHECK (unit IN ('derica', 'mudu', 'congo', 'paint bucket', 'garri cup')),
+                                grams NUMERIC CHECK (grams > 0),
+                                millilitres NUMERIC CHECK (millilitres > 0),
+                                PRIMARY KEY (ingredient_type, unit),
+                                CHECK (grams IS NOT NULL OR millilitres IS NOT NULL)
+);
+
+INSERT INTO local_measures (ingredient_type, pattern, unit, grams, millilitres) VALUES
+    ('rice', '\mrice\M', 'derica', 550, 650),
+    ('rice', '\mrice\M', 'mudu', 1500, 1750),
+    ('rice', '\mrice\M', 'congo', 1700, 2000),
+    ('rice', '\mrice\M', 'paint bucket', 3400, 4000),
+    ('beans', '\m(beans?|cowpeas?)\M', 'derica', 500, 650),
+    ('beans', '\m(beans?|cowpeas?)\M', 'mudu', 1350, 1750),
+    ('beans', '\m(beans?|cowpeas?)\M', 'congo', 1540, 2000),
+    ('beans', '\m(beans?|cowpeas?)\M', 'paint bucket', 3080, 4000),
+    ('garri', '\mgarr?i\M', 'derica', 390, 650),
+    ('garri', '\mgarr?i\M', 'mudu', 1050, 1750),
+    ('garri', '\mgarr?i\M', 'congo', 1200, 2000),
+    ('garri', '\mgarr?i\M', 'paint bucket', 2400, 4000),
+    ('garri', '\mgarr?i\M', 'garri cup', 240, 400),
+    ('maize', '\m(maize|corn)\M', 'derica', 470, 650),
+    ('maize', '\m(maize|corn)\M', 'mudu', 1260, 1750),
+    ('maize', '\m(maize|corn)\M', 'congo', 1440, 2000),
+    ('maize', '\m(maize|corn)\M', 'paint bucket', 2880, 4000),
+    ('egusi', '\megusi\M', 'derica', 290, 650),
+    ('egusi', '\megusi\M', 'mudu', 790, 1750),
+    ('crayfish', '\mcrayfish\M', 'derica', 230, 650);
+
+-- Rows that mention market units were parsed before the parser knew them.
+UPDATE recipe_ingredients
+SET amount = NULL, amount_max = NULL, unit = NULL, note = NULL
+WHERE quantity ~* '(derica|mudu|modu|congo|paint (bucket|rubber)|cups? of garr?i)';
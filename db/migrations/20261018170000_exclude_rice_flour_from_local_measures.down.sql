@@ -0,0 +1,3 @@
+UPDATE local_measures
+SET pattern = '\mrice\M'
+WHERE ingredient_type = 'rice';
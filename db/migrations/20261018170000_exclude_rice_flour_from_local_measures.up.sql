@@ -0,0 +1,5 @@
+-- Rice flour and ground rice are not sold by the derica like grains of rice,
+-- so the rice measures must not match them.
+UPDATE local_measures
+SET pattern = '^(?!.*\m(flour|ground)\M).*\mrice\M'
+WHERE ingredient_type = 'rice';
@@ -0,0 +1,2 @@
+ALTER TABLE local_measures
+    DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,17 @@
+-- An ingredient can match several kinds, such as "rice and beans". The kind
+-- with the highest priority wins, replacing the length of the pattern,
+-- which changes whenever a pattern is tightened. These priorities keep the
+-- order the original patterns gave.
+ALTER TABLE local_measures
+    ADD COLUMN priority INT NOT NULL DEFAULT 0;
+
+UPDATE local_measures
+SET priority = CASE ingredient_type
+    WHEN 'beans' THEN 60
+    WHEN 'maize' THEN 50
+    WHEN 'crayfish' THEN 40
+    WHEN 'egusi' THEN 30
+    WHEN 'garri' THEN 20
+    WHEN 'rice' THEN 10
+    ELSE 0
+END;
@@ -19,6 +19,7 @@ require (
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/crypto v0.21.0
 	gonum.org/v1/gonum v0.9.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -11,6 +11,7 @@ var (
 	ErrEmailExists         = New("email address is already registered")
 	ErrUnknownLogin        = New("email not registered")
 	ErrInvalidPassword     = New("invalid password", http.StatusUnauthorized)
+	ErrInvalidCredentials  = New("invalid credentials", http.StatusUnauthorized)
 	ErrIncompleteParams    = New("incomplete parameters")
 	ErrServiceNotSupported = New("service not supported", http.StatusServiceUnavailable)
 	ErrServiceUnavailable  = New("service unavailable", http.StatusServiceUnavailable)
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"net/url"
@@ -59,6 +60,27 @@ func NewPagination(page, pageSize, totalItems int) *Pagination {
 	}
 }
 
+// ParseID parses a path ID. Malformed IDs are rejected with a 400 before
+// they reach Postgres, which would otherwise fail the query with an error
+// reported as a 500.
+func ParseID(id string) (uuid.UUID, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, errors.New("Invalid ID: "+id, http.StatusBadRequest)
+	}
+	return parsed, nil
+}
+
+// ValidIDs checks several path IDs with ParseID.
+func ValidIDs(ids ...string) error {
+	for _, id := range ids {
+		if _, err := ParseID(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ApplyPagination applies pagination to a SQL query
 func ApplyPagination(query string, page, pageSize int) string {
 	offset := (page - 1) * pageSize
@@ -88,6 +88,7 @@ func (c *Client) FetchRecipe(ctx context.Context, url string) (*model.RequestDat
 	)
 
 	recipe.Description = recipe.Name
+	recipe.SourceURL = c.GetBaseURL() + url
 	if err != nil {
 		log.Fatalf("Failed to extract recipe details: %v", err)
 	}
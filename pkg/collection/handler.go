@@ -0,0 +1,157 @@
+package collection
+
+import (
+	"Food/pkg"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+func (h Handler) list(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	collections, err := h.svc.list(r.Context(), chi.URLParam(r, "id"), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    collections,
+		Message: "Collections retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) get(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	collection, err := h.svc.get(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "collectionId"), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    collection,
+		Message: "Collection retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	collection, err := h.svc.create(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    collection,
+		Message: "Collection created successfully",
+		Code:    http.StatusCreated,
+	})
+}
+
+func (h Handler) update(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	collection, err := h.svc.update(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "collectionId"), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    collection,
+		Message: "Collection updated successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) delete(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	collectionID, err := h.svc.delete(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "collectionId"), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    collectionID,
+		Message: "Collection deleted successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) addRecipes(w http.ResponseWriter, r *http.Request) {
+	var req RecipesRequest
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	collection, err := h.svc.addRecipes(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "collectionId"), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    collection,
+		Message: "Recipes added to collection successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) removeRecipe(w http.ResponseWriter, r *http.Request) {
+	collection, err := h.svc.removeRecipe(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "collectionId"), chi.URLParam(r, "recipeId"))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    collection,
+		Message: "Recipe removed from collection successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) reorder(w http.ResponseWriter, r *http.Request) {
+	var req RecipesRequest
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	collection, err := h.svc.reorder(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "collectionId"), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    collection,
+		Message: "Collection reordered successfully",
+		Code:    http.StatusOK,
+	})
+}
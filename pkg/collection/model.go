@@ -0,0 +1,30 @@
+package collection
+
+import "time"
+
+const (
+	VisibilityPrivate = "private"
+	VisibilityPublic  = "public"
+)
+
+// Collection is a named, ordered set of recipes, like a personal cookbook.
+type Collection struct {
+	ID            string    `json:"id" db:"id"`
+	UserID        string    `json:"user_id" db:"user_id"`
+	Name          string    `json:"name" db:"name"`
+	Description   string    `json:"description" db:"description"`
+	CoverImageURL string    `json:"cover_image_url" db:"cover_image_url"`
+	Visibility    string    `json:"visibility" db:"visibility"`
+	RecipeCount   int       `json:"recipe_count" db:"recipe_count"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+	Recipes       []Recipe  `json:"recipes,omitempty" db:"-"`
+}
+
+type Recipe struct {
+	ID       string    `json:"id" db:"id"`
+	Name     string    `json:"name" db:"name"`
+	ImgUrl   string    `json:"img_url" db:"img_url"`
+	Position int       `json:"position" db:"position"`
+	AddedAt  time.Time `json:"added_at" db:"added_at"`
+}
@@ -0,0 +1,309 @@
+package collection
+
+import (
+	liberror "Food/internal/errors"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+	return &Repository{db: db}
+}
+
+const selectCollection = `
+	SELECT c.id, c.user_id, c.name, c.description, c.cover_image_url, c.visibility,
+		(SELECT COUNT(*) FROM collection_recipes cr WHERE cr.collection_id = c.id) AS recipe_count,
+		c.created_at, c.updated_at
+	FROM collections c`
+
+// list returns the owner's collections, only the public ones when
+// publicOnly is set.
+func (r *Repository) list(ctx context.Context, ownerID string, publicOnly bool) ([]Collection, error) {
+	collections := []Collection{}
+	err := r.db.SelectContext(ctx, &collections, selectCollection+`
+		WHERE c.user_id = $1 AND (NOT $2 OR c.visibility = 'public')
+		ORDER BY c.name`, ownerID, publicOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to list collections")
+	}
+	return collections, nil
+}
+
+func (r *Repository) get(ctx context.Context, ownerID, collectionID string, publicOnly bool) (*Collection, error) {
+	var collection Collection
+	err := r.db.GetContext(ctx, &collection, selectCollection+`
+		WHERE c.id = $1 AND c.user_id = $2 AND (NOT $3 OR c.visibility = 'public')`, collectionID, ownerID, publicOnly)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, liberror.New("Collection not found", http.StatusNotFound)
+		}
+		return nil, errors.Wrap(err, "GetContext: failed to get collection")
+	}
+
+	collection.Recipes = []Recipe{}
+	err = r.db.SelectContext(ctx, &collection.Recipes, `
+		SELECT r.id, r.name, r.img_url, cr.position, cr.added_at
+		FROM collection_recipes cr
+		JOIN recipes r ON r.id = cr.recipe_id
+		WHERE cr.collection_id = $1
+		ORDER BY cr.position, cr.added_at`, collectionID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get collection recipes")
+	}
+
+	return &collection, nil
+}
+
+func (r *Repository) create(ctx context.Context, ownerID string, data Request) (string, error) {
+	var id string
+	err := r.db.GetContext(ctx, &id, `
+		INSERT INTO collections (user_id, name, description, cover_image_url, visibility)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, name) DO NOTHING
+		RETURNING id`, ownerID, data.Name, data.Description, data.CoverImageURL, data.Visibility)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", liberror.New("You already have a collection with this name", http.StatusConflict)
+		}
+		return "", errors.Wrap(err, "GetContext: failed to create collection")
+	}
+	return id, nil
+}
+
+func (r *Repository) update(ctx context.Context, ownerID, collectionID string, data Request) error {
+	var taken bool
+	err := r.db.GetContext(ctx, &taken, `
+		SELECT EXISTS (SELECT 1 FROM collections WHERE user_id = $1 AND name = $2 AND id <> $3)`,
+		ownerID, data.Name, collectionID)
+	if err != nil {
+		return errors.Wrap(err, "GetContext: failed to check collection name")
+	}
+	if taken {
+		return liberror.New("You already have a collection with this name", http.StatusConflict)
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE collections
+		SET name = $3, description = $4, cover_image_url = $5, visibility = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2`,
+		collectionID, ownerID, data.Name, data.Description, data.CoverImageURL, data.Visibility)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to update collection")
+	}
+	return expectOne(res)
+}
+
+func (r *Repository) delete(ctx context.Context, ownerID, collectionID string) (string, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM collections WHERE id = $1 AND user_id = $2`, collectionID, ownerID)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to delete collection")
+	}
+	return collectionID, expectOne(res)
+}
+
+// addRecipes appends recipes to the end of the collection in the given
+// order. Recipes already in it keep their place. Every ID must name an
+// existing recipe or nothing is added.
+func (r *Repository) addRecipes(ctx context.Context, ownerID, collectionID string, recipeIDs []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	if err = lockCollection(ctx, tx, ownerID, collectionID); err != nil {
+		return err
+	}
+
+	var unknown []string
+	err = tx.SelectContext(ctx, &unknown, `
+		SELECT id::text
+		FROM unnest($1::uuid[]) AS ids(id)
+		WHERE NOT EXISTS (SELECT 1 FROM recipes r WHERE r.id = ids.id)`, pq.Array(recipeIDs))
+	if err != nil {
+		return errors.Wrap(err, "SelectContext: failed to check recipe IDs")
+	}
+	if len(unknown) > 0 {
+		err = liberror.New("Unknown recipes: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+		return err
+	}
+
+	var total int
+	err = tx.GetContext(ctx, &total, `
+		SELECT COUNT(*)
+		FROM (
+			SELECT recipe_id FROM collection_recipes WHERE collection_id = $1
+			UNION
+			SELECT unnest($2::uuid[])
+		) AS members`, collectionID, pq.Array(recipeIDs))
+	if err != nil {
+		return errors.Wrap(err, "GetContext: failed to count collection recipes")
+	}
+	if total > maxRecipes {
+		err = liberror.New(fmt.Sprintf("A collection can hold at most %d recipes", maxRecipes), http.StatusBadRequest)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO collection_recipes (collection_id, recipe_id, position)
+		SELECT $1, ids.id,
+			COALESCE((SELECT MAX(position) FROM collection_recipes WHERE collection_id = $1), -1) + ROW_NUMBER() OVER (ORDER BY ids.n)
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS ids(id, n)
+		WHERE NOT EXISTS (SELECT 1 FROM collection_recipes cr WHERE cr.collection_id = $1 AND cr.recipe_id = ids.id)
+		ON CONFLICT (collection_id, recipe_id) DO NOTHING`, collectionID, pq.Array(recipeIDs))
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to add recipes to collection")
+	}
+
+	err = touch(ctx, tx, collectionID)
+	return err
+}
+
+func (r *Repository) removeRecipe(ctx context.Context, ownerID, collectionID, recipeID string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	if err = lockCollection(ctx, tx, ownerID, collectionID); err != nil {
+		return err
+	}
+
+	var position int
+	err = tx.GetContext(ctx, &position, `
+		DELETE FROM collection_recipes
+		WHERE collection_id = $1 AND recipe_id = $2
+		RETURNING position`, collectionID, recipeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = liberror.New("Recipe is not in this collection", http.StatusNotFound)
+			return err
+		}
+		return errors.Wrap(err, "GetContext: failed to remove recipe from collection")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE collection_recipes SET position = position - 1
+		WHERE collection_id = $1 AND position > $2`, collectionID, position)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to close position gap")
+	}
+
+	err = touch(ctx, tx, collectionID)
+	return err
+}
+
+// reorder sets the order of the collection's recipes. recipeIDs must list
+// every recipe in the collection exactly once.
+func (r *Repository) reorder(ctx context.Context, ownerID, collectionID string, recipeIDs []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	if err = lockCollection(ctx, tx, ownerID, collectionID); err != nil {
+		return err
+	}
+
+	var mismatched int
+	err = tx.GetContext(ctx, &mismatched, `
+		SELECT COUNT(*)
+		FROM (SELECT recipe_id FROM collection_recipes WHERE collection_id = $1) AS members
+		FULL JOIN unnest($2::uuid[]) AS ids(id) ON ids.id = members.recipe_id
+		WHERE members.recipe_id IS NULL OR ids.id IS NULL`, collectionID, pq.Array(recipeIDs))
+	if err != nil {
+		return errors.Wrap(err, "GetContext: failed to compare collection recipes")
+	}
+	if mismatched > 0 {
+		err = liberror.New("recipe_ids must list every recipe in the collection exactly once", http.StatusBadRequest)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE collection_recipes cr
+		SET position = ids.n - 1
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS ids(id, n)
+		WHERE cr.collection_id = $1 AND cr.recipe_id = ids.id`, collectionID, pq.Array(recipeIDs))
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to reorder collection")
+	}
+
+	err = touch(ctx, tx, collectionID)
+	return err
+}
+
+// lockCollection serialises membership changes to one collection and checks
+// that ownerID owns it.
+func lockCollection(ctx context.Context, tx *sqlx.Tx, ownerID, collectionID string) error {
+	var id string
+	err := tx.GetContext(ctx, &id, `
+		SELECT id FROM collections WHERE id = $1 AND user_id = $2 FOR UPDATE`, collectionID, ownerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return liberror.New("Collection not found", http.StatusNotFound)
+		}
+		return errors.Wrap(err, "GetContext: failed to lock collection")
+	}
+	return nil
+}
+
+func touch(ctx context.Context, tx *sqlx.Tx, collectionID string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE collections SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, collectionID)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to touch collection")
+	}
+	return nil
+}
+
+func expectOne(res sql.Result) error {
+	count, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+	if count == 0 {
+		return liberror.New("Collection not found", http.StatusNotFound)
+	}
+	return nil
+}
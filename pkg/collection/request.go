@@ -0,0 +1,104 @@
+package collection
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/google/uuid"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxRecipes caps the size of a collection.
+const maxRecipes = 500
+
+// Request creates a collection or replaces its details; omitted fields are
+// reset.
+type Request struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	CoverImageURL string `json:"cover_image_url"`
+	Visibility    string `json:"visibility"`
+}
+
+func (v *Request) Bind(r *http.Request) error {
+	v.Name = strings.TrimSpace(v.Name)
+	v.Description = strings.TrimSpace(v.Description)
+	v.CoverImageURL = strings.TrimSpace(v.CoverImageURL)
+	v.Visibility = strings.TrimSpace(strings.ToLower(v.Visibility))
+	if v.Visibility == "" {
+		v.Visibility = VisibilityPrivate
+	}
+
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "name", Field: v.Name, Message: fmt.Sprintf("%v is missing", "name")},
+		&validators.StringLengthInRange{Name: "name", Field: v.Name, Max: 100, Message: fmt.Sprintf("%v must be at most 100 characters", "name")},
+		&validators.StringLengthInRange{Name: "description", Field: v.Description, Max: 1000, Message: fmt.Sprintf("%v must be at most 1000 characters", "description")},
+		&validators.FuncValidator{
+			Name:    "cover_image_url",
+			Field:   "cover_image_url",
+			Message: "%s must be an http or https URL",
+			Fn: func() bool {
+				if v.CoverImageURL == "" {
+					return true
+				}
+				parsed, err := url.Parse(v.CoverImageURL)
+				return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" && len(v.CoverImageURL) <= 2048
+			},
+		},
+		&validators.FuncValidator{
+			Name:    "visibility",
+			Field:   "visibility",
+			Message: "%s must be one of private or public",
+			Fn: func() bool {
+				return v.Visibility == VisibilityPrivate || v.Visibility == VisibilityPublic
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+// RecipesRequest lists recipe IDs to add to a collection, or the complete
+// new order of its recipes.
+type RecipesRequest struct {
+	RecipeIDs []string `json:"recipe_ids"`
+}
+
+func (v *RecipesRequest) Bind(r *http.Request) error {
+	seen := make(map[string]bool, len(v.RecipeIDs))
+	ids := make([]string, 0, len(v.RecipeIDs))
+	valid := true
+	for _, id := range v.RecipeIDs {
+		parsed, err := uuid.Parse(strings.TrimSpace(id))
+		if err != nil {
+			valid = false
+			continue
+		}
+		if id = parsed.String(); !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	v.RecipeIDs = ids
+
+	err1 := validate.Validate(
+		&validators.FuncValidator{
+			Name:    "recipe_ids",
+			Field:   "recipe_ids",
+			Message: fmt.Sprintf("%%s must list between 1 and %d valid recipe IDs", maxRecipes),
+			Fn: func() bool {
+				return valid && len(v.RecipeIDs) > 0 && len(v.RecipeIDs) <= maxRecipes
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
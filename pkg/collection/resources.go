@@ -0,0 +1,47 @@
+package collection
+
+import (
+	"Food/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db    *sqlx.DB
+	authn *auth.Authenticator
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, authn *auth.Authenticator) *Resource {
+	return &Resource{
+		db:    db,
+		authn: authn,
+	}
+}
+
+// Router serves /users/{id}/collections. Anyone signed in can read a user's
+// public collections; only the owner can change them, though admins may
+// delete any.
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	repo := NewRepository(rs.db)
+	svc := NewService(repo)
+	hndlr := NewHandler(svc)
+
+	r.Use(rs.authn.MustAuthMiddleware)
+	r.Get("/", hndlr.list)
+	r.Get("/{collectionId}", hndlr.get)
+	r.With(auth.RequireRoleOrOwner("id", auth.RoleAdmin), auth.RequireWriteScope).Delete("/{collectionId}", hndlr.delete)
+
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireRoleOrOwner("id"), auth.RequireWriteScope)
+		r.Post("/", hndlr.create)
+		r.Put("/{collectionId}", hndlr.update)
+		r.Post("/{collectionId}/recipes", hndlr.addRecipes)
+		r.Put("/{collectionId}/recipes", hndlr.reorder)
+		r.Delete("/{collectionId}/recipes/{recipeId}", hndlr.removeRecipe)
+	})
+
+	return r
+}
@@ -0,0 +1,119 @@
+package collection
+
+import (
+	"Food/auth"
+	liberror "Food/internal/errors"
+	"Food/pkg"
+	"context"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// publicOnly reports whether userID may only see ownerID's public
+// collections. Owners and admins see private ones too.
+func publicOnly(ctx context.Context, ownerID, userID string) bool {
+	return ownerID != userID && auth.RoleFromContext(ctx) != auth.RoleAdmin
+}
+
+func (s Service) list(ctx context.Context, ownerID, userID string) ([]Collection, error) {
+	if err := pkg.ValidIDs(ownerID); err != nil {
+		return nil, err
+	}
+
+	collections, err := s.repo.list(ctx, ownerID, publicOnly(ctx, ownerID, userID))
+	return collections, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("collection.list", "collection.list", userID, log.Fields{"owner_id": ownerID}).WithError(err))
+}
+
+func (s Service) get(ctx context.Context, ownerID, collectionID, userID string) (*Collection, error) {
+	if err := pkg.ValidIDs(ownerID, collectionID); err != nil {
+		return nil, err
+	}
+
+	collection, err := s.repo.get(ctx, ownerID, collectionID, publicOnly(ctx, ownerID, userID))
+	return collection, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("collection.get", "collection.get", userID, log.Fields{"collection_id": collectionID}).WithError(err))
+}
+
+func (s Service) create(ctx context.Context, ownerID string, req Request) (*Collection, error) {
+	id, err := s.repo.create(ctx, ownerID, req)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("collection.create", "collection.create", ownerID).WithError(err))
+	}
+	return s.get(ctx, ownerID, id, ownerID)
+}
+
+func (s Service) update(ctx context.Context, ownerID, collectionID string, req Request) (*Collection, error) {
+	if err := pkg.ValidIDs(collectionID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.update(ctx, ownerID, collectionID, req); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("collection.update", "collection.update", ownerID, log.Fields{"collection_id": collectionID}).WithError(err))
+	}
+	return s.get(ctx, ownerID, collectionID, ownerID)
+}
+
+func (s Service) delete(ctx context.Context, ownerID, collectionID, userID string) (string, error) {
+	if err := pkg.ValidIDs(collectionID); err != nil {
+		return "", err
+	}
+
+	resp, err := s.repo.delete(ctx, ownerID, collectionID)
+	return resp, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("collection.delete", "collection.delete", userID, log.Fields{"collection_id": collectionID}).WithError(err))
+}
+
+func (s Service) addRecipes(ctx context.Context, ownerID, collectionID string, req RecipesRequest) (*Collection, error) {
+	if err := pkg.ValidIDs(collectionID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.addRecipes(ctx, ownerID, collectionID, req.RecipeIDs); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("collection.addRecipes", "collection.addRecipes", ownerID, log.Fields{"collection_id": collectionID}).WithError(err))
+	}
+	return s.get(ctx, ownerID, collectionID, ownerID)
+}
+
+func (s Service) removeRecipe(ctx context.Context, ownerID, collectionID, recipeID string) (*Collection, error) {
+	if err := pkg.ValidIDs(collectionID, recipeID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.removeRecipe(ctx, ownerID, collectionID, recipeID); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("collection.removeRecipe", "collection.removeRecipe", ownerID, log.Fields{"collection_id": collectionID, "recipe_id": recipeID}).WithError(err))
+	}
+	return s.get(ctx, ownerID, collectionID, ownerID)
+}
+
+func (s Service) reorder(ctx context.Context, ownerID, collectionID string, req RecipesRequest) (*Collection, error) {
+	if err := pkg.ValidIDs(collectionID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.reorder(ctx, ownerID, collectionID, req.RecipeIDs); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("collection.reorder", "collection.reorder", ownerID, log.Fields{"collection_id": collectionID}).WithError(err))
+	}
+	return s.get(ctx, ownerID, collectionID, ownerID)
+}
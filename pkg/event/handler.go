@@ -0,0 +1,55 @@
+package event
+
+import (
+	"Food/pkg"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+func (h Handler) ingest(w http.ResponseWriter, r *http.Request) {
+	var req IngestRequest
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	result, err := h.svc.ingest(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    result,
+		Message: "Events recorded successfully",
+		Code:    http.StatusAccepted,
+	})
+}
+
+func (h Handler) history(w http.ResponseWriter, r *http.Request) {
+	items, pagination, err := h.svc.history(r.Context(), chi.URLParam(r, "id"), r.URL.Query())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data: map[string]interface{}{
+			"recipes":    items,
+			"pagination": pagination,
+		},
+		Message: "History retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
@@ -0,0 +1,37 @@
+package event
+
+import "time"
+
+const (
+	TypeView  = "view"
+	TypeCook  = "cook"
+	TypeShare = "share"
+	TypePrint = "print"
+)
+
+// ValidType reports whether t is one of the recorded event types.
+func ValidType(t string) bool {
+	switch t {
+	case TypeView, TypeCook, TypeShare, TypePrint:
+		return true
+	}
+	return false
+}
+
+// IngestResult says what became of a batch. Duplicates are events whose
+// client_event_id was already recorded; skipped events name recipes that no
+// longer exist.
+type IngestResult struct {
+	Accepted   int `json:"accepted"`
+	Duplicates int `json:"duplicates"`
+	Skipped    int `json:"skipped"`
+}
+
+// HistoryItem summarises one user's events of one type on a recipe.
+type HistoryItem struct {
+	RecipeID string    `json:"recipe_id" db:"recipe_id"`
+	Name     string    `json:"name" db:"name"`
+	ImgUrl   string    `json:"img_url" db:"img_url"`
+	Count    int       `json:"count" db:"count"`
+	LastAt   time.Time `json:"last_at" db:"last_at"`
+}
@@ -0,0 +1,94 @@
+package event
+
+import (
+	"Food/pkg"
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// ingest appends a batch of events in one statement. Events for missing
+// recipes are skipped rather than failing the batch, since a client may
+// have queued them before the recipe was deleted.
+func (r *Repository) ingest(ctx context.Context, userID string, events []Event) (*IngestResult, error) {
+	recipeIDs := make([]string, len(events))
+	types := make([]string, len(events))
+	occurredAt := make([]string, len(events))
+	clientIDs := make([]string, len(events))
+	for i, e := range events {
+		recipeIDs[i] = e.RecipeID
+		types[i] = e.Type
+		occurredAt[i] = e.OccurredAt.Format("2006-01-02 15:04:05.999999")
+		clientIDs[i] = e.ClientEventID
+	}
+
+	var skipped int
+	err := r.db.GetContext(ctx, &skipped, `
+		SELECT COUNT(*)
+		FROM unnest($1::uuid[]) AS ids(id)
+		WHERE NOT EXISTS (SELECT 1 FROM recipes r WHERE r.id = ids.id)`, pq.Array(recipeIDs))
+	if err != nil {
+		return nil, errors.Wrap(err, "GetContext: failed to check recipe IDs")
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO recipe_events (user_id, recipe_id, type, occurred_at, client_event_id)
+		SELECT $1, e.recipe_id, e.type, e.occurred_at, NULLIF(e.client_event_id, '')
+		FROM unnest($2::uuid[], $3::text[], $4::timestamp[], $5::text[]) AS e(recipe_id, type, occurred_at, client_event_id)
+		WHERE EXISTS (SELECT 1 FROM recipes r WHERE r.id = e.recipe_id)
+		ON CONFLICT (user_id, client_event_id) DO NOTHING`,
+		userID, pq.Array(recipeIDs), pq.Array(types), pq.Array(occurredAt), pq.Array(clientIDs))
+	if err != nil {
+		return nil, errors.Wrap(err, "ExecContext: failed to insert recipe events")
+	}
+	accepted, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+
+	return &IngestResult{
+		Accepted:   int(accepted),
+		Duplicates: len(events) - skipped - int(accepted),
+		Skipped:    skipped,
+	}, nil
+}
+
+// history lists the recipes the user has events of eventType on, most
+// recent first or, with byCount, most frequent first.
+func (r *Repository) history(ctx context.Context, userID, eventType string, byCount bool, page, pageSize int) ([]HistoryItem, *pkg.Pagination, error) {
+	var totalItems int
+	err := r.db.GetContext(ctx, &totalItems, `
+		SELECT COUNT(DISTINCT recipe_id) FROM recipe_events WHERE user_id = $1 AND type = $2`, userID, eventType)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "GetContext: failed to count history")
+	}
+
+	order := "last_at DESC"
+	if byCount {
+		order = "count DESC, last_at DESC"
+	}
+
+	items := []HistoryItem{}
+	err = r.db.SelectContext(ctx, &items, `
+		SELECT e.recipe_id, r.name, r.img_url, COUNT(*) AS count, MAX(e.occurred_at) AS last_at
+		FROM recipe_events e
+		JOIN recipes r ON r.id = e.recipe_id
+		WHERE e.user_id = $1 AND e.type = $2
+		GROUP BY e.recipe_id, r.name, r.img_url
+		ORDER BY `+order+`
+		LIMIT $3 OFFSET $4`, userID, eventType, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "SelectContext: failed to get history")
+	}
+
+	return items, pkg.NewPagination(page, pageSize, totalItems), nil
+}
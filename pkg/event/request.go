@@ -0,0 +1,81 @@
+package event
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	maxBatchSize = 100
+	// maxClockSkew is how far ahead of the server a client's clock may run.
+	maxClockSkew = 5 * time.Minute
+)
+
+type Event struct {
+	RecipeID string `json:"recipe_id"`
+	Type     string `json:"type"`
+	// OccurredAt defaults to the time the event is received. Clients that
+	// queue events offline should set it.
+	OccurredAt *time.Time `json:"occurred_at"`
+	// ClientEventID is an optional identifier, unique per user, that makes
+	// resending an event harmless.
+	ClientEventID string `json:"client_event_id"`
+}
+
+// IngestRequest carries a batch of events. Any invalid event rejects the
+// whole batch so clients notice the bug rather than silently losing data.
+type IngestRequest struct {
+	Events []Event `json:"events"`
+}
+
+func (v *IngestRequest) Bind(r *http.Request) error {
+	now := time.Now().UTC()
+	for i := range v.Events {
+		e := &v.Events[i]
+		e.Type = strings.TrimSpace(strings.ToLower(e.Type))
+		e.ClientEventID = strings.TrimSpace(e.ClientEventID)
+		if e.OccurredAt == nil {
+			e.OccurredAt = &now
+		} else {
+			utc := e.OccurredAt.UTC()
+			e.OccurredAt = &utc
+		}
+	}
+
+	err1 := validate.Validate(
+		&validators.FuncValidator{
+			Name:    "events",
+			Field:   "events",
+			Message: fmt.Sprintf("%%s must hold between 1 and %d events", maxBatchSize),
+			Fn: func() bool {
+				return len(v.Events) > 0 && len(v.Events) <= maxBatchSize
+			},
+		},
+		&validators.FuncValidator{
+			Name:    "events",
+			Field:   "events",
+			Message: "%s must each have a valid recipe_id, a type of view, cook, share or print, an occurred_at that is not in the future and a client_event_id of at most 100 characters",
+			Fn: func() bool {
+				for _, e := range v.Events {
+					if _, err := uuid.Parse(e.RecipeID); err != nil {
+						return false
+					}
+					if !ValidType(e.Type) || e.OccurredAt.After(now.Add(maxClockSkew)) || len(e.ClientEventID) > 100 {
+						return false
+					}
+				}
+				return true
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package event
+
+import (
+	"Food/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db    *sqlx.DB
+	authn *auth.Authenticator
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, authn *auth.Authenticator) *Resource {
+	return &Resource{
+		db:    db,
+		authn: authn,
+	}
+}
+
+// Router serves /users/{id}/events. Users record and read only their own
+// events; admins may read anyone's history.
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	repo := NewRepository(rs.db)
+	svc := NewService(repo)
+	hndlr := NewHandler(svc)
+
+	r.Use(rs.authn.MustAuthMiddleware)
+	r.With(auth.RequireRoleOrOwner("id"), auth.RequireWriteScope).Post("/", hndlr.ingest)
+	r.With(auth.RequireRoleOrOwner("id", auth.RoleAdmin)).Get("/history", hndlr.history)
+
+	return r
+}
@@ -0,0 +1,56 @@
+package event
+
+import (
+	liberror "Food/internal/errors"
+	"Food/pkg"
+	"context"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+)
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func (s Service) ingest(ctx context.Context, userID string, req IngestRequest) (*IngestResult, error) {
+	result, err := s.repo.ingest(ctx, userID, req.Events)
+	return result, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("event.ingest", "event.ingest", userID, log.Fields{"events": len(req.Events)}).WithError(err))
+}
+
+// history serves ?type= (default view) and ?sort=recent|count.
+func (s Service) history(ctx context.Context, userID string, queryParams url.Values) ([]HistoryItem, *pkg.Pagination, error) {
+	eventType := queryParams.Get("type")
+	if eventType == "" {
+		eventType = TypeView
+	}
+	if !ValidType(eventType) {
+		return nil, nil, liberror.New("type must be one of view, cook, share or print", http.StatusBadRequest)
+	}
+
+	var byCount bool
+	switch queryParams.Get("sort") {
+	case "", "recent":
+	case "count":
+		byCount = true
+	default:
+		return nil, nil, liberror.New("sort must be one of recent or count", http.StatusBadRequest)
+	}
+
+	page, pageSize, err := pkg.ParsePaginationParams(queryParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	items, pagination, err := s.repo.history(ctx, userID, eventType, byCount, page, pageSize)
+	return items, pagination, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("event.history", "event.history", userID, log.Fields{"type": eventType}).WithError(err))
+}
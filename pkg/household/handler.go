@@ -0,0 +1,228 @@
+package household
+
+import (
+	"Food/pkg"
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+// requireMember only lets members of the {householdId} household through
+// and puts their role in the context as "household_role". Outsiders get a
+// 404 so household IDs cannot be probed.
+func (h Handler) requireMember(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(string)
+		role, err := h.svc.memberRole(r.Context(), chi.URLParam(r, "householdId"), userID)
+		if err != nil {
+			pkg.Render(w, r, err)
+			return
+		}
+		if role == "" {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "household_role", role)))
+	})
+}
+
+// requireOwner must run after requireMember.
+func requireOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value("household_role") != RoleOwner {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h Handler) mine(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	household, err := h.svc.getForUser(r.Context(), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    household,
+		Message: "Household retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) get(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	household, err := h.svc.get(r.Context(), chi.URLParam(r, "householdId"), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    household,
+		Message: "Household retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) rename(w http.ResponseWriter, r *http.Request) {
+	var renameReq RenameRequest
+	if err := render.Bind(r, &renameReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	household, err := h.svc.rename(r.Context(), chi.URLParam(r, "householdId"), userID, renameReq)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    household,
+		Message: "Household renamed successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) likes(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	recipes, err := h.svc.likes(r.Context(), chi.URLParam(r, "householdId"), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    recipes,
+		Message: "Household likes retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) invite(w http.ResponseWriter, r *http.Request) {
+	var inviteReq InviteRequest
+	if err := render.Bind(r, &inviteReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	invitation, err := h.svc.invite(r.Context(), chi.URLParam(r, "householdId"), userID, inviteReq)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    invitation,
+		Message: "Invitation created. The code is only shown once",
+		Code:    http.StatusCreated,
+	})
+}
+
+func (h Handler) listInvitations(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	invitations, err := h.svc.listInvitations(r.Context(), chi.URLParam(r, "householdId"), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    invitations,
+		Message: "Invitations retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) revokeInvitation(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	invitationID, err := h.svc.revokeInvitation(r.Context(), chi.URLParam(r, "householdId"), userID, chi.URLParam(r, "invitationId"))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    invitationID,
+		Message: "Invitation revoked successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) join(w http.ResponseWriter, r *http.Request) {
+	var joinReq JoinRequest
+	if err := render.Bind(r, &joinReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	household, err := h.svc.join(r.Context(), userID, joinReq)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    household,
+		Message: "Joined household successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) removeMember(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	role, _ := r.Context().Value("household_role").(string)
+	memberID := chi.URLParam(r, "userId")
+
+	err := h.svc.removeMember(r.Context(), chi.URLParam(r, "householdId"), userID, role, memberID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    memberID,
+		Message: "Member removed from household successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) setRole(w http.ResponseWriter, r *http.Request) {
+	var roleReq RoleRequest
+	if err := render.Bind(r, &roleReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	memberID := chi.URLParam(r, "userId")
+	err := h.svc.setRole(r.Context(), chi.URLParam(r, "householdId"), userID, memberID, roleReq)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    memberID,
+		Message: "Member role updated successfully",
+		Code:    http.StatusOK,
+	})
+}
@@ -0,0 +1,56 @@
+package household
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+// Roles a member can hold in a household. Owners manage the name, members
+// and invitations; every member shares the meal plans and likes.
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
+type Household struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Role      string    `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	Members   []Member  `json:"members" db:"-"`
+}
+
+type Member struct {
+	UserID      string    `json:"user_id" db:"user_id"`
+	Username    string    `json:"username" db:"username"`
+	DisplayName *string   `json:"display_name" db:"display_name"`
+	Role        string    `json:"role" db:"role"`
+	JoinedAt    time.Time `json:"joined_at" db:"joined_at"`
+}
+
+type Invitation struct {
+	ID          string     `json:"id" db:"id"`
+	HouseholdID string     `json:"household_id" db:"household_id"`
+	Email       *string    `json:"email" db:"email"`
+	InvitedBy   *string    `json:"invited_by" db:"invited_by"`
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	AcceptedBy  *string    `json:"accepted_by" db:"accepted_by"`
+	AcceptedAt  *time.Time `json:"accepted_at" db:"accepted_at"`
+	RevokedAt   *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreatedInvitation is returned once, when the invitation is created. The
+// code cannot be retrieved again.
+type CreatedInvitation struct {
+	Invitation
+	Code string `json:"code"`
+}
+
+// LikedRecipe is a recipe liked by at least one member of the household.
+type LikedRecipe struct {
+	RecipeID string         `json:"recipe_id" db:"recipe_id"`
+	Name     string         `json:"name" db:"name"`
+	LikedBy  pq.StringArray `json:"liked_by" db:"liked_by"`
+}
@@ -0,0 +1,410 @@
+package household
+
+import (
+	liberror "Food/internal/errors"
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+	return &Repository{
+		db: db,
+	}
+}
+
+// CreateSolo makes userID the owner of a new household of one. It runs in
+// the caller's transaction so registration and leaving a household never
+// leave a user without one.
+func CreateSolo(ctx context.Context, tx *sqlx.Tx, userID, name string) (string, error) {
+	var id string
+	err := tx.QueryRowxContext(ctx, `
+		INSERT INTO households (name) VALUES ($1) RETURNING id`, name).Scan(&id)
+	if err != nil {
+		return "", errors.Wrap(err, "QueryRowxContext: failed to insert household")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO household_members (household_id, user_id, role)
+		VALUES ($1, $2, $3)`, id, userID, RoleOwner)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to insert household owner")
+	}
+
+	return id, nil
+}
+
+// Leave removes userID from their household within the caller's
+// transaction. A household left empty is deleted along with its meal plans;
+// when the last owner leaves, the longest-standing member is promoted.
+func Leave(ctx context.Context, tx *sqlx.Tx, userID string) error {
+	var householdID string
+	err := tx.GetContext(ctx, &householdID, `
+		SELECT h.id
+		FROM households h
+		JOIN household_members hm ON hm.household_id = h.id
+		WHERE hm.user_id = $1
+		FOR UPDATE OF h`, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return errors.Wrap(err, "GetContext: failed to lock household")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM household_members WHERE user_id = $1`, userID)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to delete household member")
+	}
+
+	var remaining int
+	err = tx.GetContext(ctx, &remaining, `SELECT COUNT(*) FROM household_members WHERE household_id = $1`, householdID)
+	if err != nil {
+		return errors.Wrap(err, "GetContext: failed to count household members")
+	}
+
+	if remaining == 0 {
+		_, err = tx.ExecContext(ctx, `DELETE FROM households WHERE id = $1`, householdID)
+		return errors.Wrap(err, "ExecContext: failed to delete household")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE household_members SET role = $2
+		WHERE household_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM household_members WHERE household_id = $1 AND role = $2)
+		  AND user_id = (SELECT user_id FROM household_members WHERE household_id = $1 ORDER BY joined_at, user_id LIMIT 1)`,
+		householdID, RoleOwner)
+	return errors.Wrap(err, "ExecContext: failed to promote household owner")
+}
+
+func (r Repository) getForUser(ctx context.Context, userID string) (*Household, error) {
+	var household Household
+	err := r.db.GetContext(ctx, &household, `
+		SELECT h.id, h.name, hm.role, h.created_at, h.updated_at
+		FROM households h
+		JOIN household_members hm ON hm.household_id = h.id
+		WHERE hm.user_id = $1`, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, liberror.New("No household found for the user", http.StatusNotFound)
+		}
+		return nil, errors.Wrap(err, "GetContext: failed to get household for user")
+	}
+
+	if household.Members, err = r.members(ctx, household.ID); err != nil {
+		return nil, err
+	}
+	return &household, nil
+}
+
+func (r Repository) get(ctx context.Context, householdID, userID string) (*Household, error) {
+	var household Household
+	err := r.db.GetContext(ctx, &household, `
+		SELECT h.id, h.name, COALESCE(hm.role, '') AS role, h.created_at, h.updated_at
+		FROM households h
+		LEFT JOIN household_members hm ON hm.household_id = h.id AND hm.user_id = $2
+		WHERE h.id = $1`, householdID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, liberror.New("No household found with the specified ID", http.StatusNotFound)
+		}
+		return nil, errors.Wrap(err, "GetContext: failed to get household")
+	}
+
+	if household.Members, err = r.members(ctx, household.ID); err != nil {
+		return nil, err
+	}
+	return &household, nil
+}
+
+func (r Repository) members(ctx context.Context, householdID string) ([]Member, error) {
+	members := []Member{}
+	err := r.db.SelectContext(ctx, &members, `
+		SELECT hm.user_id, u.username, u.display_name, hm.role, hm.joined_at
+		FROM household_members hm
+		JOIN users u ON u.id = hm.user_id
+		WHERE hm.household_id = $1
+		ORDER BY hm.joined_at, u.username`, householdID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to list household members")
+	}
+	return members, nil
+}
+
+// memberRole returns the role of userID in the household, or "" when they
+// are not a member.
+func (r Repository) memberRole(ctx context.Context, householdID, userID string) (string, error) {
+	var role string
+	err := r.db.GetContext(ctx, &role, `
+		SELECT role FROM household_members WHERE household_id = $1 AND user_id = $2`, householdID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "GetContext: failed to get household membership")
+	}
+	return role, nil
+}
+
+func (r Repository) rename(ctx context.Context, householdID, name string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE households SET name = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, householdID, name)
+	return errors.Wrap(err, "ExecContext: failed to rename household")
+}
+
+func (r Repository) createInvitation(ctx context.Context, householdID, invitedBy, email, codeHash string, expiresAt time.Time) (*Invitation, error) {
+	var invitation Invitation
+	err := r.db.GetContext(ctx, &invitation, `
+		INSERT INTO household_invitations (household_id, email, code_hash, invited_by, expires_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		RETURNING id, household_id, email, invited_by, expires_at, accepted_by, accepted_at, revoked_at, created_at`,
+		householdID, email, codeHash, invitedBy, expiresAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetContext: failed to insert household invitation")
+	}
+	return &invitation, nil
+}
+
+// listInvitations returns the invitations that can still be accepted.
+func (r Repository) listInvitations(ctx context.Context, householdID string) ([]Invitation, error) {
+	invitations := []Invitation{}
+	err := r.db.SelectContext(ctx, &invitations, `
+		SELECT id, household_id, email, invited_by, expires_at, accepted_by, accepted_at, revoked_at, created_at
+		FROM household_invitations
+		WHERE household_id = $1
+		  AND accepted_at IS NULL
+		  AND revoked_at IS NULL
+		  AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC`, householdID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to list household invitations")
+	}
+	return invitations, nil
+}
+
+func (r Repository) revokeInvitation(ctx context.Context, householdID, invitationID string) (string, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE household_invitations SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND household_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL`, invitationID, householdID)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to revoke household invitation")
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return "", errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+	if count != 1 {
+		return "", liberror.New("No pending invitation found with the specified ID", http.StatusNotFound)
+	}
+
+	return invitationID, nil
+}
+
+// accept moves userID into the household the invitation belongs to. Their
+// previous household is left exactly as if they had walked out of it.
+func (r *Repository) accept(ctx context.Context, userID, codeHash string) (string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var invitation Invitation
+	err = tx.GetContext(ctx, &invitation, `
+		SELECT id, household_id, email, invited_by, expires_at, accepted_by, accepted_at, revoked_at, created_at
+		FROM household_invitations
+		WHERE code_hash = $1
+		  AND accepted_at IS NULL
+		  AND revoked_at IS NULL
+		  AND expires_at > CURRENT_TIMESTAMP
+		FOR UPDATE`, codeHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = liberror.New("Invitation code is invalid or has expired", http.StatusBadRequest)
+			return "", err
+		}
+		return "", errors.Wrap(err, "GetContext: failed to get household invitation")
+	}
+
+	if invitation.Email != nil {
+		var email string
+		err = tx.GetContext(ctx, &email, `SELECT email FROM users WHERE id = $1`, userID)
+		if err != nil {
+			return "", errors.Wrap(err, "GetContext: failed to get user email")
+		}
+		if !strings.EqualFold(email, *invitation.Email) {
+			err = liberror.New("This invitation was sent to a different email address", http.StatusForbidden)
+			return "", err
+		}
+	}
+
+	var current string
+	err = tx.GetContext(ctx, &current, `SELECT household_id FROM household_members WHERE user_id = $1`, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", errors.Wrap(err, "GetContext: failed to get current household")
+	}
+	if current == invitation.HouseholdID {
+		err = liberror.New("You are already a member of this household", http.StatusConflict)
+		return "", err
+	}
+
+	if err = Leave(ctx, tx, userID); err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO household_members (household_id, user_id, role)
+		VALUES ($1, $2, $3)`, invitation.HouseholdID, userID, RoleMember)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to insert household member")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE household_invitations SET accepted_by = $2, accepted_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, invitation.ID, userID)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to mark household invitation accepted")
+	}
+
+	return invitation.HouseholdID, nil
+}
+
+// removeMember takes userID out of the household and gives them a new
+// household of one, so they keep planning meals on their own.
+func (r *Repository) removeMember(ctx context.Context, householdID, userID string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var username string
+	err = tx.GetContext(ctx, &username, `
+		SELECT u.username
+		FROM household_members hm
+		JOIN users u ON u.id = hm.user_id
+		WHERE hm.household_id = $1 AND hm.user_id = $2`, householdID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = liberror.New("No member found with the specified ID", http.StatusNotFound)
+			return err
+		}
+		return errors.Wrap(err, "GetContext: failed to get household member")
+	}
+
+	var count int
+	err = tx.GetContext(ctx, &count, `SELECT COUNT(*) FROM household_members WHERE household_id = $1`, householdID)
+	if err != nil {
+		return errors.Wrap(err, "GetContext: failed to count household members")
+	}
+	if count == 1 {
+		err = liberror.New("The only member cannot leave the household", http.StatusConflict)
+		return err
+	}
+
+	if err = Leave(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	_, err = CreateSolo(ctx, tx, userID, username+"'s household")
+	return err
+}
+
+// setRole changes the role of a member, refusing to demote the last owner.
+func (r *Repository) setRole(ctx context.Context, householdID, userID, role string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM households WHERE id = $1 FOR UPDATE`, householdID)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to lock household")
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE household_members SET role = $3
+		WHERE household_id = $1 AND user_id = $2`, householdID, userID, role)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to update household member role")
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+	if count != 1 {
+		err = liberror.New("No member found with the specified ID", http.StatusNotFound)
+		return err
+	}
+
+	var owners int
+	err = tx.GetContext(ctx, &owners, `
+		SELECT COUNT(*) FROM household_members WHERE household_id = $1 AND role = $2`, householdID, RoleOwner)
+	if err != nil {
+		return errors.Wrap(err, "GetContext: failed to count household owners")
+	}
+	if owners == 0 {
+		err = liberror.New("A household needs at least one owner", http.StatusConflict)
+		return err
+	}
+
+	return nil
+}
+
+// likes merges the likes of every member of the household.
+func (r Repository) likes(ctx context.Context, householdID string) ([]LikedRecipe, error) {
+	recipes := []LikedRecipe{}
+	err := r.db.SelectContext(ctx, &recipes, `
+		SELECT l.recipe_id, r.name, array_agg(l.user_id::text ORDER BY l.user_id) AS liked_by
+		FROM likes l
+		JOIN household_members hm ON hm.user_id = l.user_id
+		JOIN recipes r ON r.id = l.recipe_id
+		WHERE hm.household_id = $1
+		GROUP BY l.recipe_id, r.name
+		ORDER BY COUNT(*) DESC, r.name`, householdID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to list household likes")
+	}
+	return recipes, nil
+}
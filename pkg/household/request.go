@@ -0,0 +1,90 @@
+package household
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"net/http"
+	"strings"
+)
+
+type RenameRequest struct {
+	Name string `json:"name"`
+}
+
+func (v *RenameRequest) Bind(r *http.Request) error {
+	v.Name = strings.TrimSpace(v.Name)
+
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "name", Field: v.Name, Message: fmt.Sprintf("%v is missing", "name")},
+		&validators.StringLengthInRange{Name: "name", Field: v.Name, Max: 100, Message: fmt.Sprintf("%v must be at most 100 characters", "name")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type InviteRequest struct {
+	// Email is optional. When set the invitation is mailed to that address
+	// and only the account registered with it can accept.
+	Email string `json:"email"`
+}
+
+func (v *InviteRequest) Bind(r *http.Request) error {
+	v.Email = strings.TrimSpace(strings.ToLower(v.Email))
+	if v.Email == "" {
+		return nil
+	}
+
+	err1 := validate.Validate(
+		&validators.EmailIsPresent{Name: "email", Field: v.Email, Message: fmt.Sprintf("%v is invalid", "email")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type JoinRequest struct {
+	Code string `json:"code"`
+}
+
+func (v *JoinRequest) Bind(r *http.Request) error {
+	v.Code = strings.TrimSpace(v.Code)
+
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "code", Field: v.Code, Message: fmt.Sprintf("%v is missing", "code")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (v *RoleRequest) Bind(r *http.Request) error {
+	v.Role = strings.TrimSpace(strings.ToLower(v.Role))
+
+	err1 := validate.Validate(
+		&validators.FuncValidator{
+			Name:    "role",
+			Field:   "role",
+			Message: "%s must be one of owner or member",
+			Fn: func() bool {
+				return v.Role == RoleOwner || v.Role == RoleMember
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
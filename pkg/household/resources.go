@@ -0,0 +1,59 @@
+package household
+
+import (
+	"Food/auth"
+	"Food/config"
+	"Food/pkg/mailer"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db     *sqlx.DB
+	authn  *auth.Authenticator
+	cfg    *config.Config
+	mailer mailer.Mailer
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, authn *auth.Authenticator, cfg *config.Config, mailer mailer.Mailer) *Resource {
+	return &Resource{
+		db:     db,
+		authn:  authn,
+		cfg:    cfg,
+		mailer: mailer,
+	}
+}
+
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	repo := NewRepository(rs.db)
+	svc := NewService(repo, rs.cfg, rs.mailer)
+	hndlr := NewHandler(svc)
+
+	r.Use(rs.authn.MustAuthMiddleware)
+
+	r.Get("/me", hndlr.mine)
+	r.With(auth.DenyAPIKeys).Post("/join", hndlr.join)
+
+	r.Route("/{householdId}", func(r chi.Router) {
+		r.Use(hndlr.requireMember)
+		r.Get("/", hndlr.get)
+		r.Get("/likes", hndlr.likes)
+		r.With(auth.DenyAPIKeys).Delete("/members/{userId}", hndlr.removeMember)
+
+		// Managing who belongs to the household is for owners signed in
+		// interactively.
+		r.Group(func(r chi.Router) {
+			r.Use(auth.DenyAPIKeys, requireOwner)
+			r.Put("/", hndlr.rename)
+			r.Post("/invitations", hndlr.invite)
+			r.Get("/invitations", hndlr.listInvitations)
+			r.Delete("/invitations/{invitationId}", hndlr.revokeInvitation)
+			r.Put("/members/{userId}/role", hndlr.setRole)
+		})
+	})
+
+	return r
+}
@@ -0,0 +1,174 @@
+package household
+
+import (
+	"Food/config"
+	liberror "Food/internal/errors"
+	"Food/pkg"
+	"Food/pkg/mailer"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Service struct {
+	repo   *Repository
+	cfg    *config.Config
+	mailer mailer.Mailer
+}
+
+func NewService(repo *Repository, cfg *config.Config, mailer mailer.Mailer) *Service {
+	return &Service{repo: repo, cfg: cfg, mailer: mailer}
+}
+
+func (s Service) getForUser(ctx context.Context, userID string) (*Household, error) {
+	household, err := s.repo.getForUser(ctx, userID)
+	return household, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("household.getForUser", "household.getForUser", userID).WithError(err))
+}
+
+func (s Service) get(ctx context.Context, householdID, userID string) (*Household, error) {
+	household, err := s.repo.get(ctx, householdID, userID)
+	return household, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("household.get", "household.get", userID, log.Fields{"household_id": householdID}).WithError(err))
+}
+
+func (s Service) memberRole(ctx context.Context, householdID, userID string) (string, error) {
+	role, err := s.repo.memberRole(ctx, householdID, userID)
+	return role, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("household.memberRole", "household.memberRole", userID, log.Fields{"household_id": householdID}).WithError(err))
+}
+
+func (s Service) rename(ctx context.Context, householdID, userID string, request RenameRequest) (*Household, error) {
+	if err := s.repo.rename(ctx, householdID, request.Name); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("household.rename", "household.rename", userID, log.Fields{"household_id": householdID}).WithError(err))
+	}
+	return s.get(ctx, householdID, userID)
+}
+
+// invite creates an invitation code and, when an email address is given,
+// sends it there. The code is also returned so it can be shared in person.
+func (s Service) invite(ctx context.Context, householdID, userID string, request InviteRequest) (*CreatedInvitation, error) {
+	code, codeHash, err := newInvitationCode()
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("household.invite", "newInvitationCode", userID).WithError(err))
+	}
+
+	ttl := s.cfg.Accounts.HouseholdInvitationExpiry.Duration
+	invitation, err := s.repo.createInvitation(ctx, householdID, userID, request.Email, codeHash, time.Now().UTC().Add(ttl))
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("household.invite", "household.createInvitation", userID, log.Fields{"household_id": householdID}).WithError(err))
+	}
+
+	if request.Email != "" {
+		household, err := s.get(ctx, householdID, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.mailer.Send(ctx, mailer.Message{
+			To:      request.Email,
+			Subject: fmt.Sprintf("You're invited to join %s", household.Name),
+			Body: fmt.Sprintf("Hi,\n\nYou've been invited to share meal plans with %s. Sign in and enter the code %s, or open the link below. It expires in %s.\n\n%s/households/join?code=%s\n",
+				household.Name, code, ttl, s.cfg.PublicURL, code),
+		})
+		if err != nil {
+			return nil, liberror.CoverErr(err,
+				errors.New("service temporarily unavailable. Please try again later"),
+				pkg.Log("household.invite", "mailer.Send", userID, log.Fields{"household_id": householdID}).WithError(err))
+		}
+	}
+
+	return &CreatedInvitation{Invitation: *invitation, Code: code}, nil
+}
+
+func (s Service) listInvitations(ctx context.Context, householdID, userID string) ([]Invitation, error) {
+	invitations, err := s.repo.listInvitations(ctx, householdID)
+	return invitations, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("household.listInvitations", "household.listInvitations", userID, log.Fields{"household_id": householdID}).WithError(err))
+}
+
+func (s Service) revokeInvitation(ctx context.Context, householdID, userID, invitationID string) (string, error) {
+	resp, err := s.repo.revokeInvitation(ctx, householdID, invitationID)
+	return resp, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("household.revokeInvitation", "household.revokeInvitation", userID, log.Fields{"household_id": householdID}).WithError(err))
+}
+
+func (s Service) join(ctx context.Context, userID string, request JoinRequest) (*Household, error) {
+	householdID, err := s.repo.accept(ctx, userID, hashInvitationCode(request.Code))
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("household.join", "household.accept", userID).WithError(err))
+	}
+	return s.get(ctx, householdID, userID)
+}
+
+// removeMember lets owners remove anyone and members remove themselves.
+func (s Service) removeMember(ctx context.Context, householdID, userID, role, memberID string) error {
+	if role != RoleOwner && userID != memberID {
+		return liberror.New("Only household owners can remove other members", http.StatusForbidden)
+	}
+
+	err := s.repo.removeMember(ctx, householdID, memberID)
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("household.removeMember", "household.removeMember", userID, log.Fields{"household_id": householdID, "member_id": memberID}).WithError(err))
+}
+
+func (s Service) setRole(ctx context.Context, householdID, userID, memberID string, request RoleRequest) error {
+	err := s.repo.setRole(ctx, householdID, memberID, request.Role)
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("household.setRole", "household.setRole", userID, log.Fields{"household_id": householdID, "member_id": memberID}).WithError(err))
+}
+
+func (s Service) likes(ctx context.Context, householdID, userID string) ([]LikedRecipe, error) {
+	recipes, err := s.repo.likes(ctx, householdID)
+	return recipes, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("household.likes", "household.likes", userID, log.Fields{"household_id": householdID}).WithError(err))
+}
+
+// invitationAlphabet leaves out characters that are easily confused when a
+// code is read aloud or copied by hand.
+const invitationAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newInvitationCode returns a code formatted as XXXX-XXXX and its hash.
+func newInvitationCode() (code string, hash string, err error) {
+	b := make([]byte, 8)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	for i := range b {
+		b[i] = invitationAlphabet[int(b[i])%len(invitationAlphabet)]
+	}
+	code = string(b[:4]) + "-" + string(b[4:])
+	return code, hashInvitationCode(code), nil
+}
+
+// hashInvitationCode ignores case, spaces and dashes so codes can be typed
+// the way they were read out.
+func hashInvitationCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,6 +2,8 @@ package ingredient
 
 import (
 	"Food/pkg"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
 	"net/http"
 )
 
@@ -108,3 +110,52 @@ func (h Handler) list(w http.ResponseWriter, r *http.Request) {
 		Code:    http.StatusOK,
 	})
 }
+
+func (h Handler) listAllergens(w http.ResponseWriter, r *http.Request) {
+	allergens, err := h.svc.listAllergens(r.Context())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    allergens,
+		Message: "Allergens retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) convert(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	conversion, err := h.svc.convert(query.Get("quantity"), query.Get("to"), query.Get("ingredient"))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    conversion,
+		Message: "Quantity converted successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) setAllergens(w http.ResponseWriter, r *http.Request) {
+	var req AllergensRequest
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if err := h.svc.setAllergens(r.Context(), id, req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    id,
+		Message: "Ingredient allergens updated successfully",
+		Code:    http.StatusOK,
+	})
+}
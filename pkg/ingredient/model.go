@@ -2,6 +2,7 @@ package ingredient
 
 import (
 	"Food/internal/errors"
+	"Food/pkg/quantity"
 	"encoding/json"
 	"time"
 )
@@ -23,3 +24,17 @@ func (i *Ingredients) Scan(value interface{}) error {
 
 	return json.Unmarshal(bytes, i)
 }
+
+type Allergen struct {
+	Code string `json:"code" db:"code"`
+	Name string `json:"name" db:"name"`
+}
+
+// Conversion is a quantity expressed in another unit. Density is the grams
+// per millilitre used to convert between volume and weight, if any.
+type Conversion struct {
+	From    quantity.Quantity `json:"from"`
+	To      quantity.Quantity `json:"to"`
+	Display string            `json:"display"`
+	Density *float64          `json:"density,omitempty"`
+}
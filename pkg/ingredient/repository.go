@@ -5,8 +5,10 @@ import (
 	"context"
 	"database/sql"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"net/http"
+	"strings"
 )
 
 type Repository struct {
@@ -79,15 +81,18 @@ func NewRepository(db *sqlx.DB) *Repository {
 //}
 
 type listResp struct {
-	ID   string `json:"id" db:"id"`
-	Name string `json:"name" db:"name"`
+	ID        string         `json:"id" db:"id"`
+	Name      string         `json:"name" db:"name"`
+	Allergens pq.StringArray `json:"allergens" db:"allergens"`
 }
 
 func (r Repository) list(ctx context.Context, searchTerm string) ([]listResp, error) {
 	var ingredients []listResp
 	query := `
-        SELECT id, name FROM ingredients 
-        WHERE name ILIKE $1
+        SELECT i.id, i.name,
+            ARRAY(SELECT ia.allergen FROM ingredient_allergens ia WHERE ia.ingredient_id = i.id ORDER BY ia.allergen) AS allergens
+        FROM ingredients i
+        WHERE i.name ILIKE $1
     `
 	err := r.db.SelectContext(ctx, &ingredients, query, "%"+searchTerm+"%")
 	if err != nil {
@@ -99,3 +104,68 @@ func (r Repository) list(ctx context.Context, searchTerm string) ([]listResp, er
 
 	return ingredients, nil
 }
+
+func (r Repository) listAllergens(ctx context.Context) ([]Allergen, error) {
+	allergens := []Allergen{}
+	err := r.db.SelectContext(ctx, &allergens, `SELECT code, name FROM allergens ORDER BY name`)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to list allergens")
+	}
+	return allergens, nil
+}
+
+// setAllergens replaces the allergen tags of an ingredient. Tags set here
+// are marked manual so renaming the ingredient does not undo them.
+func (r *Repository) setAllergens(ctx context.Context, ingredientID string, allergens []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var exists bool
+	err = tx.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM ingredients WHERE id = $1)`, ingredientID)
+	if err != nil {
+		return errors.Wrap(err, "GetContext: failed to check ingredient")
+	}
+	if !exists {
+		err = liberror.New("No ingredient found with the specified ID", http.StatusNotFound)
+		return err
+	}
+
+	var unknown []string
+	err = tx.SelectContext(ctx, &unknown, `
+		SELECT code FROM unnest($1::text[]) AS code
+		WHERE code NOT IN (SELECT code FROM allergens)`, pq.Array(allergens))
+	if err != nil {
+		return errors.Wrap(err, "SelectContext: failed to check allergen codes")
+	}
+	if len(unknown) > 0 {
+		err = liberror.New("Unknown allergens: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM ingredient_allergens WHERE ingredient_id = $1`, ingredientID)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to clear ingredient allergens")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO ingredient_allergens (ingredient_id, allergen, source)
+		SELECT $1, unnest($2::text[]), 'manual'`, ingredientID, pq.Array(allergens))
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to tag ingredient allergens")
+	}
+
+	return nil
+}
@@ -35,3 +35,23 @@ type GetResponse struct {
 	Name         string   `json:"name"`
 	Alternatives []string `json:"alternatives"`
 }
+
+type AllergensRequest struct {
+	Allergens []string `json:"allergens"`
+}
+
+func (v *AllergensRequest) Bind(r *http.Request) error {
+	seen := make(map[string]bool, len(v.Allergens))
+	allergens := make([]string, 0, len(v.Allergens))
+	for _, code := range v.Allergens {
+		code = strings.TrimSpace(strings.ToLower(code))
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		allergens = append(allergens, code)
+	}
+	v.Allergens = allergens
+
+	return nil
+}
@@ -1,18 +1,21 @@
 package ingredient
 
 import (
+	"Food/auth"
 	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
 )
 
 type Resource struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	authn *auth.Authenticator
 }
 
 // NewResource creates and returns a resource.
-func NewResource(db *sqlx.DB) *Resource {
+func NewResource(db *sqlx.DB, authn *auth.Authenticator) *Resource {
 	return &Resource{
-		db: db,
+		db:    db,
+		authn: authn,
 	}
 }
 
@@ -29,6 +32,13 @@ func (rs *Resource) Router() *chi.Mux {
 	//r.Put("/update/{id}", hndlr.update)
 	//r.Get("/get/{id}", hndlr.get)
 	r.Get("/", hndlr.list)
+	r.Get("/allergens", hndlr.listAllergens)
+	r.Get("/convert", hndlr.convert)
+
+	r.Group(func(r chi.Router) {
+		r.Use(rs.authn.MustAuthMiddleware, auth.RequireRole(auth.RoleAdmin, auth.RoleEditor), auth.RequireWriteScope)
+		r.Put("/{id}/allergens", hndlr.setAllergens)
+	})
 
 	return r
 }
@@ -3,8 +3,11 @@ package ingredient
 import (
 	liberror "Food/internal/errors"
 	"Food/pkg"
+	"Food/pkg/quantity"
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 )
 
 type Service struct {
@@ -72,3 +75,53 @@ func (s Service) list(ctx context.Context, name string) ([]listResp, error) {
 		errors.New("service temporarily unavailable. Please try again later"),
 		pkg.Log("ingredients.list", "ingredients.list", "").WithError(err))
 }
+
+func (s Service) listAllergens(ctx context.Context) ([]Allergen, error) {
+	resp, err := s.repo.listAllergens(ctx)
+	return resp, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("ingredients.listAllergens", "ingredients.listAllergens", "").WithError(err))
+}
+
+func (s Service) setAllergens(ctx context.Context, id string, req AllergensRequest) error {
+	err := s.repo.setAllergens(ctx, id, req.Allergens)
+	userID, _ := ctx.Value("user_id").(string)
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("ingredients.setAllergens", "ingredients.setAllergens", userID).WithError(err))
+}
+
+// convert parses text and converts it to the unit to. Between volume and
+// weight it uses the density of the named ingredient.
+func (s Service) convert(text, to, ingredientName string) (*Conversion, error) {
+	from := quantity.Parse(text)
+	if from.Amount == nil {
+		return nil, liberror.New(fmt.Sprintf("No amount found in %q", text), http.StatusBadRequest)
+	}
+	if _, ok := quantity.Lookup(from.Unit); !ok {
+		return nil, liberror.New(fmt.Sprintf("No unit found in %q", text), http.StatusBadRequest)
+	}
+
+	conversion := Conversion{From: from}
+	density, ok := quantity.Density(ingredientName)
+	if ok {
+		conversion.Density = &density
+	}
+
+	converted, err := quantity.Convert(from, to, density)
+	switch {
+	case errors.Is(err, quantity.ErrUnknownUnit):
+		return nil, liberror.New(fmt.Sprintf("Unknown unit %q", to), http.StatusBadRequest)
+	case errors.Is(err, quantity.ErrNoDensity) && ingredientName == "":
+		return nil, liberror.New("Name the ingredient to convert between volume and weight", http.StatusBadRequest)
+	case errors.Is(err, quantity.ErrNoDensity):
+		return nil, liberror.New(fmt.Sprintf("The density of %s is not known", ingredientName), http.StatusUnprocessableEntity)
+	case err != nil:
+		return nil, liberror.New(fmt.Sprintf("Cannot convert %s to %s", from.Unit, to), http.StatusBadRequest)
+	}
+
+	conversion.To = converted
+	conversion.To.Text = converted.Format()
+	conversion.Display = conversion.To.Text
+	return &conversion, nil
+}
@@ -3,6 +3,7 @@ package mealplan
 import (
 	liberror "Food/internal/errors"
 	"Food/pkg"
+	"Food/pkg/quantity"
 	"github.com/google/uuid"
 	"net/http"
 	"time"
@@ -20,26 +21,40 @@ func NewHandler(svc *Service) *Handler {
 
 func (h *Handler) generate(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
-	weekStartDate := getStartOfWeek()
+	profile, err := h.svc.planningProfile(r.Context(), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	weekStartDate := getStartOfWeek(profile.Location())
 
-	placeholders, err := h.svc.generateMealPlans(r.Context(), uuid.MustParse(userID), weekStartDate)
+	placeholders, complete, err := h.svc.generateMealPlans(r.Context(), uuid.MustParse(userID), profile, weekStartDate)
 	if err != nil {
 		pkg.Render(w, r, err)
 		return
 	}
 
+	message := "Meal plans have been successfully generated for the week."
+	if !complete {
+		message = "Meal plans have been generated for the week, but no recipes suit your household for some meals."
+	}
 	pkg.Render(w, r, pkg.ApiResponse{
 		Data:    placeholders,
-		Message: "Meal plans have been successfully generated for the week.",
+		Message: message,
 		Code:    http.StatusOK,
 	})
 }
 
 func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
-	weekStartDate := getStartOfWeek()
+	profile, err := h.svc.planningProfile(r.Context(), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	weekStartDate := getStartOfWeek(profile.Location())
 
-	placeholders, err := h.svc.getMealPlan(userID, weekStartDate)
+	placeholders, err := h.svc.getMealPlan(profile, weekStartDate)
 	if err != nil {
 		pkg.Render(w, r, err)
 		return
@@ -52,14 +67,17 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func getStartOfWeek() time.Time {
-	now := time.Now()
+// getStartOfWeek returns the Monday of the current week as seen in the
+// user's time zone, so the week turns over at their midnight rather than
+// the server's.
+func getStartOfWeek(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
 	weekday := int(now.Weekday())
 	if weekday == 0 { // Sunday
 		weekday = 7
 	}
 	startOfWeek := now.AddDate(0, 0, -weekday+1)
-	return time.Date(startOfWeek.Year(), startOfWeek.Month(), startOfWeek.Day(), 0, 0, 0, 0, startOfWeek.Location())
+	return time.Date(startOfWeek.Year(), startOfWeek.Month(), startOfWeek.Day(), 0, 0, 0, 0, time.UTC)
 }
 
 func (h *Handler) GetMealPlansForDay(w http.ResponseWriter, r *http.Request) {
@@ -70,9 +88,14 @@ func (h *Handler) GetMealPlansForDay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	dayOfWeek := DayOfWeek(dayOfWeekStr)
-	weekStartDate := getStartOfWeek()
+	profile, err := h.svc.planningProfile(r.Context(), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	weekStartDate := getStartOfWeek(profile.Location())
 
-	mealPlans, err := h.svc.GetMealPlansForDay(userID, dayOfWeek, weekStartDate)
+	mealPlans, err := h.svc.GetMealPlansForDay(profile, dayOfWeek, weekStartDate)
 	if err != nil {
 		pkg.Render(w, r, err)
 		return
@@ -84,3 +107,38 @@ func (h *Handler) GetMealPlansForDay(w http.ResponseWriter, r *http.Request) {
 		Code:    http.StatusOK,
 	})
 }
+
+// shoppingList totals this week's ingredients in the caller's unit system,
+// or in the one named by the units query parameter: metric, imperial or
+// market.
+func (h *Handler) shoppingList(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	profile, err := h.svc.planningProfile(r.Context(), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	system := r.URL.Query().Get("units")
+	switch system {
+	case "":
+		system = profile.Units
+	case quantity.Metric, quantity.Imperial, quantity.Market:
+	default:
+		pkg.Render(w, r, liberror.New("The 'units' parameter must be one of metric, imperial or market.", http.StatusBadRequest))
+		return
+	}
+	weekStartDate := getStartOfWeek(profile.Location())
+
+	list, err := h.svc.shoppingList(r.Context(), profile, weekStartDate, system)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    list,
+		Message: "Retrieved the shopping list for the current week successfully.",
+		Code:    http.StatusOK,
+	})
+}
@@ -1,16 +1,20 @@
 package mealplan
 
 import (
+	"Food/pkg/quantity"
+	"github.com/lib/pq"
 	"time"
 )
 
 type MealPlan struct {
 	ID            string    `json:"id"`
 	UserID        string    `json:"user_id"`
+	HouseholdID   string    `json:"household_id"`
 	DayOfWeek     DayOfWeek `json:"day_of_week"`
 	MealType      MealType  `json:"meal_type"`
 	RecipeID      string    `json:"recipe_id"`
 	WeekStartDate time.Time `json:"week_start_date"`
+	Servings      int       `json:"servings"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 	ImageURL      string    `json:"image_url"` // Placeholder image URL
@@ -18,6 +22,37 @@ type MealPlan struct {
 
 type MealPlans = []MealPlan
 
+// PlanningProfile holds the user and household settings meal planning
+// depends on. Meal plans belong to the household, so every member sees and
+// regenerates the same plan.
+type PlanningProfile struct {
+	HouseholdID   string         `db:"household_id"`
+	MemberIDs     pq.StringArray `db:"member_ids"`
+	HouseholdSize int            `db:"household_size"`
+	Timezone      string         `db:"timezone"`
+	// Units is the unit system ingredient quantities are shown in.
+	Units string `db:"units"`
+}
+
+// Servings is the number of people to plan for: every member of the
+// household, or the household size the user entered if that is larger,
+// for people without an account such as children.
+func (p PlanningProfile) Servings() int {
+	if len(p.MemberIDs) > p.HouseholdSize {
+		return len(p.MemberIDs)
+	}
+	return p.HouseholdSize
+}
+
+// Location falls back to UTC for zones the server cannot load.
+func (p PlanningProfile) Location() *time.Location {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 type MealType string
 
 const (
@@ -37,3 +72,19 @@ const (
 	Saturday  DayOfWeek = "saturday"
 	Sunday    DayOfWeek = "sunday"
 )
+
+// ShoppingList is what the household needs for a week of meal plans.
+type ShoppingList struct {
+	WeekStartDate time.Time      `json:"week_start_date"`
+	Units         string         `json:"units"`
+	Items         []ShoppingItem `json:"items"`
+}
+
+// ShoppingItem is the total of one ingredient, for example "3 derica of
+// beans". Amounts that cannot be added to the rest, such as "to taste",
+// are listed as written.
+type ShoppingItem struct {
+	Name       string              `json:"name"`
+	Quantities []quantity.Quantity `json:"quantities"`
+	Display    string              `json:"display"`
+}
@@ -2,6 +2,7 @@ package mealplan
 
 import (
 	liberror "Food/internal/errors"
+	"Food/pkg/quantity"
 	"Food/pkg/recipe"
 	"context"
 	"database/sql"
@@ -22,39 +23,71 @@ func NewRepository(db *sqlx.DB) *Repository {
 	return &Repository{db: db}
 }
 
-func (r *Repository) save(ctx context.Context, mealPlans MealPlans) error {
+// save replaces the household's plan for the week with mealPlans in one
+// transaction, so meals left out of a new plan do not keep the recipes of
+// an earlier one.
+func (r *Repository) save(ctx context.Context, householdID string, weekStartDate time.Time, mealPlans MealPlans) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM meal_plans WHERE household_id = $1 AND week_start_date = $2`, householdID, weekStartDate)
+	if err != nil {
+		err = errors.Wrap(err, "ExecContext: failed to clear meal plans")
+		return err
+	}
 	if len(mealPlans) == 0 {
 		return nil
 	}
 
 	// Construct the base query
-	query := `INSERT INTO meal_plans (user_id, day_of_week, meal_type, recipe_id, week_start_date, image_url)
+	query := `INSERT INTO meal_plans (user_id, household_id, day_of_week, meal_type, recipe_id, week_start_date, image_url, servings)
 			  VALUES `
 	values := []interface{}{}
 
 	// Build the query and values slice dynamically
 	for i, mealPlan := range mealPlans {
 		// Add placeholders for each meal plan
-		query += fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)", i*6+1, i*6+2, i*6+3, i*6+4, i*6+5, i*6+6)
+		query += fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", i*8+1, i*8+2, i*8+3, i*8+4, i*8+5, i*8+6, i*8+7, i*8+8)
 		if i < len(mealPlans)-1 {
 			query += ", "
 		}
-		values = append(values, mealPlan.UserID, mealPlan.DayOfWeek, mealPlan.MealType, mealPlan.RecipeID, mealPlan.WeekStartDate, mealPlan.ImageURL)
+		values = append(values, mealPlan.UserID, mealPlan.HouseholdID, mealPlan.DayOfWeek, mealPlan.MealType, mealPlan.RecipeID, mealPlan.WeekStartDate, mealPlan.ImageURL, mealPlan.Servings)
 	}
 
-	// Add the ON CONFLICT clause to handle upsert
-	query += ` ON CONFLICT (user_id, day_of_week, week_start_date, meal_type) DO UPDATE 
-			   SET recipe_id = EXCLUDED.recipe_id, 
-			       image_url = EXCLUDED.image_url`
+	// Add the ON CONFLICT clause to handle upsert, in case another
+	// generation for the same week committed first
+	query += ` ON CONFLICT (household_id, day_of_week, week_start_date, meal_type) DO UPDATE 
+			   SET user_id = EXCLUDED.user_id,
+			       recipe_id = EXCLUDED.recipe_id, 
+			       image_url = EXCLUDED.image_url,
+			       servings = EXCLUDED.servings`
 
 	// Execute the query
-	_, err := r.db.ExecContext(ctx, query, values...)
-	return errors.Wrap(err, "ExecContext: failed to save meal plans")
+	_, err = tx.ExecContext(ctx, query, values...)
+	if err != nil {
+		err = errors.Wrap(err, "ExecContext: failed to save meal plans")
+		return err
+	}
+	return nil
 }
 
 type Ingredient struct {
 	Name         string   `json:"name"`
 	Quantity     string   `json:"quantity"`
+	Display      string   `json:"display"`
 	Alternatives []string `json:"alternatives"`
 }
 
@@ -67,6 +100,7 @@ type DetailedMealPlanDTO struct {
 	CookingTime  string         `json:"cooking_time" db:"cooking_time"`
 	Instructions pq.StringArray `json:"instructions" db:"instructions"`
 	ImgUrl       string         `json:"img_url" db:"img_url"`
+	Servings     int            `json:"servings" db:"servings"`
 	Ingredients  Ingredients    `json:"ingredients" db:"-"`
 }
 
@@ -74,9 +108,10 @@ type MealPlanPlaceholderDTO struct {
 	DayOfWeek     DayOfWeek `json:"day_of_week" db:"day_of_week"`
 	WeekStartDate time.Time `json:"week_start_date" db:"week_start_date"`
 	ImageURL      string    `json:"image_url" db:"image_url"`
+	Servings      int       `json:"servings" db:"servings"`
 }
 
-func (r *Repository) GetMealPlansForDay(userID string, dayOfWeek DayOfWeek, weekStartDate time.Time) ([]DetailedMealPlanDTO, error) {
+func (r *Repository) GetMealPlansForDay(householdID string, dayOfWeek DayOfWeek, weekStartDate time.Time) ([]DetailedMealPlanDTO, error) {
 	var recipes []DetailedMealPlanDTO
 	query := `
 		SELECT
@@ -85,11 +120,12 @@ func (r *Repository) GetMealPlansForDay(userID string, dayOfWeek DayOfWeek, week
 			r.description,
 			r.cooking_time,
 			r.instructions,
-			r.img_url
+			r.img_url,
+			mp.servings
 		FROM meal_plans mp
 		JOIN recipes r ON mp.recipe_id = r.id
-		WHERE mp.user_id = $1 AND mp.day_of_week = $2 AND mp.week_start_date = $3`
-	err := r.db.Select(&recipes, query, userID, dayOfWeek, weekStartDate)
+		WHERE mp.household_id = $1 AND mp.day_of_week = $2 AND mp.week_start_date = $3`
+	err := r.db.Select(&recipes, query, householdID, dayOfWeek, weekStartDate)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, liberror.New("No meal plans found for the specified day", http.StatusNotFound)
@@ -131,14 +167,76 @@ func (r *Repository) GetIngredientsForRecipes(recipeIDs []uuid.UUID) (map[uuid.U
 	return ingredientsMap, nil
 }
 
-func (r *Repository) GetMealPlanPlaceholders(userID string, weekStartDate time.Time) ([]MealPlanPlaceholderDTO, error) {
+// PlannedIngredient is one recipe ingredient of one planned meal.
+type PlannedIngredient struct {
+	Name      string   `db:"name"`
+	Quantity  string   `db:"quantity"`
+	Amount    *float64 `db:"amount"`
+	AmountMax *float64 `db:"amount_max"`
+	Unit      string   `db:"unit"`
+	Note      string   `db:"note"`
+	Parsed    bool     `db:"parsed"`
+}
+
+// GetPlannedIngredients lists the ingredients of every meal planned for the
+// week, once per meal, so a recipe planned twice is counted twice.
+func (r *Repository) GetPlannedIngredients(ctx context.Context, householdID string, weekStartDate time.Time) ([]PlannedIngredient, error) {
+	var ingredients []PlannedIngredient
+	err := r.db.SelectContext(ctx, &ingredients, `
+		SELECT
+			i.name,
+			COALESCE(ri.quantity, '') AS quantity,
+			ri.amount,
+			ri.amount_max,
+			COALESCE(ri.unit, '') AS unit,
+			COALESCE(ri.note, '') AS note,
+			ri.note IS NOT NULL AS parsed
+		FROM meal_plans mp
+		JOIN recipe_ingredients ri ON ri.recipe_id = mp.recipe_id
+		JOIN ingredients i ON i.id = ri.ingredient_id
+		WHERE mp.household_id = $1 AND mp.week_start_date = $2
+		ORDER BY i.name`, householdID, weekStartDate)
+	return ingredients, errors.Wrap(err, "SelectContext: failed to get planned ingredients")
+}
+
+// GetLocalMeasures returns the market measures of each named ingredient,
+// keyed by name. An ingredient that matches several kinds in local_measures
+// is measured as the one with the highest priority; ingredients that match
+// none are left out.
+func (r *Repository) GetLocalMeasures(ctx context.Context, names []string) (map[string][]quantity.Measure, error) {
+	var rows []struct {
+		Name string `db:"name"`
+		quantity.Measure
+	}
+	err := r.db.SelectContext(ctx, &rows, `
+		WITH matched AS (
+			SELECT DISTINCT ON (n.name) n.name, lm.ingredient_type
+			FROM unnest($1::text[]) AS n(name)
+			JOIN local_measures lm ON n.name ~* lm.pattern
+			ORDER BY n.name, lm.priority DESC, lm.ingredient_type
+		)
+		SELECT m.name, lm.unit, lm.grams, lm.millilitres
+		FROM matched m
+		JOIN local_measures lm ON lm.ingredient_type = m.ingredient_type`, pq.Array(names))
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get local measures")
+	}
+
+	measures := make(map[string][]quantity.Measure)
+	for _, row := range rows {
+		measures[row.Name] = append(measures[row.Name], row.Measure)
+	}
+	return measures, nil
+}
+
+func (r *Repository) GetMealPlanPlaceholders(householdID string, weekStartDate time.Time) ([]MealPlanPlaceholderDTO, error) {
 	var placeholders []MealPlanPlaceholderDTO
 	query := `
-        SELECT DISTINCT ON (day_of_week) day_of_week, week_start_date, image_url
+        SELECT DISTINCT ON (day_of_week) day_of_week, week_start_date, image_url, servings
         FROM meal_plans
-        WHERE user_id = $1 AND week_start_date = $2
+        WHERE household_id = $1 AND week_start_date = $2
         ORDER BY day_of_week`
-	err := r.db.Select(&placeholders, query, userID, weekStartDate)
+	err := r.db.Select(&placeholders, query, householdID, weekStartDate)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, liberror.New("No meal plan placeholders found for the specified week", http.StatusNotFound)
@@ -148,13 +246,44 @@ func (r *Repository) GetMealPlanPlaceholders(userID string, weekStartDate time.T
 	return placeholders, nil
 }
 
-func (r *Repository) RecommendRecipes(ctx context.Context, userID uuid.UUID, limit int, mealType string) ([]recipe.Recipe, error) {
+func (r *Repository) GetPlanningProfile(ctx context.Context, userID string) (*PlanningProfile, error) {
+	var profile PlanningProfile
+	err := r.db.GetContext(ctx, &profile, `
+		SELECT hm.household_id, u.household_size, u.timezone, u.units,
+			ARRAY(SELECT m.user_id::text FROM household_members m WHERE m.household_id = hm.household_id) AS member_ids
+		FROM users u
+		JOIN household_members hm ON hm.user_id = u.id
+		WHERE u.id = $1`, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, liberror.New("No user found with the specified ID", http.StatusNotFound)
+		}
+		return nil, errors.Wrap(err, "GetContext: failed to get planning profile")
+	}
+	return &profile, nil
+}
+
+// RecommendRecipes recommends from the merged likes of userIDs, usually
+// every member of a household.
+func (r *Repository) RecommendRecipes(ctx context.Context, userIDs []string, limit int, mealType string) ([]recipe.Recipe, error) {
+	return r.rankedRecipes(ctx, "recommend_recipes_for_users", userIDs, limit, mealType)
+}
+
+// PopularRecipes picks popular recipes that suit the merged profile of
+// userIDs. It needs no likes, so it fills in for new users.
+func (r *Repository) PopularRecipes(ctx context.Context, userIDs []string, limit int, mealType string) ([]recipe.Recipe, error) {
+	return r.rankedRecipes(ctx, "popular_recipes_for_users", userIDs, limit, mealType)
+}
+
+// rankedRecipes loads the recipes returned by source, a SQL function taking
+// (user IDs, limit, meal type) and returning (recipe_id, similarity).
+func (r *Repository) rankedRecipes(ctx context.Context, source string, userIDs []string, limit int, mealType string) ([]recipe.Recipe, error) {
 	var recipes []recipe.Recipe
 
 	query := `
     WITH recommended AS (
         SELECT recipe_id, similarity
-        FROM recommend_recipes($1, $2, $3)
+        FROM ` + source + `($1::uuid[], $2, $3)
     )
     SELECT
         r.id,
@@ -175,7 +304,7 @@ func (r *Repository) RecommendRecipes(ctx context.Context, userID uuid.UUID, lim
     LIMIT $2;
     `
 
-	err := r.db.SelectContext(ctx, &recipes, query, userID, limit, mealType)
+	err := r.db.SelectContext(ctx, &recipes, query, pq.Array(userIDs), limit, mealType)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, liberror.New("No recommended recipes found", http.StatusNotFound)
@@ -7,13 +7,15 @@ import (
 )
 
 type Resource struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	authn *auth.Authenticator
 }
 
 // NewResource creates and returns a resource.
-func NewResource(db *sqlx.DB) *Resource {
+func NewResource(db *sqlx.DB, authn *auth.Authenticator) *Resource {
 	return &Resource{
-		db: db,
+		db:    db,
+		authn: authn,
 	}
 }
 
@@ -24,12 +26,13 @@ func (rs *Resource) Router() *chi.Mux {
 	svc := NewService(repo)
 	hndlr := NewHandler(svc)
 
-	r.Use(auth.MustAuthMiddleware)
+	r.Use(rs.authn.MustAuthMiddleware)
 
 	//r.Post("/meal-plans", hndlr.save)
 	//r.Get("/meal-plans", hndlr.get)
-	r.Post("/generate", hndlr.generate)
+	r.With(auth.RequireWriteScope).Post("/generate", hndlr.generate)
 	r.Get("/view-weekly-plan", hndlr.get)
+	r.Get("/shopping-list", hndlr.shoppingList)
 	r.Get("/", hndlr.GetMealPlansForDay)
 
 	return r
@@ -3,12 +3,13 @@ package mealplan
 import (
 	liberror "Food/internal/errors"
 	"Food/pkg"
+	"Food/pkg/quantity"
 	"Food/pkg/recipe"
 	"context"
-	"fmt"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"strings"
 	"time"
 )
 
@@ -20,12 +21,19 @@ func NewService(repo *Repository) *Service {
 	return &Service{repo: repo}
 }
 
-func (s *Service) getMealPlan(userID string, weekStartDate time.Time) ([]MealPlanPlaceholderDTO, error) {
-	placeholders, err := s.repo.GetMealPlanPlaceholders(userID, weekStartDate)
+func (s *Service) planningProfile(ctx context.Context, userID string) (*PlanningProfile, error) {
+	profile, err := s.repo.GetPlanningProfile(ctx, userID)
+	return profile, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("mealplan.planningProfile", "mealplan.GetPlanningProfile", userID).WithError(err))
+}
+
+func (s *Service) getMealPlan(profile *PlanningProfile, weekStartDate time.Time) ([]MealPlanPlaceholderDTO, error) {
+	placeholders, err := s.repo.GetMealPlanPlaceholders(profile.HouseholdID, weekStartDate)
 	if err != nil {
 		return nil, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
-			pkg.Log("mealplan.getMealPlan", "mealplan.GetMealPlanPlaceholders", userID, log.Fields{
+			pkg.Log("mealplan.getMealPlan", "mealplan.GetMealPlanPlaceholders", profile.HouseholdID, log.Fields{
 				"week_start_date": weekStartDate,
 			}).WithError(err))
 	}
@@ -33,10 +41,12 @@ func (s *Service) getMealPlan(userID string, weekStartDate time.Time) ([]MealPla
 	return placeholders, nil
 }
 
-func (s *Service) generateMealPlans(ctx context.Context, userID uuid.UUID, weekStartDate time.Time) ([]MealPlanPlaceholderDTO, error) {
-	recommendedMealPlans, err := s.callRecommendationEngine(ctx, userID, weekStartDate)
+// generateMealPlans plans the household's week. It reports false when the
+// catalogue had no suitable recipe for some meals, which are left unplanned.
+func (s *Service) generateMealPlans(ctx context.Context, userID uuid.UUID, profile *PlanningProfile, weekStartDate time.Time) ([]MealPlanPlaceholderDTO, bool, error) {
+	recommendedMealPlans, complete, err := s.callRecommendationEngine(ctx, userID, profile.MemberIDs, weekStartDate)
 	if err != nil {
-		return nil, liberror.CoverErr(err,
+		return nil, false, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
 			pkg.Log("mealplan.generateMealPlans", "mealplan.callRecommendationEngine", userID.String(), log.Fields{
 				"week_start_date": weekStartDate,
@@ -45,44 +55,38 @@ func (s *Service) generateMealPlans(ctx context.Context, userID uuid.UUID, weekS
 
 	for i := range recommendedMealPlans {
 		recommendedMealPlans[i].WeekStartDate = weekStartDate
+		recommendedMealPlans[i].HouseholdID = profile.HouseholdID
+		recommendedMealPlans[i].Servings = profile.Servings()
 	}
 
-	err = s.repo.save(ctx, recommendedMealPlans)
+	err = s.repo.save(ctx, profile.HouseholdID, weekStartDate, recommendedMealPlans)
 	if err != nil {
-		return nil, liberror.CoverErr(err,
+		return nil, false, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
 			pkg.Log("mealplan.generateMealPlans", "mealplan.save", userID.String(), log.Fields{
 				"week_start_date": weekStartDate,
 			}).WithError(err))
 	}
 
-	placeholders, err := s.repo.GetMealPlanPlaceholders(userID.String(), weekStartDate)
+	placeholders, err := s.repo.GetMealPlanPlaceholders(profile.HouseholdID, weekStartDate)
 	if err != nil {
-		return nil, liberror.CoverErr(err,
+		return nil, false, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
 			pkg.Log("mealplan.generateMealPlans", "mealplan.GetMealPlanPlaceholders", userID.String(), log.Fields{
 				"week_start_date": weekStartDate,
 			}).WithError(err))
 	}
 
-	return placeholders, nil
+	return placeholders, complete, nil
 }
 
-func (s *Service) GetMealPlansForDay(userID string, dayOfWeek DayOfWeek, weekStartDate time.Time) ([]DetailedMealPlanDTO, error) {
-	recipes, err := s.repo.GetMealPlansForDay(userID, dayOfWeek, weekStartDate)
+func (s *Service) GetMealPlansForDay(profile *PlanningProfile, dayOfWeek DayOfWeek, weekStartDate time.Time) ([]DetailedMealPlanDTO, error) {
+	householdID := profile.HouseholdID
+	recipes, err := s.repo.GetMealPlansForDay(householdID, dayOfWeek, weekStartDate)
 	if err != nil {
 		return nil, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
-			pkg.Log("mealplan.GetMealPlansForDay", "mealplan.GetMealPlansForDay", userID, log.Fields{
-				"day_of_week":     dayOfWeek,
-				"week_start_date": weekStartDate,
-			}).WithError(err))
-	}
-
-	if len(recipes) != 3 {
-		return nil, liberror.CoverErr(fmt.Errorf("expected 3 recipes, got %d", len(recipes)),
-			errors.New("service temporarily unavailable. Please try again later"),
-			pkg.Log("mealplan.GetMealPlansForDay", "mealplan.GetMealPlansForDay", userID, log.Fields{
+			pkg.Log("mealplan.GetMealPlansForDay", "mealplan.GetMealPlansForDay", householdID, log.Fields{
 				"day_of_week":     dayOfWeek,
 				"week_start_date": weekStartDate,
 			}).WithError(err))
@@ -97,7 +101,7 @@ func (s *Service) GetMealPlansForDay(userID string, dayOfWeek DayOfWeek, weekSta
 	if err != nil {
 		return nil, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
-			pkg.Log("mealplan.GetMealPlansForDay", "mealplan.GetIngredientsForRecipes", userID, log.Fields{
+			pkg.Log("mealplan.GetMealPlansForDay", "mealplan.GetIngredientsForRecipes", householdID, log.Fields{
 				"day_of_week":     dayOfWeek,
 				"week_start_date": weekStartDate,
 			}).WithError(err))
@@ -105,6 +109,9 @@ func (s *Service) GetMealPlansForDay(userID string, dayOfWeek DayOfWeek, weekSta
 
 	for i, recipe := range recipes {
 		if ingredients, ok := ingredientsMap[recipe.ID]; ok {
+			for j, ingredient := range ingredients {
+				ingredients[j].Display = quantity.Localize(quantity.Parse(ingredient.Quantity), profile.Units).Format()
+			}
 			recipes[i].Ingredients = ingredients
 		}
 	}
@@ -112,15 +119,169 @@ func (s *Service) GetMealPlansForDay(userID string, dayOfWeek DayOfWeek, weekSta
 	return recipes, nil
 }
 
-func (s *Service) callRecommendationEngine(ctx context.Context, userID uuid.UUID, weekStartDate time.Time) (MealPlans, error) {
-	// Function to recommend recipes based on meal type
+// shoppingList adds up the ingredients of the week's meal plans. In the
+// market system, grains and garri are totalled in derica, mudu and the like
+// and everything else in metric units.
+func (s *Service) shoppingList(ctx context.Context, profile *PlanningProfile, weekStartDate time.Time, system string) (*ShoppingList, error) {
+	fail := func(repoMethod string, err error) error {
+		return liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("mealplan.shoppingList", repoMethod, profile.HouseholdID, log.Fields{
+				"week_start_date": weekStartDate,
+			}).WithError(err))
+	}
+
+	planned, err := s.repo.GetPlannedIngredients(ctx, profile.HouseholdID, weekStartDate)
+	if err != nil {
+		return nil, fail("mealplan.GetPlannedIngredients", err)
+	}
+
+	// Ingredients are grouped by name regardless of case, in the order the
+	// query returned them.
+	var names []string
+	byName := make(map[string][]quantity.Quantity)
+	for _, p := range planned {
+		key := strings.ToLower(p.Name)
+		if _, ok := byName[key]; !ok {
+			names = append(names, p.Name)
+		}
+		q := quantity.Quantity{Text: p.Quantity, Amount: p.Amount, AmountMax: p.AmountMax, Unit: p.Unit, Note: p.Note}
+		if !p.Parsed {
+			q = quantity.Parse(p.Quantity)
+		}
+		byName[key] = append(byName[key], q)
+	}
+
+	measures := map[string][]quantity.Measure{}
+	if len(names) > 0 {
+		measures, err = s.repo.GetLocalMeasures(ctx, names)
+		if err != nil {
+			return nil, fail("mealplan.GetLocalMeasures", err)
+		}
+	}
+
+	list := ShoppingList{WeekStartDate: weekStartDate, Units: system, Items: []ShoppingItem{}}
+	for _, name := range names {
+		list.Items = append(list.Items, shoppingItem(name, byName[strings.ToLower(name)], measures[name], system))
+	}
+	return &list, nil
+}
+
+// shoppingItem totals the quantities of one ingredient. Weights and volumes
+// are added up, and volumes become weights when the ingredient's density is
+// known. Counts are added up per unit and anything else is kept as written.
+func shoppingItem(name string, quantities []quantity.Quantity, measures []quantity.Measure, system string) ShoppingItem {
+	var mass, volume float64
+	var countUnits []string
+	counts := make(map[string]float64)
+	var asWritten []quantity.Quantity
+	for _, q := range quantities {
+		if amount, kind, ok := quantity.Base(q, measures); ok {
+			if kind == quantity.Mass {
+				mass += amount
+			} else {
+				volume += amount
+			}
+			continue
+		}
+		if q.Amount == nil {
+			if q.Text != "" && !containsText(asWritten, q.Text) {
+				asWritten = append(asWritten, quantity.Quantity{Text: q.Text, Note: q.Note})
+			}
+			continue
+		}
+		amount := *q.Amount
+		if q.AmountMax != nil {
+			amount = *q.AmountMax
+		}
+		if _, ok := counts[q.Unit]; !ok {
+			countUnits = append(countUnits, q.Unit)
+		}
+		counts[q.Unit] += amount
+	}
+
+	if density, ok := quantity.Density(name); ok && volume > 0 && (mass > 0 || system == quantity.Market && len(measures) > 0) {
+		mass += volume * density
+		volume = 0
+	}
+
+	item := ShoppingItem{Name: name}
+	for _, total := range []struct {
+		amount float64
+		kind   quantity.Kind
+	}{{mass, quantity.Mass}, {volume, quantity.Volume}} {
+		if total.amount == 0 {
+			continue
+		}
+		q, ok := quantity.Quantity{}, false
+		if system == quantity.Market {
+			q, ok = quantity.InMeasures(total.amount, total.kind, measures)
+		}
+		if !ok {
+			q = quantity.Express(total.amount, total.kind, system)
+		}
+		item.Quantities = append(item.Quantities, q)
+	}
+	for _, unit := range countUnits {
+		amount := counts[unit]
+		item.Quantities = append(item.Quantities, quantity.Quantity{Amount: &amount, Unit: unit})
+	}
+	item.Quantities = append(item.Quantities, asWritten...)
+
+	phrases := make([]string, len(item.Quantities))
+	for i := range item.Quantities {
+		item.Quantities[i].Text = item.Quantities[i].Format()
+		phrases[i] = phrase(item.Quantities[i], name)
+	}
+	item.Display = strings.Join(phrases, ", ")
+	return item
+}
+
+// phrase writes one total of an ingredient, such as "3 derica of beans",
+// "2 onions" or "salt, to taste".
+func phrase(q quantity.Quantity, name string) string {
+	switch {
+	case q.Amount == nil:
+		return name + ", " + q.Text
+	case q.Unit == "":
+		return q.Text + " " + name
+	case strings.Contains(strings.ToLower(q.Text), strings.ToLower(name)):
+		// "2 garri cups" already says what is measured.
+		return q.Text
+	default:
+		return q.Text + " of " + name
+	}
+}
+
+func containsText(quantities []quantity.Quantity, text string) bool {
+	for _, q := range quantities {
+		if strings.EqualFold(q.Text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) callRecommendationEngine(ctx context.Context, userID uuid.UUID, memberIDs []string, weekStartDate time.Time) (MealPlans, bool, error) {
+	// Function to recommend recipes based on meal type. Households with few
+	// likes get few recommendations, so the rest of the week is filled with
+	// popular recipes that suit their profile.
 	recommendByMealType := func(mealType string, limit int) ([]recipe.Recipe, error) {
-		return s.repo.RecommendRecipes(ctx, userID, limit, mealType)
+		recipes, err := s.repo.RecommendRecipes(ctx, memberIDs, limit, mealType)
+		if err != nil || len(recipes) >= limit {
+			return recipes, err
+		}
+
+		fallback, err := s.repo.PopularRecipes(ctx, memberIDs, limit, mealType)
+		if err != nil {
+			return nil, err
+		}
+		return topUp(recipes, fallback, limit), nil
 	}
 
 	breakfastRecipes, err := recommendByMealType("Breakfast", 7)
 	if err != nil {
-		return nil, liberror.CoverErr(err,
+		return nil, false, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
 			pkg.Log("mealplan.callRecommendationEngine", "mealplan.RecommendRecipes", userID.String(), log.Fields{
 				"week_start_date": weekStartDate,
@@ -129,7 +290,7 @@ func (s *Service) callRecommendationEngine(ctx context.Context, userID uuid.UUID
 
 	lunchRecipes, err := recommendByMealType("Lunch", 7)
 	if err != nil {
-		return nil, liberror.CoverErr(err,
+		return nil, false, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
 			pkg.Log("mealplan.callRecommendationEngine", "mealplan.RecommendRecipes", userID.String(), log.Fields{
 				"week_start_date": weekStartDate,
@@ -138,53 +299,66 @@ func (s *Service) callRecommendationEngine(ctx context.Context, userID uuid.UUID
 
 	dinnerRecipes, err := recommendByMealType("Dinner", 7)
 	if err != nil {
-		return nil, liberror.CoverErr(err,
+		return nil, false, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
 			pkg.Log("mealplan.callRecommendationEngine", "mealplan.RecommendRecipes", userID.String(), log.Fields{
 				"week_start_date": weekStartDate,
 			}).WithError(err))
 	}
 
-	// Ensure we have exactly 7 recipes for each meal type
-	if len(breakfastRecipes) != 7 || len(lunchRecipes) != 7 || len(dinnerRecipes) != 7 {
-		return nil, liberror.CoverErr(fmt.Errorf("expected 7 recipes for each meal type, got %d breakfast, %d lunch, %d dinner", len(breakfastRecipes), len(lunchRecipes), len(dinnerRecipes)),
-			errors.New("service temporarily unavailable. Please try again later"),
-			pkg.Log("mealplan.callRecommendationEngine", "mealplan.RecommendRecipes", userID.String(), log.Fields{
-				"week_start_date": weekStartDate,
-			}).WithError(err))
-	}
+	mealPlans, complete := planWeek(userID.String(), weekStartDate, map[MealType][]recipe.Recipe{
+		Breakfast: breakfastRecipes,
+		Lunch:     lunchRecipes,
+		Dinner:    dinnerRecipes,
+	})
+	return mealPlans, complete, nil
+}
 
-	mealPlans := MealPlans{}
-	daysOfWeek := []DayOfWeek{Monday, Tuesday, Wednesday, Thursday, Friday, Saturday, Sunday}
+var daysOfWeek = []DayOfWeek{Monday, Tuesday, Wednesday, Thursday, Friday, Saturday, Sunday}
+
+var mealTypes = []MealType{Breakfast, Lunch, Dinner}
 
+// planWeek puts a recipe on every meal of the week. A small catalogue or
+// strict diet and allergen filters can leave fewer than seven recipes for a
+// meal, so recipes are repeated to fill the week, and a meal with no
+// recipes at all is left out. It reports whether every meal was planned.
+func planWeek(userID string, weekStartDate time.Time, recipes map[MealType][]recipe.Recipe) (MealPlans, bool) {
+	mealPlans := MealPlans{}
+	complete := true
 	for i, day := range daysOfWeek {
-		mealPlans = append(mealPlans, MealPlan{
-			UserID:        userID.String(),
-			DayOfWeek:     day,
-			MealType:      Breakfast,
-			RecipeID:      breakfastRecipes[i].Id,
-			WeekStartDate: weekStartDate,
-			ImageURL:      breakfastRecipes[i].ImgUrl,
-		})
-
-		mealPlans = append(mealPlans, MealPlan{
-			UserID:        userID.String(),
-			DayOfWeek:     day,
-			MealType:      Lunch,
-			RecipeID:      lunchRecipes[i].Id,
-			WeekStartDate: weekStartDate,
-			ImageURL:      lunchRecipes[i].ImgUrl,
-		})
-
-		mealPlans = append(mealPlans, MealPlan{
-			UserID:        userID.String(),
-			DayOfWeek:     day,
-			MealType:      Dinner,
-			RecipeID:      dinnerRecipes[i].Id,
-			WeekStartDate: weekStartDate,
-			ImageURL:      dinnerRecipes[i].ImgUrl,
-		})
-	}
-
-	return mealPlans, nil
+		for _, mealType := range mealTypes {
+			choices := recipes[mealType]
+			if len(choices) == 0 {
+				complete = false
+				continue
+			}
+			r := choices[i%len(choices)]
+			mealPlans = append(mealPlans, MealPlan{
+				UserID:        userID,
+				DayOfWeek:     day,
+				MealType:      mealType,
+				RecipeID:      r.Id,
+				WeekStartDate: weekStartDate,
+				ImageURL:      r.ImgUrl,
+			})
+		}
+	}
+	return mealPlans, complete
+}
+
+func topUp(recipes, fallback []recipe.Recipe, limit int) []recipe.Recipe {
+	seen := make(map[string]bool, len(recipes))
+	for _, r := range recipes {
+		seen[r.Id] = true
+	}
+	for _, r := range fallback {
+		if len(recipes) >= limit {
+			break
+		}
+		if !seen[r.Id] {
+			seen[r.Id] = true
+			recipes = append(recipes, r)
+		}
+	}
+	return recipes
 }
@@ -0,0 +1,203 @@
+package mealplan
+
+import (
+	"Food/pkg/quantity"
+	"Food/pkg/recipe"
+	"testing"
+	"time"
+)
+
+func recipes(ids ...string) []recipe.Recipe {
+	var rs []recipe.Recipe
+	for _, id := range ids {
+		rs = append(rs, recipe.Recipe{Id: id})
+	}
+	return rs
+}
+
+func TestPlanWeek(t *testing.T) {
+	week := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		recipes  map[MealType][]recipe.Recipe
+		plans    int
+		complete bool
+		// want is the recipe planned for each meal on Monday to Sunday; an
+		// empty string means the meal is left out.
+		want map[MealType][7]string
+	}{
+		{
+			name: "full catalogue",
+			recipes: map[MealType][]recipe.Recipe{
+				Breakfast: recipes("b1", "b2", "b3", "b4", "b5", "b6", "b7"),
+				Lunch:     recipes("l1", "l2", "l3", "l4", "l5", "l6", "l7"),
+				Dinner:    recipes("d1", "d2", "d3", "d4", "d5", "d6", "d7"),
+			},
+			plans:    21,
+			complete: true,
+			want: map[MealType][7]string{
+				Breakfast: {"b1", "b2", "b3", "b4", "b5", "b6", "b7"},
+				Dinner:    {"d1", "d2", "d3", "d4", "d5", "d6", "d7"},
+			},
+		},
+		{
+			name: "fewer than seven recipes are repeated",
+			recipes: map[MealType][]recipe.Recipe{
+				Breakfast: recipes("b1", "b2"),
+				Lunch:     recipes("l1"),
+				Dinner:    recipes("d1", "d2", "d3"),
+			},
+			plans:    21,
+			complete: true,
+			want: map[MealType][7]string{
+				Breakfast: {"b1", "b2", "b1", "b2", "b1", "b2", "b1"},
+				Lunch:     {"l1", "l1", "l1", "l1", "l1", "l1", "l1"},
+				Dinner:    {"d1", "d2", "d3", "d1", "d2", "d3", "d1"},
+			},
+		},
+		{
+			name: "a meal with no recipes is left out",
+			recipes: map[MealType][]recipe.Recipe{
+				Breakfast: recipes("b1"),
+				Dinner:    recipes("d1", "d2"),
+			},
+			plans:    14,
+			complete: false,
+			want: map[MealType][7]string{
+				Breakfast: {"b1", "b1", "b1", "b1", "b1", "b1", "b1"},
+				Lunch:     {},
+				Dinner:    {"d1", "d2", "d1", "d2", "d1", "d2", "d1"},
+			},
+		},
+		{
+			name:     "no recipes at all",
+			recipes:  map[MealType][]recipe.Recipe{},
+			plans:    0,
+			complete: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plans, complete := planWeek("user", week, tt.recipes)
+			if len(plans) != tt.plans || complete != tt.complete {
+				t.Fatalf("planWeek() = %d plans, complete %v; want %d, %v", len(plans), complete, tt.plans, tt.complete)
+			}
+
+			got := make(map[MealType][7]string)
+			for _, plan := range plans {
+				day := -1
+				for i, d := range daysOfWeek {
+					if d == plan.DayOfWeek {
+						day = i
+					}
+				}
+				if day < 0 {
+					t.Fatalf("plan for unknown day %q", plan.DayOfWeek)
+				}
+				if plan.WeekStartDate != week || plan.UserID != "user" {
+					t.Errorf("plan %+v has the wrong week or user", plan)
+				}
+				meals := got[plan.MealType]
+				meals[day] = plan.RecipeID
+				got[plan.MealType] = meals
+			}
+			for mealType, want := range tt.want {
+				if got[mealType] != want {
+					t.Errorf("%s = %v, want %v", mealType, got[mealType], want)
+				}
+			}
+		})
+	}
+}
+
+func measures(unitSizes ...float64) []quantity.Measure {
+	units := []string{"derica", "mudu", "congo", "paint bucket"}
+	var ms []quantity.Measure
+	for i := 0; i+1 < len(unitSizes); i += 2 {
+		grams, millilitres := unitSizes[i], unitSizes[i+1]
+		ms = append(ms, quantity.Measure{Unit: units[i/2], Grams: &grams, Millilitres: &millilitres})
+	}
+	return ms
+}
+
+func TestShoppingItem(t *testing.T) {
+	beans := measures(500, 650, 1350, 1750, 1540, 2000, 3080, 4000)
+	rice := measures(550, 650, 1500, 1750, 1700, 2000, 3400, 4000)
+
+	tests := []struct {
+		name       string
+		ingredient string
+		quantities []string
+		measures   []quantity.Measure
+		system     string
+		want       string
+	}{
+		{
+			name:       "grams, millilitres and derica in derica",
+			ingredient: "beans",
+			quantities: []string{"1 derica", "500 g", "400 ml"},
+			measures:   beans,
+			system:     quantity.Market,
+			want:       "3 derica of beans",
+		},
+		{
+			name:       "grams, millilitres and derica in metric",
+			ingredient: "beans",
+			quantities: []string{"1 derica", "500 g", "400 ml"},
+			measures:   beans,
+			system:     quantity.Metric,
+			want:       "1.31 kg of beans",
+		},
+		{
+			name:       "volume weighed for market measures",
+			ingredient: "rice",
+			quantities: []string{"2 cups"},
+			measures:   rice,
+			system:     quantity.Market,
+			want:       "1 derica of rice",
+		},
+		{
+			name:       "volume kept without a mass to merge into",
+			ingredient: "milk",
+			quantities: []string{"1 cup", "1 cup"},
+			system:     quantity.Metric,
+			want:       "473 ml of milk",
+		},
+		{
+			name:       "no density",
+			ingredient: "ogbono",
+			quantities: []string{"200 g", "2 tbsp"},
+			system:     quantity.Metric,
+			want:       "200 g of ogbono, 30 ml of ogbono",
+		},
+		{
+			name:       "too little for a market measure",
+			ingredient: "rice",
+			quantities: []string{"1 tbsp"},
+			measures:   rice,
+			system:     quantity.Market,
+			want:       "13 g of rice",
+		},
+		{
+			name:       "counts and amounts as written",
+			ingredient: "pepper",
+			quantities: []string{"2", "1", "to taste", "To taste"},
+			system:     quantity.Metric,
+			want:       "3 pepper, pepper, to taste",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quantities := make([]quantity.Quantity, len(tt.quantities))
+			for i, text := range tt.quantities {
+				quantities[i] = quantity.Parse(text)
+			}
+			got := shoppingItem(tt.ingredient, quantities, tt.measures, tt.system)
+			if got.Display != tt.want {
+				t.Errorf("shoppingItem() = %q, want %q", got.Display, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package onboarding
+
+import (
+	"Food/pkg"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+func (h Handler) quiz(w http.ResponseWriter, r *http.Request) {
+	recipes, err := h.svc.quiz(r.Context(), chi.URLParam(r, "id"), r.URL.Query())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    recipes,
+		Message: "Onboarding quiz retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) answer(w http.ResponseWriter, r *http.Request) {
+	var req AnswersRequest
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	result, err := h.svc.answer(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    result,
+		Message: "Onboarding answers saved successfully",
+		Code:    http.StatusOK,
+	})
+}
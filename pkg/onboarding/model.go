@@ -0,0 +1,33 @@
+package onboarding
+
+// QuizRecipe is a recipe shown to a new user to rate. The attributes are
+// what the sample is diversified over.
+type QuizRecipe struct {
+	ID          string `json:"id" db:"id"`
+	Name        string `json:"name" db:"name"`
+	Description string `json:"description" db:"description"`
+	ImgUrl      string `json:"img_url" db:"img_url"`
+	MealType    string `json:"meal_type" db:"meal_type"`
+	FoodClass   string `json:"food_class" db:"food_class"`
+	Region      string `json:"region" db:"region"`
+	SpiceLevel  string `json:"spice_level" db:"spice_level"`
+}
+
+// attributes returns the recipe_details values that make two quiz recipes
+// different from each other.
+func (q QuizRecipe) attributes() []string {
+	return []string{
+		"meal_type:" + q.MealType,
+		"food_class:" + q.FoodClass,
+		"region:" + q.Region,
+		"spice_level:" + q.SpiceLevel,
+	}
+}
+
+// AnswerResult says how the answers were applied: 4 and 5 stars become
+// likes, 1 and 2 stars dislikes, and 3 stars is only recorded.
+type AnswerResult struct {
+	Liked    int `json:"liked"`
+	Disliked int `json:"disliked"`
+	Neutral  int `json:"neutral"`
+}
@@ -0,0 +1,148 @@
+package onboarding
+
+import (
+	liberror "Food/internal/errors"
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// candidates returns a random pool of recipes with details that the user
+// could eat and has not answered or hidden yet.
+func (r *Repository) candidates(ctx context.Context, userID string, poolSize int) ([]QuizRecipe, error) {
+	recipes := []QuizRecipe{}
+	err := r.db.SelectContext(ctx, &recipes, `
+		SELECT r.id, r.name, r.description, r.img_url,
+			COALESCE(rd.meal_type, '') AS meal_type,
+			COALESCE(rd.food_class, '') AS food_class,
+			COALESCE(rd.region, '') AS region,
+			COALESCE(rd.spiciness_level, '') AS spice_level
+		FROM recipe_details rd
+		JOIN recipes r ON r.id = rd.recipe_id
+		LEFT JOIN user_preferences p ON p.user_id = $1
+		WHERE NOT EXISTS (
+				SELECT 1
+				FROM recipe_diet_conflicts c
+				WHERE c.recipe_id = r.id
+				  AND ((c.diet = 'vegetarian' AND p.vegetarian) OR (c.diet = 'gluten_free' AND p.gluten_free)))
+			AND NOT EXISTS (
+				SELECT 1
+				FROM recipe_allergens ra
+				JOIN user_allergens ua ON ua.allergen = ra.allergen
+				WHERE ra.recipe_id = r.id AND ua.user_id = $1)
+			AND NOT EXISTS (SELECT 1 FROM recipe_dislikes d WHERE d.recipe_id = r.id AND d.user_id = $1)
+			AND NOT EXISTS (SELECT 1 FROM onboarding_answers oa WHERE oa.recipe_id = r.id AND oa.user_id = $1)
+		ORDER BY random()
+		LIMIT $2`, userID, poolSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get quiz candidates")
+	}
+	return recipes, nil
+}
+
+// saveAnswers records the answers and turns them into likes and dislikes in
+// one transaction.
+func (r *Repository) saveAnswers(ctx context.Context, userID string, answers []Answer) (*AnswerResult, error) {
+	var result AnswerResult
+	recipeIDs := make([]string, len(answers))
+	ratings := make([]int64, len(answers))
+	var liked, disliked []string
+	for i, answer := range answers {
+		recipeIDs[i] = answer.RecipeID
+		ratings[i] = int64(answer.Rating)
+		switch {
+		case answer.Rating >= 4:
+			liked = append(liked, answer.RecipeID)
+			result.Liked++
+		case answer.Rating <= 2:
+			disliked = append(disliked, answer.RecipeID)
+			result.Disliked++
+		default:
+			result.Neutral++
+		}
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var unknown []string
+	err = tx.SelectContext(ctx, &unknown, `
+		SELECT id::text
+		FROM unnest($1::uuid[]) AS ids(id)
+		WHERE NOT EXISTS (SELECT 1 FROM recipes r WHERE r.id = ids.id)`, pq.Array(recipeIDs))
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to check recipe IDs")
+	}
+	if len(unknown) > 0 {
+		err = liberror.New("Unknown recipes: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO onboarding_answers (user_id, recipe_id, rating)
+		SELECT $1, a.recipe_id, a.rating
+		FROM unnest($2::uuid[], $3::smallint[]) AS a(recipe_id, rating)
+		ON CONFLICT (user_id, recipe_id) DO UPDATE
+		SET rating = EXCLUDED.rating, answered_at = CURRENT_TIMESTAMP`, userID, pq.Array(recipeIDs), pq.Array(ratings))
+	if err != nil {
+		return nil, errors.Wrap(err, "ExecContext: failed to save onboarding answers")
+	}
+
+	if len(liked) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO likes (user_id, recipe_id)
+			SELECT $1, unnest($2::uuid[])
+			ON CONFLICT DO NOTHING`, userID, pq.Array(liked))
+		if err != nil {
+			return nil, errors.Wrap(err, "ExecContext: failed to like recipes")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM recipe_dislikes WHERE user_id = $1 AND recipe_id = ANY($2::uuid[])`, userID, pq.Array(liked))
+		if err != nil {
+			return nil, errors.Wrap(err, "ExecContext: failed to clear recipe dislikes")
+		}
+	}
+
+	if len(disliked) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO recipe_dislikes (user_id, recipe_id, kind)
+			SELECT $1, unnest($2::uuid[]), 'dislike'
+			ON CONFLICT (user_id, recipe_id) DO UPDATE SET kind = 'dislike'`, userID, pq.Array(disliked))
+		if err != nil {
+			return nil, errors.Wrap(err, "ExecContext: failed to dislike recipes")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM likes WHERE user_id = $1 AND recipe_id = ANY($2::uuid[])`, userID, pq.Array(disliked))
+		if err != nil {
+			return nil, errors.Wrap(err, "ExecContext: failed to unlike recipes")
+		}
+	}
+
+	return &result, err
+}
@@ -0,0 +1,58 @@
+package onboarding
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+const maxAnswers = 50
+
+type Answer struct {
+	RecipeID string `json:"recipe_id"`
+	Rating   int    `json:"rating"`
+}
+
+type AnswersRequest struct {
+	Answers []Answer `json:"answers"`
+}
+
+func (v *AnswersRequest) Bind(r *http.Request) error {
+	// A later answer for the same recipe replaces an earlier one.
+	index := make(map[string]int, len(v.Answers))
+	answers := make([]Answer, 0, len(v.Answers))
+	valid := true
+	for _, answer := range v.Answers {
+		id, err := uuid.Parse(answer.RecipeID)
+		if err != nil || answer.Rating < 1 || answer.Rating > 5 {
+			valid = false
+			continue
+		}
+		answer.RecipeID = id.String()
+		if i, ok := index[answer.RecipeID]; ok {
+			answers[i] = answer
+			continue
+		}
+		index[answer.RecipeID] = len(answers)
+		answers = append(answers, answer)
+	}
+	v.Answers = answers
+
+	err1 := validate.Validate(
+		&validators.FuncValidator{
+			Name:    "answers",
+			Field:   "answers",
+			Message: fmt.Sprintf("%%s must hold between 1 and %d answers, each with a valid recipe_id and a rating from 1 to 5", maxAnswers),
+			Fn: func() bool {
+				return valid && len(v.Answers) > 0 && len(v.Answers) <= maxAnswers
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
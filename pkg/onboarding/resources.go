@@ -0,0 +1,35 @@
+package onboarding
+
+import (
+	"Food/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db    *sqlx.DB
+	authn *auth.Authenticator
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, authn *auth.Authenticator) *Resource {
+	return &Resource{
+		db:    db,
+		authn: authn,
+	}
+}
+
+// Router serves /users/{id}/onboarding for the user themselves.
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	repo := NewRepository(rs.db)
+	svc := NewService(repo)
+	hndlr := NewHandler(svc)
+
+	r.Use(rs.authn.MustAuthMiddleware, auth.RequireRoleOrOwner("id"))
+	r.Get("/quiz", hndlr.quiz)
+	r.With(auth.RequireWriteScope).Post("/answers", hndlr.answer)
+
+	return r
+}
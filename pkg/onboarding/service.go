@@ -0,0 +1,88 @@
+package onboarding
+
+import (
+	liberror "Food/internal/errors"
+	"Food/pkg"
+	"context"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	defaultQuizSize = 12
+	maxQuizSize     = 30
+	// quizPoolFactor sets how many random candidates the diverse sample is
+	// drawn from, as a multiple of the quiz size.
+	quizPoolFactor = 10
+)
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// quiz returns ?size= recipes (default 12) spread across meal types, food
+// classes, regions and spice levels.
+func (s Service) quiz(ctx context.Context, userID string, queryParams url.Values) ([]QuizRecipe, error) {
+	size := defaultQuizSize
+	if raw := queryParams.Get("size"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxQuizSize {
+			return nil, liberror.New("size must be between 1 and 30", http.StatusBadRequest)
+		}
+		size = n
+	}
+
+	pool, err := s.repo.candidates(ctx, userID, size*quizPoolFactor)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("onboarding.quiz", "onboarding.candidates", userID).WithError(err))
+	}
+
+	return diverseSample(pool, size), nil
+}
+
+func (s Service) answer(ctx context.Context, userID string, req AnswersRequest) (*AnswerResult, error) {
+	result, err := s.repo.saveAnswers(ctx, userID, req.Answers)
+	return result, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("onboarding.answer", "onboarding.saveAnswers", userID).WithError(err))
+}
+
+// diverseSample greedily picks the recipe whose attributes have been seen
+// least so far. The pool is in random order, which breaks ties.
+func diverseSample(pool []QuizRecipe, size int) []QuizRecipe {
+	seen := map[string]int{}
+	used := make([]bool, len(pool))
+	sample := make([]QuizRecipe, 0, size)
+
+	for len(sample) < size && len(sample) < len(pool) {
+		best, bestScore := -1, -1.0
+		for i, candidate := range pool {
+			if used[i] {
+				continue
+			}
+			score := 0.0
+			for _, attribute := range candidate.attributes() {
+				score += 1 / float64(1+seen[attribute])
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		used[best] = true
+		sample = append(sample, pool[best])
+		for _, attribute := range pool[best].attributes() {
+			seen[attribute]++
+		}
+	}
+
+	return sample
+}
@@ -0,0 +1,162 @@
+package quantity
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrUnknownUnit  = errors.New("unknown unit")
+	ErrNoAmount     = errors.New("quantity has no amount")
+	ErrIncompatible = errors.New("units measure different things")
+	ErrNoDensity    = errors.New("converting between volume and weight needs the ingredient's density")
+)
+
+// Convert expresses q in another unit. Mass and volume convert into each
+// other only when density, in grams per millilitre, is above zero.
+func Convert(q Quantity, to string, density float64) (Quantity, error) {
+	if q.Amount == nil {
+		return q, ErrNoAmount
+	}
+	from, ok := Lookup(q.Unit)
+	if !ok {
+		return q, ErrUnknownUnit
+	}
+	target, ok := Lookup(to)
+	if !ok {
+		return q, ErrUnknownUnit
+	}
+
+	ratio, err := ratio(from, target, density)
+	if err != nil {
+		return q, err
+	}
+
+	converted := q
+	converted.Unit = target.Name
+	converted.Amount = scale(q.Amount, ratio)
+	converted.AmountMax = scale(q.AmountMax, ratio)
+	return converted, nil
+}
+
+// ratio is how many of target make up one from.
+func ratio(from, target *Unit, density float64) (float64, error) {
+	if from.Kind == Count || target.Kind == Count {
+		if from == target {
+			return 1, nil
+		}
+		return 0, ErrIncompatible
+	}
+
+	base := from.Factor
+	switch {
+	case from.Kind == target.Kind:
+	case density <= 0:
+		return 0, ErrNoDensity
+	case from.Kind == Volume:
+		base *= density
+	default:
+		base /= density
+	}
+	return base / target.Factor, nil
+}
+
+func scale(amount *float64, by float64) *float64 {
+	if amount == nil {
+		return nil
+	}
+	scaled := *amount * by
+	return &scaled
+}
+
+// Localize rewrites q in the given unit system. Counts, spoons, market
+// measures and units that already belong to the system are kept as written.
+func Localize(q Quantity, system string) Quantity {
+	u, ok := Lookup(q.Unit)
+	if q.Amount == nil || !ok || u.Kind == Count || u.System == "" || u.System == Market || u.System == system {
+		return q
+	}
+
+	localized, err := Convert(q, target(u.Kind, *q.Amount*u.Factor, system), 0)
+	if err != nil {
+		return q
+	}
+	return localized
+}
+
+// Express writes an amount in grams or millilitres, as kind says, in the
+// most readable unit of the system, such as "1.5 kg" or "¾ cup".
+func Express(amount float64, kind Kind, system string) Quantity {
+	base := "g"
+	if kind == Volume {
+		base = "ml"
+	}
+	q := Quantity{Amount: &amount, Unit: base}
+	converted, err := Convert(q, target(kind, amount, system), 0)
+	if err != nil {
+		return q
+	}
+	return converted
+}
+
+// target picks the unit of system that amount, in grams or millilitres,
+// reads best in. Systems other than imperial fall back to metric.
+func target(kind Kind, amount float64, system string) string {
+	switch {
+	case kind == Mass && system == Imperial && amount >= 16*byName["oz"].Factor:
+		return "lb"
+	case kind == Mass && system == Imperial:
+		return "oz"
+	case kind == Mass && amount >= 1000:
+		return "kg"
+	case kind == Mass:
+		return "g"
+	case system != Imperial && amount >= 1000:
+		return "l"
+	case system != Imperial:
+		return "ml"
+	case amount < byName["tbsp"].Factor:
+		return "tsp"
+	case amount < byName["cup"].Factor/4:
+		return "tbsp"
+	default:
+		return "cup"
+	}
+}
+
+// densities are grams per millilitre for common ingredients, matched
+// against ingredient names in order, so more specific names come first.
+var densities = []struct {
+	pattern    *regexp.Regexp
+	gramsPerML float64
+}{
+	{regexp.MustCompile(`\bbrown sugar\b`), 0.93},
+	{regexp.MustCompile(`\bpalm oil\b`), 0.89},
+	{regexp.MustCompile(`\btomato (paste|puree)\b`), 1.1},
+	{regexp.MustCompile(`\b(water|stock|broth)\b`), 1.0},
+	{regexp.MustCompile(`\bmilk\b`), 1.03},
+	{regexp.MustCompile(`\boils?\b`), 0.92},
+	{regexp.MustCompile(`\bbutter\b`), 0.96},
+	{regexp.MustCompile(`\bhoney\b`), 1.42},
+	{regexp.MustCompile(`\bsugar\b`), 0.85},
+	{regexp.MustCompile(`\bsalt\b`), 1.2},
+	{regexp.MustCompile(`\bflour\b`), 0.53},
+	{regexp.MustCompile(`\brice\b`), 0.85},
+	{regexp.MustCompile(`\bbeans?\b`), 0.77},
+	{regexp.MustCompile(`\b(garri|gari)\b`), 0.6},
+	{regexp.MustCompile(`\bsemolina\b`), 0.6},
+	{regexp.MustCompile(`\bcrayfish\b`), 0.35},
+}
+
+// Density returns the density of the named ingredient in grams per
+// millilitre, if it is known.
+func Density(ingredient string) (float64, bool) {
+	name := strings.ToLower(ingredient)
+	for _, d := range densities {
+		if d.pattern.MatchString(name) {
+			return d.gramsPerML, true
+		}
+	}
+	return 0, false
+}
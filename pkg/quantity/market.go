@@ -0,0 +1,89 @@
+package quantity
+
+import (
+	"math"
+	"sort"
+)
+
+// Measure is what one market unit holds of a kind of ingredient, in grams,
+// millilitres or both.
+type Measure struct {
+	Unit        string   `json:"unit" db:"unit"`
+	Grams       *float64 `json:"grams" db:"grams"`
+	Millilitres *float64 `json:"millilitres" db:"millilitres"`
+}
+
+// size is how much of kind the measure holds, or zero if it is not known.
+func (m Measure) size(kind Kind) float64 {
+	switch {
+	case kind == Mass && m.Grams != nil:
+		return *m.Grams
+	case kind == Volume && m.Millilitres != nil:
+		return *m.Millilitres
+	}
+	return 0
+}
+
+// Base returns q in grams or millilitres. Market units use the ingredient's
+// measures when one matches and the usual size of the container otherwise.
+// Counts and quantities without an amount have no base.
+func Base(q Quantity, measures []Measure) (float64, Kind, bool) {
+	u, ok := Lookup(q.Unit)
+	if q.Amount == nil || !ok || u.Kind == Count {
+		return 0, Count, false
+	}
+
+	amount := *q.Amount
+	if q.AmountMax != nil {
+		// Shop for the top of a range.
+		amount = *q.AmountMax
+	}
+	if u.System == Market {
+		for _, m := range measures {
+			if m.Unit != u.Name {
+				continue
+			}
+			if grams := m.size(Mass); grams > 0 {
+				return amount * grams, Mass, true
+			}
+			if millilitres := m.size(Volume); millilitres > 0 {
+				return amount * millilitres, Volume, true
+			}
+		}
+	}
+	return amount * u.Factor, u.Kind, true
+}
+
+// InMeasures writes an amount of kind, in grams or millilitres, in the
+// largest of measures it fills at least once, rounded up to the next half
+// so the shopper buys enough. Measures are not exact, so an amount just over
+// a half is rounded down. It reports false when no measure suits, for
+// example for a spoonful of rice.
+func InMeasures(amount float64, kind Kind, measures []Measure) (Quantity, bool) {
+	fitting := make([]Measure, 0, len(measures))
+	for _, m := range measures {
+		if m.size(kind) > 0 {
+			fitting = append(fitting, m)
+		}
+	}
+	if len(fitting) == 0 {
+		return Quantity{}, false
+	}
+	sort.Slice(fitting, func(i, j int) bool {
+		return fitting[i].size(kind) > fitting[j].size(kind)
+	})
+
+	chosen := fitting[len(fitting)-1]
+	for _, m := range fitting {
+		if amount >= m.size(kind) {
+			chosen = m
+			break
+		}
+	}
+	count := amount / chosen.size(kind)
+	if count < 0.25 {
+		return Quantity{}, false
+	}
+	count = math.Max(math.Ceil(count*2-0.2)/2, 0.5)
+	return Quantity{Amount: &count, Unit: chosen.Unit}, true
+}
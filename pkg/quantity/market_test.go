@@ -0,0 +1,105 @@
+package quantity
+
+import "testing"
+
+// beans are the local_measures of beans.
+var beans = []Measure{
+	{Unit: "derica", Grams: amount(500), Millilitres: amount(650)},
+	{Unit: "mudu", Grams: amount(1350), Millilitres: amount(1750)},
+	{Unit: "congo", Grams: amount(1540), Millilitres: amount(2000)},
+	{Unit: "paint bucket", Grams: amount(3080), Millilitres: amount(4000)},
+}
+
+func TestParseMarketUnits(t *testing.T) {
+	tests := []struct {
+		text   string
+		amount float64
+		unit   string
+		note   string
+	}{
+		{"3 derica of beans", 3, "derica", "beans"},
+		{"2 dericas rice", 2, "derica", "rice"},
+		{"1 modu of garri", 1, "mudu", "garri"},
+		{"2 mudus", 2, "mudu", ""},
+		{"1 congo of maize", 1, "congo", "maize"},
+		{"½ paint rubber of rice", 0.5, "paint bucket", "rice"},
+		{"2 paint rubbers", 2, "paint bucket", ""},
+		{"1 cup of garri", 1, "garri cup", ""},
+		{"3 cups of gari", 3, "garri cup", ""},
+		{"2 cups of rice", 2, "cup", "rice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			q := Parse(tt.text)
+			if !near(q.Amount, &tt.amount) {
+				t.Errorf("amount = %v, want %v", show(q.Amount), tt.amount)
+			}
+			if q.Unit != tt.unit {
+				t.Errorf("unit = %q, want %q", q.Unit, tt.unit)
+			}
+			if q.Note != tt.note {
+				t.Errorf("note = %q, want %q", q.Note, tt.note)
+			}
+		})
+	}
+}
+
+func TestBase(t *testing.T) {
+	tests := []struct {
+		text     string
+		measures []Measure
+		amount   float64
+		kind     Kind
+		ok       bool
+	}{
+		{"2 derica", beans, 1000, Mass, true},
+		{"2 derica", nil, 1300, Volume, true},
+		{"1 garri cup", beans, 400, Volume, true},
+		{"1-2 mudu", beans, 2700, Mass, true},
+		{"500 g", beans, 500, Mass, true},
+		{"2 cups", beans, 2 * 236.5882365, Volume, true},
+		{"3 eggs", beans, 0, Count, false},
+		{"to taste", beans, 0, Count, false},
+	}
+	for _, tt := range tests {
+		amount, kind, ok := Base(Parse(tt.text), tt.measures)
+		if ok != tt.ok || kind != tt.kind || !near(&amount, &tt.amount) {
+			t.Errorf("Base(%q) = %v, %v, %v, want %v, %v, %v", tt.text, amount, kind, ok, tt.amount, tt.kind, tt.ok)
+		}
+	}
+}
+
+func TestInMeasures(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount float64
+		kind   Kind
+		want   string
+	}{
+		{"exact half", 1250, Mass, "2½ derica"},
+		{"just over a half rounds down", 1300, Mass, "2½ derica"},
+		{"well over a half rounds up", 1310, Mass, "3 derica"},
+		{"just over a whole rounds down", 1400, Mass, "1 mudu"},
+		{"largest measure filled", 1500, Mass, "1½ mudu"},
+		{"whole measures", 6160, Mass, "2 paint buckets"},
+		{"at least half a measure", 150, Mass, "½ derica"},
+		{"by volume", 1300, Volume, "2 derica"},
+		{"too little", 100, Mass, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, ok := InMeasures(tt.amount, tt.kind, beans)
+			got := ""
+			if ok {
+				got = q.Format()
+			}
+			if got != tt.want {
+				t.Errorf("InMeasures(%v) = %q, want %q", tt.amount, got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := InMeasures(1000, Mass, []Measure{{Unit: "garri cup", Millilitres: amount(400)}}); ok {
+		t.Error("InMeasures with volume-only measures wrote a mass")
+	}
+}
@@ -0,0 +1,217 @@
+package quantity
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Quantity is a parsed ingredient quantity such as "1½ cups, sifted".
+// Amount is nil when the text has no amount ("to taste"). AmountMax is set
+// for ranges such as "2-3". Unit is a canonical unit name, or empty for
+// plain counts ("2 onions").
+type Quantity struct {
+	Text      string   `json:"text"`
+	Amount    *float64 `json:"amount"`
+	AmountMax *float64 `json:"amount_max"`
+	Unit      string   `json:"unit"`
+	Note      string   `json:"note"`
+}
+
+var vulgarFractions = map[rune]string{
+	'½': "1/2", '⅓': "1/3", '⅔': "2/3", '¼': "1/4", '¾': "3/4",
+	'⅕': "1/5", '⅖': "2/5", '⅗': "3/5", '⅘': "4/5", '⅙': "1/6",
+	'⅚': "5/6", '⅛': "1/8", '⅜': "3/8", '⅝': "5/8", '⅞': "7/8",
+}
+
+var (
+	amountPattern = regexp.MustCompile(`^(\d+ \d+/\d+|\d+/\d+|\d+(?:[.,]\d+)?)`)
+	rangePattern  = regexp.MustCompile(`^(?:-|to |or )\s*`)
+	notePrefix    = regexp.MustCompile(`^(?:of\s+|[,.;:]\s*)+`)
+)
+
+// Parse reads an amount, a unit and a note from free text. It never fails:
+// whatever it does not understand ends up in Note.
+func Parse(text string) Quantity {
+	q := Quantity{Text: strings.TrimSpace(text)}
+	rest := normalise(q.Text)
+
+	if amount, remainder, ok := parseAmount(rest); ok {
+		q.Amount = &amount
+		rest = remainder
+		if m := rangePattern.FindString(rest); m != "" {
+			if max, remainder, ok := parseAmount(rest[len(m):]); ok && max > amount {
+				q.AmountMax = &max
+				rest = remainder
+			}
+		}
+	} else if article := articlePrefix(rest); article != "" {
+		// "a pinch of salt" has an amount of one, but "a little oil" has none.
+		if u, remainder, ok := parseUnit(rest[len(article):]); ok {
+			one := 1.0
+			q.Amount, q.Unit, rest = &one, u.Name, remainder
+		}
+	}
+
+	if q.Amount != nil && q.Unit == "" {
+		if u, remainder, ok := parseUnit(rest); ok {
+			q.Unit, rest = u.Name, remainder
+		}
+	}
+
+	q.Note = strings.TrimSpace(notePrefix.ReplaceAllString(strings.TrimSpace(rest), ""))
+	return q
+}
+
+// normalise lowercases text, spells out fractions such as "1½" as "1 1/2",
+// turns dashes into hyphens and collapses whitespace.
+func normalise(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if fraction, ok := vulgarFractions[r]; ok {
+			b.WriteString(" " + fraction + " ")
+			continue
+		}
+		switch r {
+		case '–', '—', '‒':
+			r = '-'
+		case '⁄':
+			r = '/'
+		}
+		b.WriteRune(r)
+	}
+
+	normalised := strings.Join(strings.Fields(b.String()), " ")
+	// Put ranges written with spaces, "2 - 3", in the same form as "2-3".
+	normalised = strings.ReplaceAll(normalised, " - ", "-")
+	return strings.ReplaceAll(normalised, " / ", "/")
+}
+
+func parseAmount(text string) (float64, string, bool) {
+	m := amountPattern.FindString(text)
+	if m == "" {
+		return 0, text, false
+	}
+
+	var amount float64
+	for _, part := range strings.Fields(m) {
+		if numerator, denominator, ok := strings.Cut(part, "/"); ok {
+			n, _ := strconv.ParseFloat(numerator, 64)
+			d, _ := strconv.ParseFloat(denominator, 64)
+			if d == 0 {
+				return 0, text, false
+			}
+			amount += n / d
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.Replace(part, ",", ".", 1), 64)
+		if err != nil {
+			return 0, text, false
+		}
+		amount += value
+	}
+
+	return amount, strings.TrimSpace(text[len(m):]), true
+}
+
+func articlePrefix(text string) string {
+	for _, article := range []string{"a ", "an "} {
+		if strings.HasPrefix(text, article) {
+			return article
+		}
+	}
+	return ""
+}
+
+// parseUnit matches a unit at the start of text. The unit must end at a word
+// boundary so "g" does not match "garlic".
+func parseUnit(text string) (*Unit, string, bool) {
+	for _, a := range aliases {
+		if !strings.HasPrefix(text, a.text) {
+			continue
+		}
+		remainder := text[len(a.text):]
+		remainder = strings.TrimPrefix(remainder, ".")
+		if next, _ := firstRune(remainder); unicode.IsLetter(next) {
+			continue
+		}
+		return a.unit, strings.TrimSpace(remainder), true
+	}
+	return nil, text, false
+}
+
+func firstRune(text string) (rune, bool) {
+	for _, r := range text {
+		return r, true
+	}
+	return 0, false
+}
+
+// Format writes the quantity back out, for example "1½ cups" or
+// "500 g, chopped". Quantities without an amount are returned as written.
+func (q Quantity) Format() string {
+	if q.Amount == nil {
+		return q.Text
+	}
+
+	u, _ := Lookup(q.Unit)
+	amount := formatAmount(*q.Amount, u)
+	top := *q.Amount
+	if q.AmountMax != nil {
+		amount += "-" + formatAmount(*q.AmountMax, u)
+		top = *q.AmountMax
+	}
+
+	parts := []string{amount}
+	if u != nil {
+		parts = append(parts, u.label(top))
+	}
+	text := strings.Join(parts, " ")
+	if q.Note != "" {
+		text += " " + q.Note
+	}
+	return text
+}
+
+// formatAmount writes metric amounts as decimals and everything else, which
+// is usually measured with cups and spoons, as common fractions.
+func formatAmount(amount float64, u *Unit) string {
+	if u != nil && u.System == Metric || amount >= 10 {
+		precision := 2
+		if amount >= 10 {
+			precision = 0
+		}
+		return strconv.FormatFloat(round(amount, precision), 'f', -1, 64)
+	}
+
+	whole, fraction := math.Modf(amount)
+	glyph := ""
+	best := fraction
+	for _, f := range []struct {
+		value float64
+		glyph string
+	}{{0.125, "⅛"}, {0.25, "¼"}, {1.0 / 3, "⅓"}, {0.375, "⅜"}, {0.5, "½"}, {0.625, "⅝"}, {2.0 / 3, "⅔"}, {0.75, "¾"}, {0.875, "⅞"}, {1, ""}} {
+		if d := math.Abs(fraction - f.value); d < best {
+			best, glyph = d, f.glyph
+			if f.value == 1 {
+				whole, glyph = whole+1, ""
+			}
+		}
+	}
+
+	switch {
+	case whole == 0 && glyph == "":
+		return strconv.FormatFloat(round(amount, 2), 'f', -1, 64)
+	case whole == 0:
+		return glyph
+	default:
+		return strconv.FormatFloat(whole, 'f', -1, 64) + glyph
+	}
+}
+
+func round(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
@@ -0,0 +1,168 @@
+package quantity
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func amount(v float64) *float64 {
+	return &v
+}
+
+// near reports whether the amounts are both nil or within a rounding error
+// of each other.
+func near(got, want *float64) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return math.Abs(*got-*want) < 1e-6
+}
+
+func show(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text      string
+		amount    *float64
+		amountMax *float64
+		unit      string
+		note      string
+	}{
+		{"1½ cups", amount(1.5), nil, "cup", ""},
+		{"1 ½ cups, sifted", amount(1.5), nil, "cup", "sifted"},
+		{"2-3 tbsp", amount(2), amount(3), "tbsp", ""},
+		{"2 – 3 Tbsp.", amount(2), amount(3), "tbsp", ""},
+		{"500g chopped", amount(500), nil, "g", "chopped"},
+		{"1,5 l water", amount(1.5), nil, "l", "water"},
+		{"a pinch of salt", amount(1), nil, "pinch", "salt"},
+		{"a little oil", nil, nil, "", "a little oil"},
+		{"3 large eggs", amount(3), nil, "", "large eggs"},
+		{"2 tinned tomatoes", amount(2), nil, "", "tinned tomatoes"},
+		{"2 garlic cloves", amount(2), nil, "", "garlic cloves"},
+		{"1/0 cup", nil, nil, "", "1/0 cup"},
+		{"to taste", nil, nil, "", "to taste"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			q := Parse(tt.text)
+			if !near(q.Amount, tt.amount) {
+				t.Errorf("amount = %v, want %v", show(q.Amount), show(tt.amount))
+			}
+			if !near(q.AmountMax, tt.amountMax) {
+				t.Errorf("amount_max = %v, want %v", show(q.AmountMax), show(tt.amountMax))
+			}
+			if q.Unit != tt.unit {
+				t.Errorf("unit = %q, want %q", q.Unit, tt.unit)
+			}
+			if q.Note != tt.note {
+				t.Errorf("note = %q, want %q", q.Note, tt.note)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"1½ cups", "1½ cups"},
+		{"1 cup", "1 cup"},
+		{"2-3 tbsp", "2-3 tbsp"},
+		{"500g, chopped", "500 g chopped"},
+		{"to taste", "to taste"},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.text).Format(); got != tt.want {
+			t.Errorf("Parse(%q).Format() = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		to        string
+		density   float64
+		amount    *float64
+		amountMax *float64
+		err       error
+	}{
+		{name: "metric to imperial", text: "1 kg", to: "lb", amount: amount(1000 / 453.59237)},
+		{name: "imperial to metric", text: "1 cup", to: "ml", amount: amount(236.5882365)},
+		{name: "range", text: "2-3 tbsp", to: "ml", amount: amount(2 * 14.78676478125), amountMax: amount(3 * 14.78676478125)},
+		{name: "volume to weight", text: "1 cup", to: "g", density: 0.53, amount: amount(236.5882365 * 0.53)},
+		{name: "weight to volume", text: "92 g", to: "ml", density: 0.92, amount: amount(100)},
+		{name: "volume to weight without density", text: "1 cup", to: "g", err: ErrNoDensity},
+		{name: "count", text: "3 eggs", to: "g", density: 1, err: ErrUnknownUnit},
+		{name: "count unit", text: "2 cloves", to: "g", density: 1, err: ErrIncompatible},
+		{name: "no amount", text: "to taste", to: "g", err: ErrNoAmount},
+		{name: "unknown target", text: "1 cup", to: "bushel", err: ErrUnknownUnit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Convert(Parse(tt.text), tt.to, tt.density)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if q.Unit != tt.to {
+				t.Errorf("unit = %q, want %q", q.Unit, tt.to)
+			}
+			if !near(q.Amount, tt.amount) {
+				t.Errorf("amount = %v, want %v", show(q.Amount), show(tt.amount))
+			}
+			if !near(q.AmountMax, tt.amountMax) {
+				t.Errorf("amount_max = %v, want %v", show(q.AmountMax), show(tt.amountMax))
+			}
+		})
+	}
+}
+
+func TestConvertWithKnownDensity(t *testing.T) {
+	density, ok := Density("Plain flour")
+	if !ok {
+		t.Fatal("Density(\"Plain flour\") is unknown")
+	}
+	q, err := Convert(Parse("2 cups"), "g", density)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 2 * 236.5882365 * 0.53; !near(q.Amount, &want) {
+		t.Errorf("amount = %v, want %v", show(q.Amount), want)
+	}
+
+	if _, ok := Density("dried thyme"); ok {
+		t.Error("Density(\"dried thyme\") is known, want unknown")
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	tests := []struct {
+		text   string
+		system string
+		want   string
+	}{
+		{"2 cups", Metric, "473 ml"},
+		{"1.5 kg", Imperial, "3⅓ lb"},
+		{"250 g", Imperial, "8⅞ oz"},
+		{"2 tbsp", Metric, "2 tbsp"},
+		{"3 eggs", Imperial, "3 eggs"},
+		{"1 cup", Imperial, "1 cup"},
+		{"0.5 l", Imperial, "2⅛ cups"},
+	}
+	for _, tt := range tests {
+		if got := Localize(Parse(tt.text), tt.system).Format(); got != tt.want {
+			t.Errorf("Localize(%q, %s) = %q, want %q", tt.text, tt.system, got, tt.want)
+		}
+	}
+}
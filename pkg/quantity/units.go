@@ -0,0 +1,139 @@
+package quantity
+
+import (
+	"sort"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Count Kind = iota
+	Mass
+	Volume
+)
+
+// Unit systems. Metric and Imperial match the values users can pick for
+// users.units. Market is the containers Nigerian open markets sell grains
+// and garri by.
+const (
+	Metric   = "metric"
+	Imperial = "imperial"
+	Market   = "market"
+)
+
+// Unit is a unit of measure. Factor is grams per unit for mass and
+// millilitres per unit for volume; count units have no factor. Units with no
+// System, such as spoons, read naturally in both systems and are left alone
+// when localising.
+type Unit struct {
+	Name    string
+	Plural  string
+	Kind    Kind
+	System  string
+	Factor  float64
+	Aliases []string
+}
+
+var units = []Unit{
+	{Name: "mg", Kind: Mass, System: Metric, Factor: 0.001, Aliases: []string{"milligram", "milligrams"}},
+	{Name: "g", Kind: Mass, System: Metric, Factor: 1, Aliases: []string{"gr", "grs", "gram", "grams", "gramme", "grammes"}},
+	{Name: "kg", Kind: Mass, System: Metric, Factor: 1000, Aliases: []string{"kgs", "kilo", "kilos", "kilogram", "kilograms"}},
+	{Name: "oz", Kind: Mass, System: Imperial, Factor: 28.349523125, Aliases: []string{"ounce", "ounces"}},
+	{Name: "lb", Kind: Mass, System: Imperial, Factor: 453.59237, Aliases: []string{"lbs", "pound", "pounds"}},
+
+	{Name: "ml", Kind: Volume, System: Metric, Factor: 1, Aliases: []string{"mls", "millilitre", "millilitres", "milliliter", "milliliters"}},
+	{Name: "cl", Kind: Volume, System: Metric, Factor: 10, Aliases: []string{"centilitre", "centilitres", "centiliter", "centiliters"}},
+	{Name: "l", Kind: Volume, System: Metric, Factor: 1000, Aliases: []string{"ltr", "ltrs", "litre", "litres", "liter", "liters"}},
+	{Name: "tsp", Kind: Volume, Factor: 4.92892159375, Aliases: []string{"tsps", "tspn", "teaspoon", "teaspoons"}},
+	{Name: "tbsp", Kind: Volume, Factor: 14.78676478125, Aliases: []string{"tbsps", "tbs", "tbl", "tblsp", "tbspn", "tablespoon", "tablespoons"}},
+	{Name: "fl oz", Kind: Volume, System: Imperial, Factor: 29.5735295625, Aliases: []string{"fl. oz", "floz", "fluid ounce", "fluid ounces"}},
+	{Name: "cup", Plural: "cups", Kind: Volume, System: Imperial, Factor: 236.5882365},
+	{Name: "pint", Plural: "pints", Kind: Volume, System: Imperial, Factor: 473.176473, Aliases: []string{"pt", "pts"}},
+	{Name: "quart", Plural: "quarts", Kind: Volume, System: Imperial, Factor: 946.352946, Aliases: []string{"qt", "qts"}},
+	{Name: "gallon", Plural: "gallons", Kind: Volume, System: Imperial, Factor: 3785.411784, Aliases: []string{"gal", "gals"}},
+
+	{Name: "pinch", Plural: "pinches"},
+	{Name: "dash", Plural: "dashes"},
+	{Name: "drop", Plural: "drops"},
+	{Name: "clove", Plural: "cloves"},
+	{Name: "piece", Plural: "pieces", Aliases: []string{"pc", "pcs"}},
+	{Name: "slice", Plural: "slices"},
+	{Name: "bunch", Plural: "bunches"},
+	{Name: "handful", Plural: "handfuls"},
+	{Name: "sprig", Plural: "sprigs"},
+	{Name: "stalk", Plural: "stalks"},
+	{Name: "leaf", Plural: "leaves"},
+	{Name: "head", Plural: "heads"},
+	{Name: "knob", Plural: "knobs"},
+	{Name: "cube", Plural: "cubes"},
+	{Name: "sachet", Plural: "sachets"},
+	{Name: "packet", Plural: "packets", Aliases: []string{"pack", "packs"}},
+	{Name: "can", Plural: "cans"},
+	{Name: "tin", Plural: "tins"},
+
+	// Market measures vary from market to market. Factor is the usual size of
+	// the container, and local_measures holds what it weighs for each kind of
+	// ingredient. Traders say "3 derica", so most have no plural.
+	{Name: "derica", Kind: Volume, System: Market, Factor: 650, Aliases: []string{"dericas"}},
+	{Name: "mudu", Kind: Volume, System: Market, Factor: 1750, Aliases: []string{"mudus", "modu"}},
+	{Name: "congo", Kind: Volume, System: Market, Factor: 2000, Aliases: []string{"congos"}},
+	{Name: "paint bucket", Plural: "paint buckets", Kind: Volume, System: Market, Factor: 4000, Aliases: []string{"paint rubber", "paint rubbers"}},
+	{Name: "garri cup", Plural: "garri cups", Kind: Volume, System: Market, Factor: 400, Aliases: []string{"cup of garri", "cups of garri", "cup of gari", "cups of gari"}},
+}
+
+// alias is a spelling of a unit. aliases is sorted longest first so
+// "fl oz" is matched before "fl" could be and "tbsp" before "tbs".
+type alias struct {
+	text string
+	unit *Unit
+}
+
+var (
+	byName  = make(map[string]*Unit)
+	aliases []alias
+)
+
+func init() {
+	for i := range units {
+		register(&units[i])
+	}
+}
+
+// register makes u known to the parser. The name, plural and every alias
+// are accepted case-insensitively.
+func register(u *Unit) {
+	byName[u.Name] = u
+	spellings := append([]string{u.Name}, u.Aliases...)
+	if u.Plural != "" {
+		spellings = append(spellings, u.Plural)
+	}
+	for _, spelling := range spellings {
+		aliases = append(aliases, alias{text: strings.ToLower(spelling), unit: u})
+	}
+	sort.SliceStable(aliases, func(i, j int) bool {
+		return len(aliases[i].text) > len(aliases[j].text)
+	})
+}
+
+// Lookup returns the unit with the given canonical name or spelling.
+func Lookup(name string) (*Unit, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if u, ok := byName[name]; ok {
+		return u, true
+	}
+	for _, a := range aliases {
+		if a.text == name {
+			return a.unit, true
+		}
+	}
+	return nil, false
+}
+
+// label is the unit as written after amount.
+func (u *Unit) label(amount float64) string {
+	if u.Plural != "" && amount > 1 {
+		return u.Plural
+	}
+	return u.Name
+}
@@ -0,0 +1,92 @@
+package rating
+
+import (
+	"Food/pkg"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"net/http"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{
+		svc: svc,
+	}
+}
+
+func (h Handler) list(w http.ResponseWriter, r *http.Request) {
+	ratings, pagination, err := h.svc.list(r.Context(), chi.URLParam(r, "id"), r.URL.Query())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data: map[string]interface{}{
+			"ratings":    ratings,
+			"pagination": pagination,
+		},
+		Message: "Ratings retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	rating, err := h.svc.create(r.Context(), chi.URLParam(r, "id"), userID, req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    rating,
+		Message: "Rating added successfully",
+		Code:    http.StatusCreated,
+	})
+}
+
+func (h Handler) update(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	rating, err := h.svc.update(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "ratingId"), userID, req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    rating,
+		Message: "Rating updated successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) delete(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	ratingID, err := h.svc.delete(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "ratingId"), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    ratingID,
+		Message: "Rating deleted successfully",
+		Code:    http.StatusOK,
+	})
+}
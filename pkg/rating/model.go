@@ -0,0 +1,19 @@
+package rating
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+// Rating is one user's 1–5 star verdict on a recipe with an optional review.
+type Rating struct {
+	ID        string         `json:"id" db:"id"`
+	RecipeID  string         `json:"recipe_id" db:"recipe_id"`
+	UserID    string         `json:"user_id" db:"user_id"`
+	Username  string         `json:"username" db:"username"`
+	Rating    int            `json:"rating" db:"rating"`
+	Review    *string        `json:"review" db:"review"`
+	PhotoURLs pq.StringArray `json:"photo_urls" db:"photo_urls"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+}
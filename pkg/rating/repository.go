@@ -0,0 +1,112 @@
+package rating
+
+import (
+	liberror "Food/internal/errors"
+	"Food/pkg"
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+type Repository struct {
+	db *sqlx.DB
+}
+
+func NewRepository(db *sqlx.DB) *Repository {
+	return &Repository{db: db}
+}
+
+const selectRating = `
+	SELECT rr.id, rr.recipe_id, rr.user_id, u.username, rr.rating, rr.review, rr.photo_urls,
+		rr.created_at, rr.updated_at
+	FROM recipe_ratings rr
+	JOIN users u ON u.id = rr.user_id`
+
+func (r *Repository) get(ctx context.Context, recipeID, ratingID string) (*Rating, error) {
+	var rating Rating
+	err := r.db.GetContext(ctx, &rating, selectRating+`
+		WHERE rr.id = $1 AND rr.recipe_id = $2`, ratingID, recipeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, liberror.New("No rating found with the specified ID", http.StatusNotFound)
+		}
+		return nil, errors.Wrap(err, "GetContext: failed to get rating")
+	}
+	return &rating, nil
+}
+
+func (r *Repository) list(ctx context.Context, recipeID string, page, pageSize int) ([]Rating, *pkg.Pagination, error) {
+	var totalItems int
+	err := r.db.GetContext(ctx, &totalItems, `SELECT COUNT(*) FROM recipe_ratings WHERE recipe_id = $1`, recipeID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "GetContext: failed to count ratings")
+	}
+
+	ratings := []Rating{}
+	err = r.db.SelectContext(ctx, &ratings, selectRating+`
+		WHERE rr.recipe_id = $1
+		ORDER BY rr.updated_at DESC
+		LIMIT $2 OFFSET $3`, recipeID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "SelectContext: failed to list ratings")
+	}
+
+	return ratings, pkg.NewPagination(page, pageSize, totalItems), nil
+}
+
+func (r *Repository) create(ctx context.Context, recipeID, userID string, data Request) (string, error) {
+	var exists bool
+	err := r.db.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM recipes WHERE id = $1)`, recipeID)
+	if err != nil {
+		return "", errors.Wrap(err, "GetContext: failed to check recipe")
+	}
+	if !exists {
+		return "", liberror.New("Recipe not found", http.StatusNotFound)
+	}
+
+	var id string
+	err = r.db.GetContext(ctx, &id, `
+		INSERT INTO recipe_ratings (recipe_id, user_id, rating, review, photo_urls)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		ON CONFLICT (recipe_id, user_id) DO NOTHING
+		RETURNING id`, recipeID, userID, data.Rating, data.Review, pq.Array(data.PhotoURLs))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", liberror.New("You have already rated this recipe. Edit your existing rating instead", http.StatusConflict)
+		}
+		return "", errors.Wrap(err, "GetContext: failed to insert rating")
+	}
+
+	return id, nil
+}
+
+// update only touches the rating when userID wrote it.
+func (r *Repository) update(ctx context.Context, recipeID, ratingID, userID string, data Request) error {
+	existing, err := r.get(ctx, recipeID, ratingID)
+	if err != nil {
+		return err
+	}
+	if existing.UserID != userID {
+		return liberror.New("Only the author can edit a rating", http.StatusForbidden)
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE recipe_ratings
+		SET rating = $3, review = NULLIF($4, ''), photo_urls = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2`, ratingID, userID, data.Rating, data.Review, pq.Array(data.PhotoURLs))
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to update rating")
+	}
+	return nil
+}
+
+func (r *Repository) delete(ctx context.Context, recipeID, ratingID string) (string, error) {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM recipe_ratings WHERE id = $1 AND recipe_id = $2`, ratingID, recipeID)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to delete rating")
+	}
+	return ratingID, nil
+}
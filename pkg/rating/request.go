@@ -0,0 +1,67 @@
+package rating
+
+import (
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	maxReviewLength = 5000
+	maxPhotos       = 5
+)
+
+type Request struct {
+	Rating int    `json:"rating"`
+	Review string `json:"review"`
+	// PhotoURLs point at images already uploaded elsewhere.
+	PhotoURLs []string `json:"photo_urls"`
+}
+
+func (v *Request) Bind(r *http.Request) error {
+	v.Review = strings.TrimSpace(v.Review)
+	photos := make([]string, 0, len(v.PhotoURLs))
+	for _, photo := range v.PhotoURLs {
+		if photo = strings.TrimSpace(photo); photo != "" {
+			photos = append(photos, photo)
+		}
+	}
+	v.PhotoURLs = photos
+
+	err1 := validate.Validate(
+		&validators.FuncValidator{
+			Name:    "rating",
+			Field:   "rating",
+			Message: "%s must be between 1 and 5",
+			Fn: func() bool {
+				return v.Rating >= 1 && v.Rating <= 5
+			},
+		},
+		&validators.StringLengthInRange{Name: "review", Field: v.Review, Max: maxReviewLength, Message: fmt.Sprintf("%v must be at most %d characters", "review", maxReviewLength)},
+		&validators.FuncValidator{
+			Name:    "photo_urls",
+			Field:   "photo_urls",
+			Message: fmt.Sprintf("%%s must hold at most %d http or https URLs", maxPhotos),
+			Fn: func() bool {
+				if len(v.PhotoURLs) > maxPhotos {
+					return false
+				}
+				for _, photo := range v.PhotoURLs {
+					parsed, err := url.Parse(photo)
+					if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(photo) > 2048 {
+						return false
+					}
+				}
+				return true
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
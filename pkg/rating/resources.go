@@ -0,0 +1,37 @@
+package rating
+
+import (
+	"Food/auth"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+type Resource struct {
+	db    *sqlx.DB
+	authn *auth.Authenticator
+}
+
+// NewResource creates and returns a resource.
+func NewResource(db *sqlx.DB, authn *auth.Authenticator) *Resource {
+	return &Resource{
+		db:    db,
+		authn: authn,
+	}
+}
+
+// Router serves /recipes/{id}/ratings.
+func (rs *Resource) Router() *chi.Mux {
+	r := chi.NewRouter()
+
+	repo := NewRepository(rs.db)
+	svc := NewService(repo)
+	hndlr := NewHandler(svc)
+
+	r.Use(rs.authn.MustAuthMiddleware)
+	r.Get("/", hndlr.list)
+	r.With(auth.RequireWriteScope).Post("/", hndlr.create)
+	r.With(auth.RequireWriteScope).Put("/{ratingId}", hndlr.update)
+	r.With(auth.RequireWriteScope).Delete("/{ratingId}", hndlr.delete)
+
+	return r
+}
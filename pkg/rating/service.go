@@ -0,0 +1,90 @@
+package rating
+
+import (
+	"Food/auth"
+	liberror "Food/internal/errors"
+	"Food/pkg"
+	"context"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+)
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+func (s Service) list(ctx context.Context, recipeID string, queryParams url.Values) ([]Rating, *pkg.Pagination, error) {
+	if err := pkg.ValidIDs(recipeID); err != nil {
+		return nil, nil, err
+	}
+
+	page, pageSize, err := pkg.ParsePaginationParams(queryParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ratings, pagination, err := s.repo.list(ctx, recipeID, page, pageSize)
+	return ratings, pagination, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("rating.list", "rating.list", "", log.Fields{"recipe_id": recipeID}).WithError(err))
+}
+
+func (s Service) create(ctx context.Context, recipeID, userID string, req Request) (*Rating, error) {
+	if err := pkg.ValidIDs(recipeID); err != nil {
+		return nil, err
+	}
+
+	id, err := s.repo.create(ctx, recipeID, userID, req)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("rating.create", "rating.create", userID, log.Fields{"recipe_id": recipeID}).WithError(err))
+	}
+	return s.get(ctx, recipeID, id)
+}
+
+func (s Service) update(ctx context.Context, recipeID, ratingID, userID string, req Request) (*Rating, error) {
+	if err := pkg.ValidIDs(recipeID, ratingID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.update(ctx, recipeID, ratingID, userID, req); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("rating.update", "rating.update", userID, log.Fields{"recipe_id": recipeID, "rating_id": ratingID}).WithError(err))
+	}
+	return s.get(ctx, recipeID, ratingID)
+}
+
+// delete lets the author remove their rating and admins remove any.
+func (s Service) delete(ctx context.Context, recipeID, ratingID, userID string) (string, error) {
+	if err := pkg.ValidIDs(recipeID, ratingID); err != nil {
+		return "", err
+	}
+
+	existing, err := s.get(ctx, recipeID, ratingID)
+	if err != nil {
+		return "", err
+	}
+	if existing.UserID != userID && auth.RoleFromContext(ctx) != auth.RoleAdmin {
+		return "", liberror.New("Only the author can delete a rating", http.StatusForbidden)
+	}
+
+	resp, err := s.repo.delete(ctx, recipeID, ratingID)
+	return resp, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("rating.delete", "rating.delete", userID, log.Fields{"recipe_id": recipeID, "rating_id": ratingID}).WithError(err))
+}
+
+func (s Service) get(ctx context.Context, recipeID, ratingID string) (*Rating, error) {
+	rating, err := s.repo.get(ctx, recipeID, ratingID)
+	return rating, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("rating.get", "rating.get", "", log.Fields{"recipe_id": recipeID, "rating_id": ratingID}).WithError(err))
+}
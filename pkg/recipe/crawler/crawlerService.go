@@ -4,26 +4,31 @@ import (
 	"Food/pkg/clients/maggi_ng"
 	crawler2 "Food/pkg/recipe/crawler/maggi_ng"
 	"Food/pkg/recipe/model"
+	"fmt"
 )
 
 type ICrawler interface {
 	CrawlRecipe() (*[]model.RequestData, error)
 }
 
-func AddCrawler(crawlerNames []string) []ICrawler {
+func AddCrawler(crawlerNames []string) ([]ICrawler, error) {
 	var crawlers []ICrawler
 	for _, name := range crawlerNames {
-		crawlers = append(crawlers, GetCrawler(name))
+		c, err := GetCrawler(name)
+		if err != nil {
+			return nil, err
+		}
+		crawlers = append(crawlers, c)
 	}
-	return crawlers
+	return crawlers, nil
 }
 
-func GetCrawler(name string) ICrawler {
+func GetCrawler(name string) (ICrawler, error) {
 	switch name {
 	case "maggi_ng":
 		client := maggi_ng.NewClient()
-		return crawler2.NewMaggiCrawler(client)
+		return crawler2.NewMaggiCrawler(client), nil
 	default:
-		panic("Unknown service type")
+		return nil, fmt.Errorf("unknown crawler %q", name)
 	}
 }
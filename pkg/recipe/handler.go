@@ -1,12 +1,18 @@
 package recipe
 
 import (
+	liberror "Food/internal/errors"
 	"Food/pkg"
 	"Food/pkg/recipe/model"
 	"Food/pkg/user_preference"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 type Handler struct {
@@ -55,6 +61,41 @@ func (h Handler) like(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h Handler) feedback(w http.ResponseWriter, r *http.Request) {
+	var req user_preference.FeedbackRequest
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	err := h.usrPrefSvc.SetFeedback(r.Context(), userID, chi.URLParam(r, "id"), req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    req,
+		Message: "Recipe feedback saved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) clearFeedback(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	err := h.usrPrefSvc.ClearFeedback(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Message: "Recipe feedback removed successfully",
+		Code:    http.StatusOK,
+	})
+}
+
 func (h Handler) save(w http.ResponseWriter, r *http.Request) {
 	var recipes model.Request
 
@@ -63,7 +104,8 @@ func (h Handler) save(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	successMap, err := h.svc.save(r.Context(), recipes)
+	userID := r.Context().Value("user_id").(string)
+	successMap, err := h.svc.save(r.Context(), recipes, revisionInfo{editorID: userID, source: SourceCreate})
 	if err != nil {
 		pkg.Render(w, r, err)
 		return
@@ -94,16 +136,192 @@ func (h Handler) delete(w http.ResponseWriter, r *http.Request) {
 
 func (h Handler) get(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	userID := r.Context().Value("user_id").(string)
+
+	include, err := parseInclude(r.URL.Query().Get("include"))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	recipe, err := h.svc.get(r.Context(), id, userID, include)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(recipe.UpdatedAt))
+	message := "Recipe retrieved successfully"
+	if len(recipe.AllergenWarnings) > 0 {
+		message = fmt.Sprintf("Recipe retrieved successfully. It is hidden from your searches and meal plans because it contains %s, which is on your allergen list",
+			strings.Join(recipe.AllergenWarnings, ", "))
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    recipe,
+		Message: message,
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) replace(w http.ResponseWriter, r *http.Request) {
+	var req UpdateRequest
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	h.update(w, r, req.patch())
+}
 
-	recipe, err := h.svc.get(r.Context(), id)
+func (h Handler) patch(w http.ResponseWriter, r *http.Request) {
+	var req PatchRequest
+	if err := render.Bind(r, &req); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+	h.update(w, r, req)
+}
+
+// update takes the precondition from If-Match, falling back to the
+// updated_at the client read, and answers with the new ETag.
+func (h Handler) update(w http.ResponseWriter, r *http.Request, changes PatchRequest) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" && changes.UpdatedAt != nil {
+		ifMatch = etag(*changes.UpdatedAt)
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	recipe, err := h.svc.update(r.Context(), chi.URLParam(r, "id"), userID, ifMatch, changes)
 	if err != nil {
 		pkg.Render(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(recipe.UpdatedAt))
 	pkg.Render(w, r, pkg.ApiResponse{
 		Data:    recipe,
-		Message: "Recipe retrieved successfully",
+		Message: "Recipe updated successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) revisions(w http.ResponseWriter, r *http.Request) {
+	revisions, pagination, err := h.svc.revisions(r.Context(), chi.URLParam(r, "id"), r.URL.Query())
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:       revisions,
+		Message:    "Revisions retrieved successfully",
+		Code:       http.StatusOK,
+		Pagination: pagination,
+	})
+}
+
+func (h Handler) revision(w http.ResponseWriter, r *http.Request) {
+	number, err := revisionNumber(chi.URLParam(r, "rev"))
+	if err != nil || number == 0 {
+		pkg.Render(w, r, liberror.New("Invalid revision", http.StatusBadRequest))
+		return
+	}
+
+	revision, err := h.svc.revision(r.Context(), chi.URLParam(r, "id"), number)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    revision,
+		Message: "Revision retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) diff(w http.ResponseWriter, r *http.Request) {
+	from, err := revisionNumber(r.URL.Query().Get("from"))
+	if err != nil {
+		pkg.Render(w, r, liberror.New("from must be a revision number", http.StatusBadRequest))
+		return
+	}
+	to, err := revisionNumber(r.URL.Query().Get("to"))
+	if err != nil {
+		pkg.Render(w, r, liberror.New("to must be a revision number", http.StatusBadRequest))
+		return
+	}
+
+	diff, err := h.svc.diff(r.Context(), chi.URLParam(r, "id"), from, to)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    diff,
+		Message: "Revision diff retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) revert(w http.ResponseWriter, r *http.Request) {
+	number, err := revisionNumber(chi.URLParam(r, "rev"))
+	if err != nil || number == 0 {
+		pkg.Render(w, r, liberror.New("Invalid revision", http.StatusBadRequest))
+		return
+	}
+
+	var req RevertRequest
+	if err := render.Bind(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" && req.UpdatedAt != nil {
+		ifMatch = etag(*req.UpdatedAt)
+	}
+
+	userID := r.Context().Value("user_id").(string)
+	recipe, err := h.svc.revert(r.Context(), chi.URLParam(r, "id"), number, userID, ifMatch, req)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(recipe.UpdatedAt))
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    recipe,
+		Message: fmt.Sprintf("Recipe reverted to revision %d", number),
+		Code:    http.StatusOK,
+	})
+}
+
+// revisionNumber parses a revision number. An empty value is 0, meaning the
+// latest revision.
+func revisionNumber(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, liberror.New("Invalid revision", http.StatusBadRequest)
+	}
+	return number, nil
+}
+
+func (h Handler) reparseQuantities(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	count, err := h.svc.reparseQuantities(r.Context(), userID)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    map[string]interface{}{"updated": count},
+		Message: "Ingredient quantities parsed successfully",
 		Code:    http.StatusOK,
 	})
 }
@@ -2,27 +2,333 @@ package recipe
 
 import (
 	"Food/pkg/ingredient"
+	"Food/pkg/quantity"
+	"Food/pkg/rating"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
 	"time"
 )
 
+// Recipe is the full recipe aggregate served by GET /recipes/{id}. The parts
+// tagged db:"-" are loaded separately; Allergens, Reviews and Collections
+// only when asked for with ?include=.
 type Recipe struct {
-	Id           string                  `json:"id" db:"id"`
-	Name         string                  `json:"name" db:"name"`
-	Description  string                  `json:"description" db:"description"`
-	CookingTime  string                  `json:"cooking_time" db:"cooking_time"`
-	Instructions string                  `json:"instructions" db:"instructions"`
-	ImgUrl       string                  `json:"img_url" db:"img_url"`
-	Ingredients  []ingredient.Ingredient `json:"ingredients"` // Convenient for handling full recipes
-	Similarity   float64                 `json:"similarity" db:"similarity"`
-	CreatedAt    time.Time               `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time               `json:"updated_at" db:"updated_at"`
+	Id           string             `json:"id" db:"id"`
+	Name         string             `json:"name" db:"name"`
+	Description  string             `json:"description" db:"description"`
+	CookingTime  string             `json:"cooking_time" db:"cooking_time"`
+	Instructions pq.StringArray     `json:"instructions" db:"instructions"`
+	ImgUrl       string             `json:"img_url" db:"img_url"`
+	Ingredients  []RecipeIngredient `json:"ingredients" db:"-"`
+	Details      *Details           `json:"details" db:"-"`
+	// AllergenWarnings names the allergens on the viewer's list that this
+	// recipe contains. Such recipes are filtered from search and plans, so
+	// this is only seen when the recipe is opened directly.
+	AllergenWarnings []string              `json:"allergen_warnings,omitempty" db:"-"`
+	AverageRating    float64               `json:"average_rating" db:"average_rating"`
+	RatingCount      int                   `json:"rating_count" db:"rating_count"`
+	LikeCount        int                   `json:"like_count" db:"like_count"`
+	Viewer           *ViewerState          `json:"viewer,omitempty" db:"-"`
+	Allergens        []ingredient.Allergen `json:"allergens,omitempty" db:"-"`
+	Reviews          []rating.Rating       `json:"reviews,omitempty" db:"-"`
+	Collections      Refs                  `json:"collections,omitempty" db:"-"`
+	CreatedAt        time.Time             `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time             `json:"updated_at" db:"updated_at"`
 }
 
 type Recipes = []Recipe
 
-type Feedback struct {
-	UserID    string    `json:"user_id" db:"user_id"`
-	RecipeID  string    `json:"recipe_id" db:"recipe_id"`
-	Like      bool      `json:"like" db:"like"`
-	Timestamp time.Time `json:"timestamp" db:"timestamp"`
+// RecipeIngredient is an ingredient of a recipe. Quantity is as written;
+// Amount, AmountMax, Unit and Note are its parsed form and Display is it
+// rendered in the viewer's unit system.
+type RecipeIngredient struct {
+	ID           string   `json:"id" db:"id"`
+	Name         string   `json:"name" db:"name"`
+	Quantity     string   `json:"quantity" db:"quantity"`
+	Amount       *float64 `json:"amount" db:"amount"`
+	AmountMax    *float64 `json:"amount_max" db:"amount_max"`
+	Unit         string   `json:"unit" db:"unit"`
+	Note         string   `json:"note" db:"note"`
+	Display      string   `json:"display" db:"-"`
+	Parsed       bool     `json:"-" db:"parsed"`
+	Alternatives Refs     `json:"alternatives" db:"alternatives"`
+}
+
+// localize fills in Display, parsing Quantity first for rows stored before
+// quantities were parsed on save.
+func (i *RecipeIngredient) localize(system string) {
+	q := quantity.Quantity{Text: i.Quantity, Amount: i.Amount, AmountMax: i.AmountMax, Unit: i.Unit, Note: i.Note}
+	if !i.Parsed {
+		q = quantity.Parse(i.Quantity)
+		i.Amount, i.AmountMax, i.Unit, i.Note = q.Amount, q.AmountMax, q.Unit, q.Note
+	}
+	i.Display = quantity.Localize(q, system).Format()
+}
+
+// Ref names another record, such as an alternative ingredient or one of the
+// viewer's collections.
+type Ref struct {
+	ID   string `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+}
+
+type Refs []Ref
+
+func (r *Refs) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, r)
+}
+
+// ViewerState is what the signed-in caller has done with the recipe.
+type ViewerState struct {
+	Liked       bool    `json:"liked" db:"liked"`
+	Reaction    *string `json:"reaction" db:"reaction"`
+	Rating      *int    `json:"rating" db:"rating"`
+	CookedCount int     `json:"cooked_count" db:"cooked_count"`
+}
+
+// Optional parts of a recipe for ?include=.
+const (
+	IncludeAllergens   = "allergens"
+	IncludeReviews     = "reviews"
+	IncludeCollections = "collections"
+)
+
+// Details are the recipe_details attributes meal plans and the onboarding
+// quiz filter on.
+type Details struct {
+	MealType        string `json:"meal_type" db:"meal_type"`
+	FoodClass       string `json:"food_class" db:"food_class"`
+	Region          string `json:"region" db:"region"`
+	SpicinessLevel  string `json:"spiciness_level" db:"spiciness_level"`
+	MainIngredients string `json:"main_ingredients" db:"main_ingredients"`
+	CookingMethod   string `json:"cooking_method" db:"cooking_method"`
+	Description     string `json:"description" db:"description"`
+}
+
+// Snapshot is the editable state of a recipe, as stored in its revisions.
+// Ingredients are sorted by name.
+type Snapshot struct {
+	Name         string               `json:"name"`
+	Description  string               `json:"description"`
+	CookingTime  string               `json:"cooking_time"`
+	Instructions []string             `json:"instructions"`
+	ImgUrl       string               `json:"img_url"`
+	Ingredients  []IngredientQuantity `json:"ingredients"`
+	Details      Details              `json:"details"`
+}
+
+func (s *Snapshot) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+// Revision sources.
+const (
+	SourceImport  = "import"
+	SourceCreate  = "create"
+	SourceEdit    = "edit"
+	SourceRevert  = "revert"
+	SourceCrawler = "crawler"
+)
+
+// Revision is a recipe as it stood after one change. Snapshot is left out of
+// listings.
+type Revision struct {
+	Revision   int       `json:"revision" db:"revision"`
+	EditorID   *string   `json:"editor_id" db:"editor_id"`
+	EditorName *string   `json:"editor_name" db:"editor_name"`
+	Source     string    `json:"source" db:"source"`
+	Note       string    `json:"note" db:"note"`
+	Snapshot   *Snapshot `json:"snapshot,omitempty" db:"snapshot"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// FieldChange is one difference between two revisions. Field is a snapshot
+// field, "details.<attribute>" or "ingredients.<name>"; From or To is nil
+// when an ingredient was added or removed.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// RevisionDiff lists the changes from one revision to another.
+type RevisionDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// diffSnapshots compares two snapshots field by field. Instructions are
+// compared as a whole, ingredients by name.
+func diffSnapshots(from, to Snapshot) []FieldChange {
+	changes := make([]FieldChange, 0)
+	compare := func(field string, a, b string) {
+		if a != b {
+			changes = append(changes, FieldChange{Field: field, From: a, To: b})
+		}
+	}
+
+	compare("name", from.Name, to.Name)
+	compare("description", from.Description, to.Description)
+	compare("cooking_time", from.CookingTime, to.CookingTime)
+	if !equalSteps(from.Instructions, to.Instructions) {
+		changes = append(changes, FieldChange{Field: "instructions", From: from.Instructions, To: to.Instructions})
+	}
+	compare("img_url", from.ImgUrl, to.ImgUrl)
+
+	before := make(map[string]string, len(from.Ingredients))
+	for _, ingredient := range from.Ingredients {
+		before[ingredient.Name] = ingredient.Quantity
+	}
+	after := make(map[string]string, len(to.Ingredients))
+	for _, ingredient := range to.Ingredients {
+		after[ingredient.Name] = ingredient.Quantity
+	}
+	for _, ingredient := range from.Ingredients {
+		if _, ok := after[ingredient.Name]; !ok {
+			changes = append(changes, FieldChange{Field: "ingredients." + ingredient.Name, From: ingredient.Quantity})
+		}
+	}
+	for _, ingredient := range to.Ingredients {
+		quantity, ok := before[ingredient.Name]
+		if !ok {
+			changes = append(changes, FieldChange{Field: "ingredients." + ingredient.Name, To: ingredient.Quantity})
+		} else if quantity != ingredient.Quantity {
+			changes = append(changes, FieldChange{Field: "ingredients." + ingredient.Name, From: quantity, To: ingredient.Quantity})
+		}
+	}
+
+	compare("details.meal_type", from.Details.MealType, to.Details.MealType)
+	compare("details.food_class", from.Details.FoodClass, to.Details.FoodClass)
+	compare("details.region", from.Details.Region, to.Details.Region)
+	compare("details.spiciness_level", from.Details.SpicinessLevel, to.Details.SpicinessLevel)
+	compare("details.main_ingredients", from.Details.MainIngredients, to.Details.MainIngredients)
+	compare("details.cooking_method", from.Details.CookingMethod, to.Details.CookingMethod)
+	compare("details.description", from.Details.Description, to.Details.Description)
+
+	return changes
+}
+
+// mergeImport returns the changes that carry what the source changed
+// between base, the recipe as last imported, and crawled into current.
+// Fields the source left alone are not patched, so editors' fixes to them
+// survive; a field both changed takes the source's version. Details are
+// not crawled and never patched.
+func mergeImport(base, crawled, current Snapshot) PatchRequest {
+	var changes PatchRequest
+	take := func(field **string, from, to string) {
+		if from != to {
+			*field = &to
+		}
+	}
+	take(&changes.Name, base.Name, crawled.Name)
+	take(&changes.Description, base.Description, crawled.Description)
+	take(&changes.CookingTime, base.CookingTime, crawled.CookingTime)
+	take(&changes.ImgUrl, base.ImgUrl, crawled.ImgUrl)
+	if !equalSteps(base.Instructions, crawled.Instructions) {
+		steps := append([]string(nil), crawled.Instructions...)
+		changes.Instructions = &steps
+	}
+	if ingredients, ok := mergeIngredients(base.Ingredients, crawled.Ingredients, current.Ingredients); ok {
+		changes.Ingredients = &ingredients
+	}
+	return changes
+}
+
+// mergeIngredients applies the source's additions, removals and quantity
+// changes, matched by name regardless of case, to current. Ingredients an
+// editor added or changed are kept unless the source changed or removed
+// them too. It reports false when the source changed no ingredient.
+func mergeIngredients(base, crawled, current []IngredientQuantity) ([]IngredientQuantity, bool) {
+	byName := func(ingredients []IngredientQuantity) map[string]IngredientQuantity {
+		m := make(map[string]IngredientQuantity, len(ingredients))
+		for _, ingredient := range ingredients {
+			m[strings.ToLower(ingredient.Name)] = ingredient
+		}
+		return m
+	}
+	before, after := byName(base), byName(crawled)
+
+	merged := append([]IngredientQuantity(nil), current...)
+	index := make(map[string]int, len(merged))
+	for i, ingredient := range merged {
+		index[strings.ToLower(ingredient.Name)] = i
+	}
+
+	changed := false
+	for name := range before {
+		if _, ok := after[name]; ok {
+			continue
+		}
+		changed = true
+		if i, ok := index[name]; ok {
+			merged[i].Name = ""
+		}
+	}
+	for _, ingredient := range crawled {
+		name := strings.ToLower(ingredient.Name)
+		if old, ok := before[name]; ok && old.Quantity == ingredient.Quantity {
+			continue
+		}
+		changed = true
+		if i, ok := index[name]; ok {
+			merged[i] = ingredient
+		} else {
+			index[name] = len(merged)
+			merged = append(merged, ingredient)
+		}
+	}
+	if !changed {
+		return nil, false
+	}
+
+	kept := merged[:0]
+	for _, ingredient := range merged {
+		if ingredient.Name != "" {
+			kept = append(kept, ingredient)
+		}
+	}
+	return kept, true
+}
+
+func equalSteps(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// etag identifies a version of a recipe. Every update moves updated_at, so
+// it changes whenever any part of the recipe does.
+func etag(updatedAt time.Time) string {
+	return fmt.Sprintf(`"%d"`, updatedAt.UnixNano())
+}
+
+// matchesETag reports whether an If-Match value names the version last
+// updated at updatedAt. It accepts "*", a list and weak tags.
+func matchesETag(ifMatch string, updatedAt time.Time) bool {
+	current := etag(updatedAt)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
 }
@@ -23,6 +23,10 @@ type RequestData struct {
 	ImgUrl       string              `json:"img_url" db:"img_url"`
 	Ingredients  []IngredientRequest `json:"ingredients" db:"ingredients"`
 	Diff         int                 `json:"diff" db:"diff"`
+	// SourceURL is the page a crawled recipe came from. Re-imports are
+	// matched on it, since editors may rename the recipe. Only crawlers set
+	// it.
+	SourceURL string `json:"-" db:"source_url"`
 }
 
 type Request []RequestData
@@ -0,0 +1,97 @@
+package recipe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeImport(t *testing.T) {
+	base := Snapshot{
+		Name:         "Jollof Rice",
+		Description:  "Party rice",
+		CookingTime:  "1 hour",
+		Instructions: []string{"Fry the base", "Add the rice"},
+		ImgUrl:       "https://example.com/jollof.jpg",
+		Ingredients: []IngredientQuantity{
+			{Name: "Oil", Quantity: "3 tbsp"},
+			{Name: "Rice", Quantity: "2 cups"},
+			{Name: "Salt", Quantity: "1 tsp"},
+		},
+	}
+	// current is base as an editor left it: renamed, described, with an
+	// ingredient added and one corrected.
+	current := Snapshot{
+		Name:         "Smoky Jollof Rice",
+		Description:  "Smoky party rice",
+		CookingTime:  "1 hour",
+		Instructions: []string{"Fry the base", "Add the rice"},
+		ImgUrl:       "https://example.com/jollof.jpg",
+		Ingredients: []IngredientQuantity{
+			{Name: "Oil", Quantity: "3 tbsp"},
+			{Name: "rice", Quantity: "3 cups"},
+			{Name: "Salt", Quantity: "1 tsp"},
+			{Name: "Scotch bonnet", Quantity: "2"},
+		},
+		Details: Details{Region: "West Africa"},
+	}
+
+	tests := []struct {
+		name    string
+		crawled func(s *Snapshot)
+		want    func(s *Snapshot)
+	}{
+		{
+			name:    "source unchanged",
+			crawled: func(s *Snapshot) {},
+			want:    func(s *Snapshot) {},
+		},
+		{
+			name:    "source changed an untouched field",
+			crawled: func(s *Snapshot) { s.CookingTime = "90 minutes" },
+			want:    func(s *Snapshot) { s.CookingTime = "90 minutes" },
+		},
+		{
+			name:    "source changed an edited field",
+			crawled: func(s *Snapshot) { s.Description = "Classic party rice" },
+			want:    func(s *Snapshot) { s.Description = "Classic party rice" },
+		},
+		{
+			name:    "source changed the steps",
+			crawled: func(s *Snapshot) { s.Instructions = []string{"Fry the base", "Add the rice", "Steam"} },
+			want:    func(s *Snapshot) { s.Instructions = []string{"Fry the base", "Add the rice", "Steam"} },
+		},
+		{
+			name: "source changed ingredients",
+			crawled: func(s *Snapshot) {
+				s.Ingredients = []IngredientQuantity{
+					{Name: "Onion", Quantity: "1"},
+					{Name: "Rice", Quantity: "2 cups"},
+					{Name: "Salt", Quantity: "2 tsp"},
+				}
+			},
+			// applyTo sorts the ingredients it sets by name.
+			want: func(s *Snapshot) {
+				s.Ingredients = []IngredientQuantity{
+					{Name: "Onion", Quantity: "1"},
+					{Name: "Salt", Quantity: "2 tsp"},
+					{Name: "Scotch bonnet", Quantity: "2"},
+					{Name: "rice", Quantity: "3 cups"},
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crawled := base
+			crawled.Ingredients = append([]IngredientQuantity(nil), base.Ingredients...)
+			tt.crawled(&crawled)
+			want := current
+			tt.want(&want)
+
+			got := mergeImport(base, crawled, current).applyTo(current)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("merged = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package recipe
 import (
 	liberror "Food/internal/errors"
 	"Food/pkg"
+	"Food/pkg/ingredient"
+	"Food/pkg/quantity"
+	"Food/pkg/rating"
 	"Food/pkg/recipe/model"
 	"context"
 	"database/sql"
@@ -15,6 +18,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 type Repository struct {
@@ -25,10 +29,23 @@ func NewRepository(db *sqlx.DB) *Repository {
 	return &Repository{db: db}
 }
 
+// get returns the recipe with its rating and like stats. The other parts of
+// the aggregate are loaded by the functions below.
 func (r *Repository) get(ctx context.Context, id string) (*Recipe, error) {
-	var recipe Recipe
+	recipeID, err := pkg.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
 
-	err := r.db.GetContext(ctx, &recipe, "SELECT * FROM recipes WHERE id = $1", id)
+	var recipe Recipe
+	err = r.db.GetContext(ctx, &recipe, `
+		SELECT r.id, r.name, COALESCE(r.description, '') AS description, COALESCE(r.cooking_time, '') AS cooking_time,
+			r.instructions, COALESCE(r.img_url, '') AS img_url, `+ratingColumns+`,
+			(SELECT COUNT(*) FROM likes l WHERE l.recipe_id = r.id)::INT AS like_count,
+			r.created_at, r.updated_at
+		FROM recipes r
+		LEFT JOIN recipe_rating_stats rs ON rs.recipe_id = r.id
+		WHERE r.id = $1`, recipeID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, liberror.New("Recipe not found", http.StatusNotFound)
@@ -39,6 +56,190 @@ func (r *Repository) get(ctx context.Context, id string) (*Recipe, error) {
 	return &recipe, nil
 }
 
+// ingredients returns the recipe's ingredients with their quantities and
+// known alternatives.
+func (r *Repository) ingredients(ctx context.Context, recipeID string) ([]RecipeIngredient, error) {
+	ingredients := []RecipeIngredient{}
+	err := r.db.SelectContext(ctx, &ingredients, `
+		SELECT i.id, i.name, COALESCE(ri.quantity, '') AS quantity,
+			ri.amount, ri.amount_max, COALESCE(ri.unit, '') AS unit, COALESCE(ri.note, '') AS note,
+			ri.note IS NOT NULL AS parsed,
+			COALESCE((
+				SELECT jsonb_agg(jsonb_build_object('id', alt.id, 'name', alt.name) ORDER BY alt.name)
+				FROM ingredient_alternatives a
+				JOIN ingredients alt ON alt.id = a.alternative_id
+				WHERE a.ingredient_id = i.id
+			), '[]'::jsonb) AS alternatives
+		FROM recipe_ingredients ri
+		JOIN ingredients i ON i.id = ri.ingredient_id
+		WHERE ri.recipe_id = $1
+		ORDER BY i.name`, recipeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get recipe ingredients")
+	}
+	return ingredients, nil
+}
+
+// details returns the recipe's recipe_details row, or nil if it has none.
+func (r *Repository) details(ctx context.Context, recipeID string) (*Details, error) {
+	var details Details
+	err := r.db.GetContext(ctx, &details, `
+		SELECT COALESCE(meal_type, '') AS meal_type, COALESCE(food_class, '') AS food_class,
+			COALESCE(region, '') AS region, COALESCE(spiciness_level, '') AS spiciness_level,
+			COALESCE(main_ingredients, '') AS main_ingredients, COALESCE(cooking_method, '') AS cooking_method,
+			COALESCE(description, '') AS description
+		FROM recipe_details
+		WHERE recipe_id = $1`, recipeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "GetContext: failed to get recipe details")
+	}
+	return &details, nil
+}
+
+func (r *Repository) viewerState(ctx context.Context, recipeID, userID string) (*ViewerState, error) {
+	var state ViewerState
+	err := r.db.GetContext(ctx, &state, `
+		SELECT
+			EXISTS (SELECT 1 FROM likes WHERE user_id = $2 AND recipe_id = $1) AS liked,
+			(SELECT kind FROM recipe_dislikes WHERE user_id = $2 AND recipe_id = $1) AS reaction,
+			(SELECT rating FROM recipe_ratings WHERE user_id = $2 AND recipe_id = $1) AS rating,
+			(SELECT COUNT(*) FROM recipe_events WHERE user_id = $2 AND recipe_id = $1 AND type = 'cook')::INT AS cooked_count`,
+		recipeID, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetContext: failed to get viewer state")
+	}
+	return &state, nil
+}
+
+// allergens lists every allergen the recipe contains.
+func (r *Repository) allergens(ctx context.Context, recipeID string) ([]ingredient.Allergen, error) {
+	allergens := []ingredient.Allergen{}
+	err := r.db.SelectContext(ctx, &allergens, `
+		SELECT a.code, a.name
+		FROM recipe_allergens ra
+		JOIN allergens a ON a.code = ra.allergen
+		WHERE ra.recipe_id = $1
+		ORDER BY a.name`, recipeID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get recipe allergens")
+	}
+	return allergens, nil
+}
+
+// reviews returns the latest ratings that come with a written review. The
+// rest are paged through /recipes/{id}/ratings.
+func (r *Repository) reviews(ctx context.Context, recipeID string, limit int) ([]rating.Rating, error) {
+	reviews := []rating.Rating{}
+	err := r.db.SelectContext(ctx, &reviews, `
+		SELECT rr.id, rr.recipe_id, rr.user_id, u.username, rr.rating, rr.review, rr.photo_urls,
+			rr.created_at, rr.updated_at
+		FROM recipe_ratings rr
+		JOIN users u ON u.id = rr.user_id
+		WHERE rr.recipe_id = $1 AND rr.review IS NOT NULL
+		ORDER BY rr.updated_at DESC
+		LIMIT $2`, recipeID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get recipe reviews")
+	}
+	return reviews, nil
+}
+
+// viewerCollections returns the caller's collections that hold the recipe.
+func (r *Repository) viewerCollections(ctx context.Context, recipeID, userID string) (Refs, error) {
+	collections := Refs{}
+	err := r.db.SelectContext(ctx, &collections, `
+		SELECT c.id, c.name
+		FROM collections c
+		JOIN collection_recipes cr ON cr.collection_id = c.id
+		WHERE c.user_id = $2 AND cr.recipe_id = $1
+		ORDER BY c.name`, recipeID, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get viewer collections")
+	}
+	return collections, nil
+}
+
+// reparseQuantities parses every recipe ingredient quantity again, for rows
+// saved before quantities were parsed and after the parser learns new units.
+func (r *Repository) reparseQuantities(ctx context.Context) (int64, error) {
+	rows := []struct {
+		RecipeID     string `db:"recipe_id"`
+		IngredientID string `db:"ingredient_id"`
+		Quantity     string `db:"quantity"`
+	}{}
+	err := r.db.SelectContext(ctx, &rows, `
+		SELECT recipe_id, ingredient_id, COALESCE(quantity, '') AS quantity
+		FROM recipe_ingredients`)
+	if err != nil {
+		return 0, errors.Wrap(err, "SelectContext: failed to get recipe ingredient quantities")
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	recipeIDs := make([]string, len(rows))
+	ingredientIDs := make([]string, len(rows))
+	amounts := make([]*float64, len(rows))
+	amountMaxes := make([]*float64, len(rows))
+	unitNames := make([]string, len(rows))
+	notes := make([]string, len(rows))
+	for i, row := range rows {
+		q := quantity.Parse(row.Quantity)
+		recipeIDs[i], ingredientIDs[i] = row.RecipeID, row.IngredientID
+		amounts[i], amountMaxes[i], unitNames[i], notes[i] = q.Amount, q.AmountMax, q.Unit, q.Note
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE recipe_ingredients ri
+		SET amount = p.amount, amount_max = p.amount_max, unit = p.unit, note = p.note
+		FROM unnest($1::uuid[], $2::uuid[], $3::numeric[], $4::numeric[], $5::text[], $6::text[])
+			AS p(recipe_id, ingredient_id, amount, amount_max, unit, note)
+		WHERE ri.recipe_id = p.recipe_id AND ri.ingredient_id = p.ingredient_id`,
+		pq.Array(recipeIDs), pq.Array(ingredientIDs), pq.Array(amounts), pq.Array(amountMaxes),
+		pq.Array(unitNames), pq.Array(notes))
+	if err != nil {
+		return 0, errors.Wrap(err, "ExecContext: failed to save parsed quantities")
+	}
+	return res.RowsAffected()
+}
+
+// unitSystem returns the user's preferred unit system. Guests get metric.
+func (r *Repository) unitSystem(ctx context.Context, userID string) (string, error) {
+	if userID == "" {
+		return quantity.Metric, nil
+	}
+
+	var units string
+	err := r.db.GetContext(ctx, &units, `SELECT units FROM users WHERE id = $1`, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return quantity.Metric, nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "GetContext: failed to get unit system")
+	}
+	return units, nil
+}
+
+// allergenWarnings returns the names of the allergens on the user's list
+// that the recipe contains.
+func (r *Repository) allergenWarnings(ctx context.Context, recipeID, userID string) ([]string, error) {
+	var names []string
+	err := r.db.SelectContext(ctx, &names, `
+		SELECT a.name
+		FROM recipe_allergens ra
+		JOIN user_allergens ua ON ua.allergen = ra.allergen
+		JOIN allergens a ON a.code = ra.allergen
+		WHERE ra.recipe_id = $1 AND ua.user_id = $2
+		ORDER BY a.name`, recipeID, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "db.SelectContext failed")
+	}
+	return names, nil
+}
+
 func (r *Repository) getByName(ctx context.Context, name string) (*Recipe, error) {
 	var recipe Recipe
 
@@ -59,7 +260,7 @@ func (r *Repository) getByName(ctx context.Context, name string) (*Recipe, error
 	return &recipe, nil
 }
 
-func (r *Repository) processRecipesAndIngredients(ctx context.Context, recipes model.Request) (map[string]bool, error) {
+func (r *Repository) processRecipesAndIngredients(ctx context.Context, recipes model.Request, info revisionInfo) (map[string]bool, error) {
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "beginning transaction")
@@ -108,6 +309,33 @@ func (r *Repository) processRecipesAndIngredients(ctx context.Context, recipes m
 		}
 	}
 
+	if len(newRecipes) > 0 {
+		ids := make([]uuid.UUID, len(newRecipes))
+		for i, recipe := range newRecipes {
+			ids[i] = recipe.ID
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO recipe_revisions (recipe_id, revision, editor_id, source, note, snapshot)
+			SELECT ids.id, 1, NULLIF($2, '')::uuid, $3, $4, recipe_snapshot(ids.id)
+			FROM unnest($1::uuid[]) AS ids(id)`, pq.Array(ids), info.editorID, info.source, info.note)
+		if err != nil {
+			err = errors.Wrap(err, "tx.ExecContext failed for first revisions")
+			return nil, err
+		}
+
+		// Crawled recipes keep what the source had as the base later
+		// re-imports are merged against.
+		if info.source == SourceCrawler {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE recipes SET source_snapshot = recipe_snapshot(id)
+				WHERE id = ANY($1::uuid[])`, pq.Array(ids))
+			if err != nil {
+				err = errors.Wrap(err, "tx.ExecContext failed for source snapshots")
+				return nil, err
+			}
+		}
+	}
+
 	return successMap, nil
 }
 
@@ -122,16 +350,16 @@ func (r *Repository) bulkUpsertRecipes(ctx context.Context, tx *sqlx.Tx, recipes
 	index := 1
 	for _, recipe := range recipes {
 		if _, exists := existingRecipes[strings.TrimSpace(recipe.Name)]; !exists {
-			insertValues = append(insertValues, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)", index, index+1, index+2, index+3, index+4, index+5))
-			insertArgs = append(insertArgs, recipe.ID, recipe.Name, recipe.Description, recipe.ImgUrl, recipe.CookingTime, pq.Array(recipe.Instructions))
-			index += 6
+			insertValues = append(insertValues, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, NULLIF($%d, ''))", index, index+1, index+2, index+3, index+4, index+5, index+6))
+			insertArgs = append(insertArgs, recipe.ID, recipe.Name, recipe.Description, recipe.ImgUrl, recipe.CookingTime, pq.Array(recipe.Instructions), recipe.SourceURL)
+			index += 7
 		}
 	}
 
 	results := make(map[string]bool)
 
 	if len(insertValues) > 0 {
-		insertQuery := "INSERT INTO recipes (id, name, description, img_url, cooking_time, instructions) VALUES " +
+		insertQuery := "INSERT INTO recipes (id, name, description, img_url, cooking_time, instructions, source_url) VALUES " +
 			strings.Join(insertValues, ", ") + " RETURNING name"
 		rows, err := tx.QueryContext(ctx, insertQuery, insertArgs...)
 		if err != nil {
@@ -201,15 +429,16 @@ func (r *Repository) linkIngredients(ctx context.Context, tx *sqlx.Tx, ingredien
 	for _, recipe := range recipes {
 		for _, ingredient := range recipe.Ingredients {
 			if ingredientID, ok := ingredientIDs[ingredient.Name]; ok {
-				linkValues = append(linkValues, fmt.Sprintf("($%d, $%d, $%d)", index, index+1, index+2))
-				linkArgs = append(linkArgs, recipe.ID, ingredientID, ingredient.Quantity)
-				index += 3
+				q := quantity.Parse(ingredient.Quantity)
+				linkValues = append(linkValues, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", index, index+1, index+2, index+3, index+4, index+5, index+6))
+				linkArgs = append(linkArgs, recipe.ID, ingredientID, ingredient.Quantity, q.Amount, q.AmountMax, q.Unit, q.Note)
+				index += 7
 			}
 		}
 	}
 
 	if len(linkValues) > 0 {
-		linkQuery := "INSERT INTO recipe_ingredients (recipe_id, ingredient_id, quantity) VALUES " +
+		linkQuery := "INSERT INTO recipe_ingredients (recipe_id, ingredient_id, quantity, amount, amount_max, unit, note) VALUES " +
 			strings.Join(linkValues, ", ") + " ON CONFLICT (recipe_id, ingredient_id) DO NOTHING"
 		if _, err := tx.ExecContext(ctx, linkQuery, linkArgs...); err != nil {
 			return errors.Wrap(err, "tx.ExecContext failed for linkQuery in linkIngredients")
@@ -301,16 +530,18 @@ func (r *Repository) list(ctx context.Context, userID string, recipeName string)
 
 	if userID != "" {
 		query = `
-			SELECT r.id, r.name, COALESCE(l.liked, false) AS liked
+			SELECT r.id, r.name, COALESCE(l.liked, false) AS liked, ` + ratingColumns + `
 			FROM recipes r
 			LEFT JOIN (SELECT recipe_id, true AS liked FROM likes WHERE user_id = $1) l ON r.id = l.recipe_id
-			WHERE r.name ILIKE $2
+			LEFT JOIN recipe_rating_stats rs ON rs.recipe_id = r.id
+			WHERE ` + allergenExclusion("$1") + ` AND ` + feedbackExclusion("$1") + ` AND r.name ILIKE $2
 			ORDER BY r.name`
 		args = append(args, userID, "%"+recipeName+"%")
 	} else {
 		query = `
-			SELECT r.id, r.name, false AS liked
+			SELECT r.id, r.name, false AS liked, ` + ratingColumns + `
 			FROM recipes r
+			LEFT JOIN recipe_rating_stats rs ON rs.recipe_id = r.id
 			WHERE r.name ILIKE $1
 			ORDER BY r.name`
 		args = append(args, "%"+recipeName+"%")
@@ -323,23 +554,344 @@ func (r *Repository) list(ctx context.Context, userID string, recipeName string)
 	return recipes, nil
 }
 
-func (r *Repository) update(ctx context.Context, data Recipe) (*Recipe, error) {
-	res, err := r.db.ExecContext(ctx, "UPDATE recipes SET name = $1, cooking_time = $2, instructions = $3, updated_at = $4 WHERE id = $5", data.Name, data.CookingTime, data.Instructions, data.UpdatedAt, data.Id)
+// revisionInfo says who made a change, how and why.
+type revisionInfo struct {
+	editorID string
+	source   string
+	note     string
+}
+
+// update applies changes to the recipe, its ingredients and its details in
+// one transaction and records the result as a new revision. ifMatch must
+// name the version the changes were based on, or be "*", so an editor
+// working from a stale copy gets a 412 instead of overwriting someone
+// else's edit. It reports false when the changes left the recipe as it was.
+func (r *Repository) update(ctx context.Context, id, ifMatch string, changes PatchRequest, info revisionInfo) (bool, error) {
+	recipeID, err := pkg.ParseID(id)
+	if err != nil {
+		return false, err
+	}
+	if ifMatch == "" {
+		return false, liberror.New("Send the recipe's ETag in If-Match or its updated_at in the body", http.StatusPreconditionRequired)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var current struct {
+		UpdatedAt time.Time `db:"updated_at"`
+		Snapshot  Snapshot  `db:"snapshot"`
+	}
+	err = tx.GetContext(ctx, &current, `
+		SELECT updated_at, recipe_snapshot(id) AS snapshot
+		FROM recipes
+		WHERE id = $1
+		FOR UPDATE`, recipeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = liberror.New("Recipe not found", http.StatusNotFound)
+		return false, err
+	}
+	if err != nil {
+		err = errors.Wrap(err, "GetContext: failed to lock recipe")
+		return false, err
+	}
+	if !matchesETag(ifMatch, current.UpdatedAt) {
+		err = liberror.New("Recipe was changed by someone else. Reload it and apply your changes again", http.StatusPreconditionFailed)
+		return false, err
+	}
+
+	changed, err := r.applyChanges(ctx, tx, recipeID, current.Snapshot, changes, info)
+	return changed, err
+}
+
+// applyChanges writes changes over current, the locked recipe as it now
+// stands, and records a revision. It reports false when the changes leave
+// the recipe as it was.
+func (r *Repository) applyChanges(ctx context.Context, tx *sqlx.Tx, recipeID uuid.UUID, current Snapshot, changes PatchRequest, info revisionInfo) (bool, error) {
+	next := changes.applyTo(current)
+	if len(diffSnapshots(current, next)) == 0 {
+		return false, nil
+	}
+
+	if next.Name != current.Name {
+		var taken bool
+		err := tx.GetContext(ctx, &taken, `SELECT EXISTS (SELECT 1 FROM recipes WHERE name = $1 AND id <> $2)`, next.Name, recipeID)
+		if err != nil {
+			return false, errors.Wrap(err, "GetContext: failed to check recipe name")
+		}
+		if taken {
+			return false, liberror.New("A recipe with this name already exists", http.StatusConflict)
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE recipes
+		SET name = $2, description = $3, cooking_time = $4, instructions = $5, img_url = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		recipeID, next.Name, next.Description, next.CookingTime, pq.Array(next.Instructions), next.ImgUrl)
+	if err != nil {
+		return false, errors.Wrap(err, "ExecContext: failed to update recipe")
+	}
+
+	if changes.Ingredients != nil {
+		if err := r.replaceIngredients(ctx, tx, recipeID, next.Ingredients); err != nil {
+			return false, err
+		}
+	}
+
+	if next.Details != current.Details {
+		if err := saveDetails(ctx, tx, recipeID, next.Details); err != nil {
+			return false, err
+		}
+	}
+
+	if err := addRevision(ctx, tx, recipeID, info); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reimport merges crawled into the recipe, locked for the duration, against
+// the recipe as the source last had it, then records crawled as the new
+// base. A recipe imported before bases were kept only has its base and
+// sourceURL recorded.
+func (r *Repository) reimport(ctx context.Context, id, sourceURL string, crawled Snapshot, info revisionInfo) (bool, error) {
+	recipeID, err := pkg.ParseID(id)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var current struct {
+		Snapshot Snapshot `db:"snapshot"`
+		Base     []byte   `db:"source_snapshot"`
+	}
+	err = tx.GetContext(ctx, &current, `
+		SELECT recipe_snapshot(id) AS snapshot, source_snapshot
+		FROM recipes
+		WHERE id = $1
+		FOR UPDATE`, recipeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = liberror.New("Recipe not found", http.StatusNotFound)
+		return false, err
+	}
+	if err != nil {
+		err = errors.Wrap(err, "GetContext: failed to lock recipe")
+		return false, err
+	}
+
+	base := crawled
+	if current.Base != nil {
+		base = Snapshot{}
+		if err = json.Unmarshal(current.Base, &base); err != nil {
+			err = errors.Wrap(err, "json.Unmarshal: failed to read source snapshot")
+			return false, err
+		}
+	}
+
+	changed, err := r.applyChanges(ctx, tx, recipeID, current.Snapshot, mergeImport(base, crawled, current.Snapshot), info)
+	if err != nil {
+		return false, err
+	}
+
+	snapshot, err := json.Marshal(crawled)
+	if err != nil {
+		err = errors.Wrap(err, "json.Marshal: failed to encode source snapshot")
+		return false, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE recipes
+		SET source_url = COALESCE(NULLIF($2, ''), source_url), source_snapshot = $3
+		WHERE id = $1`, recipeID, sourceURL, snapshot)
+	if err != nil {
+		err = errors.Wrap(err, "ExecContext: failed to save source snapshot")
+		return false, err
+	}
+	return changed, nil
+}
+
+// replaceIngredients swaps the recipe's ingredient list, creating any
+// ingredient that is not known yet.
+func (r *Repository) replaceIngredients(ctx context.Context, tx *sqlx.Tx, recipeID uuid.UUID, ingredients []IngredientQuantity) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recipe_ingredients WHERE recipe_id = $1`, recipeID); err != nil {
+		return errors.Wrap(err, "ExecContext: failed to clear recipe ingredients")
+	}
+
+	names := make([]string, len(ingredients))
+	links := make([]model.IngredientRequest, len(ingredients))
+	for i, ingredient := range ingredients {
+		names[i] = ingredient.Name
+		links[i] = model.IngredientRequest{Name: ingredient.Name, Quantity: ingredient.Quantity}
+	}
+
+	ingredientIDs, err := r.bulkUpsertIngredients(ctx, tx, names)
+	if err != nil {
+		return err
+	}
+	return r.linkIngredients(ctx, tx, ingredientIDs, model.Request{{ID: recipeID, Ingredients: links}})
+}
+
+// saveDetails writes the recipe's recipe_details row, creating it if the
+// recipe has none. Empty attributes are stored as NULL.
+func saveDetails(ctx context.Context, tx *sqlx.Tx, recipeID uuid.UUID, details Details) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO recipe_details (recipe_id, meal_type, food_class, region, spiciness_level, main_ingredients, cooking_method, description)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''))
+		ON CONFLICT (recipe_id) DO UPDATE
+		SET meal_type = EXCLUDED.meal_type,
+			food_class = EXCLUDED.food_class,
+			region = EXCLUDED.region,
+			spiciness_level = EXCLUDED.spiciness_level,
+			main_ingredients = EXCLUDED.main_ingredients,
+			cooking_method = EXCLUDED.cooking_method,
+			description = EXCLUDED.description`,
+		recipeID, details.MealType, details.FoodClass, details.Region, details.SpicinessLevel,
+		details.MainIngredients, details.CookingMethod, details.Description)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to save recipe details")
+	}
+	return nil
+}
+
+// addRevision snapshots the recipe as it now stands. The recipe row must be
+// locked so revision numbers are handed out one at a time.
+func addRevision(ctx context.Context, tx *sqlx.Tx, recipeID uuid.UUID, info revisionInfo) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO recipe_revisions (recipe_id, revision, editor_id, source, note, snapshot)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, NULLIF($2, '')::uuid, $3, $4, recipe_snapshot($1)
+		FROM recipe_revisions
+		WHERE recipe_id = $1`, recipeID, info.editorID, info.source, info.note)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to add recipe revision")
+	}
+	return nil
+}
+
+// revisions lists the recipe's history, newest first.
+func (r *Repository) revisions(ctx context.Context, id string, page, pageSize int) ([]Revision, *pkg.Pagination, error) {
+	recipeID, err := pkg.ParseID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var totalItems int
+	err = r.db.GetContext(ctx, &totalItems, `SELECT COUNT(*) FROM recipe_revisions WHERE recipe_id = $1`, recipeID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "GetContext: failed to count revisions")
+	}
+	if totalItems == 0 {
+		return nil, nil, liberror.New("Recipe not found", http.StatusNotFound)
+	}
+
+	revisions := []Revision{}
+	err = r.db.SelectContext(ctx, &revisions, `
+		SELECT rv.revision, rv.editor_id, u.username AS editor_name, rv.source, rv.note, rv.created_at
+		FROM recipe_revisions rv
+		LEFT JOIN users u ON u.id = rv.editor_id
+		WHERE rv.recipe_id = $1
+		ORDER BY rv.revision DESC
+		LIMIT $2 OFFSET $3`, recipeID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "SelectContext: failed to get revisions")
+	}
+
+	return revisions, pkg.NewPagination(page, pageSize, totalItems), nil
+}
+
+// revision returns one revision with its snapshot. Revision 0 is the latest.
+func (r *Repository) revision(ctx context.Context, id string, number int) (*Revision, error) {
+	recipeID, err := pkg.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var revision Revision
+	err = r.db.GetContext(ctx, &revision, `
+		SELECT rv.revision, rv.editor_id, u.username AS editor_name, rv.source, rv.note, rv.snapshot, rv.created_at
+		FROM recipe_revisions rv
+		LEFT JOIN users u ON u.id = rv.editor_id
+		WHERE rv.recipe_id = $1 AND ($2 = 0 OR rv.revision = $2)
+		ORDER BY rv.revision DESC
+		LIMIT 1`, recipeID, number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, liberror.New("Revision not found", http.StatusNotFound)
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "ExecContext failed")
+		return nil, errors.Wrap(err, "GetContext: failed to get revision")
+	}
+	return &revision, nil
+}
+
+// importedIDs maps the names of crawled recipes that were imported before
+// to their IDs. Recipes are matched by source URL, so renaming one does not
+// break the link; recipes imported before URLs were kept are matched by
+// name.
+func (r *Repository) importedIDs(ctx context.Context, recipes model.Request) (map[string]string, error) {
+	names := make([]string, len(recipes))
+	urls := make([]string, len(recipes))
+	for i, recipe := range recipes {
+		names[i] = recipe.Name
+		urls[i] = recipe.SourceURL
 	}
-	if count, err := res.RowsAffected(); err != nil {
-		return nil, errors.Wrap(err, "RowsAffected")
-	} else if count != 1 {
-		return nil, errors.New("no rows affected")
+
+	rows := []struct {
+		ID   string `db:"id"`
+		Name string `db:"name"`
+	}{}
+	err := r.db.SelectContext(ctx, &rows, `
+		SELECT c.name, r.id
+		FROM unnest($1::text[], $2::text[]) AS c(name, url)
+		JOIN LATERAL (
+			SELECT id
+			FROM recipes
+			WHERE (c.url <> '' AND source_url = c.url)
+				OR (source_url IS NULL AND source_snapshot IS NOT NULL AND name = c.name)
+			ORDER BY source_url IS NULL
+			LIMIT 1
+		) r ON TRUE`, pq.Array(names), pq.Array(urls))
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get imported recipe IDs")
 	}
 
-	return &data, nil
+	ids := make(map[string]string, len(rows))
+	for _, row := range rows {
+		ids[row.Name] = row.ID
+	}
+	return ids, nil
 }
 
 type Ingredient struct {
 	Name         string   `json:"name"`
 	Quantity     string   `json:"quantity"`
+	Display      string   `json:"display"`
 	Alternatives []string `json:"alternatives"`
 }
 
@@ -354,20 +906,119 @@ func (i *Ingredients) Scan(value interface{}) error {
 }
 
 type ResponseData struct {
-	ID           uuid.UUID      `db:"id"`
-	Name         string         `json:"name" db:"name"`
-	Description  string         `json:"description" db:"description"`
-	CookingTime  string         `json:"cooking_time" db:"cooking_time"`
-	Instructions pq.StringArray `json:"instructions" db:"instructions"`
-	ImgUrl       string         `json:"img_url" db:"img_url"`
-	Ingredients  []Ingredient   `json:"ingredients" db:"ingredients"`
-	Diff         int            `json:"diff" db:"diff"`
-	FoodHealth   string         `json:"food_health,omitempty" db:"food_health"`
-	FoodClass    string         `json:"food_class,omitempty" db:"food_class"`
-	Region       string         `json:"region,omitempty" db:"region"`
-	SpiceLevel   string         `json:"spice_level,omitempty" db:"spice_level"`
-	Type         string         `json:"type,omitempty" db:"type"`
-	Liked        bool           `json:"liked" db:"liked"`
+	ID            uuid.UUID      `db:"id"`
+	Name          string         `json:"name" db:"name"`
+	Description   string         `json:"description" db:"description"`
+	CookingTime   string         `json:"cooking_time" db:"cooking_time"`
+	Instructions  pq.StringArray `json:"instructions" db:"instructions"`
+	ImgUrl        string         `json:"img_url" db:"img_url"`
+	Ingredients   []Ingredient   `json:"ingredients" db:"ingredients"`
+	Diff          int            `json:"diff" db:"diff"`
+	FoodHealth    string         `json:"food_health,omitempty" db:"food_health"`
+	FoodClass     string         `json:"food_class,omitempty" db:"food_class"`
+	Region        string         `json:"region,omitempty" db:"region"`
+	SpiceLevel    string         `json:"spice_level,omitempty" db:"spice_level"`
+	Type          string         `json:"type,omitempty" db:"type"`
+	Liked         bool           `json:"liked" db:"liked"`
+	AverageRating float64        `json:"average_rating" db:"average_rating"`
+	RatingCount   int            `json:"rating_count" db:"rating_count"`
+}
+
+// dietaryExclusion filters out recipes that break the diet saved in the
+// searcher's profile, joined as p. Without a profile row every test is NULL
+// and nothing is excluded.
+const dietaryExclusion = `NOT EXISTS (
+	SELECT 1
+	FROM recipe_diet_conflicts c
+	WHERE c.recipe_id = r.id
+	  AND ((c.diet = 'vegetarian' AND p.vegetarian) OR (c.diet = 'gluten_free' AND p.gluten_free)))`
+
+// allergenExclusion drops recipes containing an allergen on the list of the
+// user bound to userParam. It is a hard filter and must accompany every
+// query that surfaces recipes to a signed-in user.
+func allergenExclusion(userParam string) string {
+	return `NOT EXISTS (
+	SELECT 1
+	FROM recipe_allergens ra
+	JOIN user_allergens ua ON ua.allergen = ra.allergen
+	WHERE ra.recipe_id = r.id AND ua.user_id = ` + userParam + `)`
+}
+
+// feedbackExclusion drops recipes the user bound to userParam disliked or
+// hid.
+func feedbackExclusion(userParam string) string {
+	return `NOT EXISTS (
+	SELECT 1
+	FROM recipe_dislikes d
+	WHERE d.recipe_id = r.id AND d.user_id = ` + userParam + `)`
+}
+
+// dietaryScore adjusts a recipe's score for the dietary profile joined as p
+// the way recommend_recipes_for_users does: each disliked ingredient costs a
+// point and the preferred cuisine earns a tenth, so cuisine only breaks
+// near ties.
+const dietaryScore = `(CASE WHEN recipe_cuisine_match(r.id, ARRAY[COALESCE(p.cuisine_preference, '')]) THEN 0.1 ELSE 0 END
+	- recipe_disliked_count(r.id, COALESCE(p.disliked_ingredients, '{}')))`
+
+// ratingColumns selects the stats of recipe_rating_stats joined as rs, with
+// zeroes for recipes nobody has rated.
+const ratingColumns = `COALESCE(rs.average_rating, 0) AS average_rating, COALESCE(rs.rating_count, 0) AS rating_count`
+
+// searchFilter holds the optional query parameters that narrow or reorder
+// a search.
+type searchFilter struct {
+	// order is an ORDER BY prefix; empty keeps each query's own ordering.
+	order string
+	// collectionID limits results to one collection when valid.
+	collectionID sql.NullString
+}
+
+// collectionFilter keeps recipes in the collection bound to param, or all
+// recipes when it is NULL.
+func collectionFilter(param string) string {
+	return `(` + param + `::uuid IS NULL OR EXISTS (
+	SELECT 1
+	FROM collection_recipes cm
+	WHERE cm.recipe_id = r.id AND cm.collection_id = ` + param + `::uuid))`
+}
+
+// parseSearchFilter reads ?sort= and ?collection_id=. Popularity comes from
+// the last 30 days of recipe_events. A collection must be public or belong
+// to the searcher.
+func (r *Repository) parseSearchFilter(ctx context.Context, queryParams url.Values, userID string) (*searchFilter, error) {
+	var filter searchFilter
+
+	switch queryParams.Get("sort") {
+	case "", "relevance":
+	case "rating":
+		filter.order = "COALESCE(rs.average_rating, 0) DESC, COALESCE(rs.rating_count, 0) DESC, "
+	case "popular":
+		filter.order = "COALESCE((SELECT pop.score FROM recipe_popularity pop WHERE pop.recipe_id = r.id), 0) DESC, "
+	default:
+		return nil, liberror.New("sort must be one of relevance, rating or popular", http.StatusBadRequest)
+	}
+
+	if collectionID := queryParams.Get("collection_id"); collectionID != "" {
+		if _, err := uuid.Parse(collectionID); err != nil {
+			return nil, liberror.New("collection_id must be a valid ID", http.StatusBadRequest)
+		}
+
+		var visible bool
+		err := r.db.GetContext(ctx, &visible, `
+			SELECT EXISTS (
+				SELECT 1 FROM collections
+				WHERE id = $1 AND (visibility = 'public' OR user_id = NULLIF($2, '')::uuid)
+			)`, collectionID, userID)
+		if err != nil {
+			return nil, errors.Wrap(err, "db.GetContext failed")
+		}
+		if !visible {
+			return nil, liberror.New("Collection not found", http.StatusNotFound)
+		}
+		filter.collectionID = sql.NullString{String: collectionID, Valid: true}
+	}
+
+	return &filter, nil
 }
 
 func (r *Repository) search(ctx context.Context, ingredients []string, queryParams url.Values, userID string) ([]ResponseData, *pkg.Pagination, error) {
@@ -376,15 +1027,20 @@ func (r *Repository) search(ctx context.Context, ingredients []string, queryPara
 		return nil, nil, err
 	}
 
+	filter, err := r.parseSearchFilter(ctx, queryParams, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	if (len(ingredients) == 0) || strings.TrimSpace(ingredients[0]) == "" {
-		matches, pagination, err := r.findAllRecipes(ctx, queryParams, userID, page, pageSize)
+		matches, pagination, err := r.findAllRecipes(ctx, queryParams, filter, userID, page, pageSize)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "find all recipes failed")
 		}
 		return r.getIngredientsForRecipes(ctx, matches, pagination)
 	}
 
-	matches, pagination, err := r.getClosestRecipeWithDetails(ctx, ingredients, userID, page, pageSize)
+	matches, pagination, err := r.getClosestRecipeWithDetails(ctx, ingredients, filter, userID, page, pageSize)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "get closest recipe with details failed")
 	}
@@ -392,14 +1048,15 @@ func (r *Repository) search(ctx context.Context, ingredients []string, queryPara
 	return r.getIngredientsForRecipes(ctx, matches, pagination)
 }
 
-func (r *Repository) findAllRecipes(ctx context.Context, queryParams url.Values, userID string, page, pageSize int) ([]ResponseData, *pkg.Pagination, error) {
+func (r *Repository) findAllRecipes(ctx context.Context, queryParams url.Values, filter *searchFilter, userID string, page, pageSize int) ([]ResponseData, *pkg.Pagination, error) {
 	var recipes []ResponseData
 
 	if queryParams == nil {
 		query := `
-			SELECT r.id, r.name, r.description, r.cooking_time, r.instructions, r.img_url, false AS liked
+			SELECT r.id, r.name, r.description, r.cooking_time, r.instructions, r.img_url, false AS liked, ` + ratingColumns + `
 			FROM recipes r
-			ORDER BY r.name`
+			LEFT JOIN recipe_rating_stats rs ON rs.recipe_id = r.id
+			ORDER BY ` + filter.order + `r.name`
 		err := r.db.SelectContext(ctx, &recipes, query)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "db.SelectContext failed")
@@ -408,8 +1065,17 @@ func (r *Repository) findAllRecipes(ctx context.Context, queryParams url.Values,
 	}
 
 	var totalItems int
-	countQuery := `SELECT COUNT(*) FROM recipes`
-	err := r.db.GetContext(ctx, &totalItems, countQuery)
+	var err error
+	if userID == "" {
+		err = r.db.GetContext(ctx, &totalItems, `SELECT COUNT(*) FROM recipes r WHERE `+collectionFilter("$1"), filter.collectionID)
+	} else {
+		err = r.db.GetContext(ctx, &totalItems, `
+			SELECT COUNT(*)
+			FROM recipes r
+			LEFT JOIN user_preferences p ON p.user_id = $1
+			WHERE `+dietaryExclusion+` AND `+allergenExclusion("$1")+` AND `+feedbackExclusion("$1")+`
+				AND `+collectionFilter("$2"), userID, filter.collectionID)
+	}
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "db.GetContext failed")
 	}
@@ -417,19 +1083,25 @@ func (r *Repository) findAllRecipes(ctx context.Context, queryParams url.Values,
 	var query string
 	if userID == "" {
 		query = `
-			SELECT r.id, r.name, r.description, r.cooking_time, r.instructions, r.img_url, false AS liked
+			SELECT r.id, r.name, r.description, r.cooking_time, r.instructions, r.img_url, false AS liked, ` + ratingColumns + `
 			FROM recipes r
-			ORDER BY r.name`
+			LEFT JOIN recipe_rating_stats rs ON rs.recipe_id = r.id
+			WHERE ` + collectionFilter("$1") + `
+			ORDER BY ` + filter.order + `r.name`
 		query = pkg.ApplyToQuery(query, page, pageSize)
-		err = r.db.SelectContext(ctx, &recipes, query)
+		err = r.db.SelectContext(ctx, &recipes, query, filter.collectionID)
 	} else {
 		query = `
-			SELECT r.id, r.name, r.description, r.cooking_time, r.instructions, r.img_url, COALESCE(l.liked, false) AS liked
+			SELECT r.id, r.name, r.description, r.cooking_time, r.instructions, r.img_url, COALESCE(l.liked, false) AS liked, ` + ratingColumns + `
 			FROM recipes r
 			LEFT JOIN (SELECT recipe_id, true AS liked FROM likes WHERE user_id = $1) l ON r.id = l.recipe_id
-			ORDER BY r.name`
+			LEFT JOIN user_preferences p ON p.user_id = $1
+			LEFT JOIN recipe_rating_stats rs ON rs.recipe_id = r.id
+			WHERE ` + dietaryExclusion + ` AND ` + allergenExclusion("$1") + ` AND ` + feedbackExclusion("$1") + `
+				AND ` + collectionFilter("$2") + `
+			ORDER BY ` + filter.order + dietaryScore + ` DESC, r.name`
 		query = pkg.ApplyToQuery(query, page, pageSize)
-		err = r.db.SelectContext(ctx, &recipes, query, userID)
+		err = r.db.SelectContext(ctx, &recipes, query, userID, filter.collectionID)
 	}
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "db.SelectContext failed")
@@ -439,48 +1111,56 @@ func (r *Repository) findAllRecipes(ctx context.Context, queryParams url.Values,
 	return recipes, pagination, nil
 }
 
-func (r *Repository) getClosestRecipeWithDetails(ctx context.Context, ingredients []string, userID string, page, pageSize int) ([]ResponseData, *pkg.Pagination, error) {
+func (r *Repository) getClosestRecipeWithDetails(ctx context.Context, ingredients []string, filter *searchFilter, userID string, page, pageSize int) ([]ResponseData, *pkg.Pagination, error) {
 	ingredientsArray := pq.Array(ingredients)
 
 	var totalItems int
-	countQuery := `
-    SELECT COUNT(*)
-    FROM find_recipes_by_jaccard_similarity($1::text[])
-    `
-	err := r.db.GetContext(ctx, &totalItems, countQuery, ingredientsArray)
+	var err error
+	if userID == "" {
+		err = r.db.GetContext(ctx, &totalItems, `
+			SELECT COUNT(*)
+			FROM find_recipes_by_jaccard_similarity($1::text[]) cr
+			JOIN recipes r ON r.id = cr.recipe_id
+			WHERE `+collectionFilter("$2"), ingredientsArray, filter.collectionID)
+	} else {
+		err = r.db.GetContext(ctx, &totalItems, `
+			SELECT COUNT(*)
+			FROM find_recipes_by_jaccard_similarity($1::text[]) cr
+			JOIN recipes r ON r.id = cr.recipe_id
+			LEFT JOIN user_preferences p ON p.user_id = $2
+			WHERE `+dietaryExclusion+` AND `+allergenExclusion("$2")+` AND `+feedbackExclusion("$2")+`
+				AND `+collectionFilter("$3"), ingredientsArray, userID, filter.collectionID)
+	}
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "db.GetContext failed")
 	}
 
-	query := `
-    WITH closest_recipes AS (
-        SELECT recipe_id, similarity_score
-        FROM find_recipes_by_jaccard_similarity($1::text[])
-        ORDER BY similarity_score DESC
-        LIMIT $2 OFFSET $3
-    )
-    SELECT 
-        r.id, r.name, r.description, r.cooking_time, r.instructions, r.img_url, 
-        %s AS liked
-    FROM closest_recipes cr
-    JOIN recipes r ON r.id = cr.recipe_id
-    %s
-    `
-
-	likedQuery := "false"
-	joinQuery := ""
-	if userID != "" {
-		likedQuery = "COALESCE(l.liked, false)"
-		joinQuery = "LEFT JOIN (SELECT recipe_id, true AS liked FROM likes WHERE user_id = $4) l ON r.id = l.recipe_id"
-	}
-
-	finalQuery := fmt.Sprintf(query, likedQuery, joinQuery)
-
 	var recipes []ResponseData
 	if userID == "" {
-		err = r.db.SelectContext(ctx, &recipes, finalQuery, ingredientsArray, pageSize, (page-1)*pageSize)
+		err = r.db.SelectContext(ctx, &recipes, `
+			SELECT
+				r.id, r.name, r.description, r.cooking_time, r.instructions, r.img_url,
+				false AS liked, `+ratingColumns+`
+			FROM find_recipes_by_jaccard_similarity($1::text[]) cr
+			JOIN recipes r ON r.id = cr.recipe_id
+			LEFT JOIN recipe_rating_stats rs ON rs.recipe_id = r.id
+			WHERE `+collectionFilter("$4")+`
+			ORDER BY `+filter.order+`cr.similarity_score DESC
+			LIMIT $2 OFFSET $3`, ingredientsArray, pageSize, (page-1)*pageSize, filter.collectionID)
 	} else {
-		err = r.db.SelectContext(ctx, &recipes, finalQuery, ingredientsArray, pageSize, (page-1)*pageSize, userID)
+		err = r.db.SelectContext(ctx, &recipes, `
+			SELECT
+				r.id, r.name, r.description, r.cooking_time, r.instructions, r.img_url,
+				COALESCE(l.liked, false) AS liked, `+ratingColumns+`
+			FROM find_recipes_by_jaccard_similarity($1::text[]) cr
+			JOIN recipes r ON r.id = cr.recipe_id
+			LEFT JOIN (SELECT recipe_id, true AS liked FROM likes WHERE user_id = $4) l ON r.id = l.recipe_id
+			LEFT JOIN user_preferences p ON p.user_id = $4
+			LEFT JOIN recipe_rating_stats rs ON rs.recipe_id = r.id
+			WHERE `+dietaryExclusion+` AND `+allergenExclusion("$4")+` AND `+feedbackExclusion("$4")+`
+				AND `+collectionFilter("$5")+`
+			ORDER BY `+filter.order+`cr.similarity_score + `+dietaryScore+` DESC
+			LIMIT $2 OFFSET $3`, ingredientsArray, pageSize, (page-1)*pageSize, userID, filter.collectionID)
 	}
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "db.SelectContext failed")
@@ -1,14 +1,24 @@
 package recipe
 
 import (
+	liberror "Food/internal/errors"
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 )
 
 type ListResponse struct {
-	ID    string `db:"id" json:"id"`
-	Name  string `db:"name" json:"name"`
-	Liked bool   `db:"liked" json:"liked"`
+	ID            string  `db:"id" json:"id"`
+	Name          string  `db:"name" json:"name"`
+	Liked         bool    `db:"liked" json:"liked"`
+	AverageRating float64 `db:"average_rating" json:"average_rating"`
+	RatingCount   int     `db:"rating_count" json:"rating_count"`
 }
 
 type SearchRequest struct {
@@ -19,3 +29,271 @@ func (s SearchRequest) Bind(r *http.Request) error {
 	log.Printf("Binding search request: %v", s)
 	return nil
 }
+
+// parseInclude reads the comma-separated ?include= list of optional recipe
+// parts.
+func parseInclude(value string) (map[string]bool, error) {
+	include := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		switch part = strings.TrimSpace(strings.ToLower(part)); part {
+		case "":
+		case IncludeAllergens, IncludeReviews, IncludeCollections:
+			include[part] = true
+		default:
+			return nil, liberror.New(fmt.Sprintf("include must be a list of %s, %s or %s", IncludeAllergens, IncludeReviews, IncludeCollections), http.StatusBadRequest)
+		}
+	}
+	return include, nil
+}
+
+type IngredientQuantity struct {
+	Name     string `json:"name"`
+	Quantity string `json:"quantity"`
+}
+
+// UpdateRequest replaces every editable part of a recipe; omitted fields are
+// reset. UpdatedAt is the version the edit was based on and is only needed
+// when no If-Match header is sent. Note is kept with the revision.
+type UpdateRequest struct {
+	Snapshot
+	Note      string     `json:"note"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// Bind validates the update as a patch that sets every field, so missing
+// names, instructions and ingredients are rejected.
+func (v *UpdateRequest) Bind(r *http.Request) error {
+	patch := v.patch()
+	return patch.Bind(r)
+}
+
+// patch returns the update as a PatchRequest that sets every field. The
+// fields are shared, so binding the patch normalises v as well.
+func (v *UpdateRequest) patch() PatchRequest {
+	return PatchRequest{
+		Name:         &v.Name,
+		Description:  &v.Description,
+		CookingTime:  &v.CookingTime,
+		Instructions: &v.Instructions,
+		ImgUrl:       &v.ImgUrl,
+		Ingredients:  &v.Ingredients,
+		Details: &DetailsPatch{
+			MealType:        &v.Details.MealType,
+			FoodClass:       &v.Details.FoodClass,
+			Region:          &v.Details.Region,
+			SpicinessLevel:  &v.Details.SpicinessLevel,
+			MainIngredients: &v.Details.MainIngredients,
+			CookingMethod:   &v.Details.CookingMethod,
+			Description:     &v.Details.Description,
+		},
+		Note:      &v.Note,
+		UpdatedAt: v.UpdatedAt,
+	}
+}
+
+// PatchRequest changes only the fields that are present. Ingredients and
+// instructions are replaced as a whole when given.
+type PatchRequest struct {
+	Name         *string               `json:"name"`
+	Description  *string               `json:"description"`
+	CookingTime  *string               `json:"cooking_time"`
+	Instructions *[]string             `json:"instructions"`
+	ImgUrl       *string               `json:"img_url"`
+	Ingredients  *[]IngredientQuantity `json:"ingredients"`
+	Details      *DetailsPatch         `json:"details"`
+	Note         *string               `json:"note"`
+	UpdatedAt    *time.Time            `json:"updated_at"`
+}
+
+type DetailsPatch struct {
+	MealType        *string `json:"meal_type"`
+	FoodClass       *string `json:"food_class"`
+	Region          *string `json:"region"`
+	SpicinessLevel  *string `json:"spiciness_level"`
+	MainIngredients *string `json:"main_ingredients"`
+	CookingMethod   *string `json:"cooking_method"`
+	Description     *string `json:"description"`
+}
+
+func (v *PatchRequest) Bind(r *http.Request) error {
+	trim(v.Name, v.Description, v.CookingTime, v.ImgUrl, v.Note)
+	if v.Instructions != nil {
+		steps := make([]string, 0, len(*v.Instructions))
+		for _, step := range *v.Instructions {
+			if step = strings.TrimSpace(step); step != "" {
+				steps = append(steps, step)
+			}
+		}
+		*v.Instructions = steps
+	}
+	if v.Ingredients != nil {
+		ingredients := make([]IngredientQuantity, len(*v.Ingredients))
+		for i, ingredient := range *v.Ingredients {
+			ingredients[i] = IngredientQuantity{
+				Name:     strings.TrimSpace(ingredient.Name),
+				Quantity: strings.TrimSpace(ingredient.Quantity),
+			}
+		}
+		*v.Ingredients = ingredients
+	}
+	if v.Details != nil {
+		d := v.Details
+		trim(d.MealType, d.FoodClass, d.Region, d.SpicinessLevel, d.MainIngredients, d.CookingMethod, d.Description)
+	}
+
+	checks := []validate.Validator{
+		&validators.FuncValidator{
+			Name:    "name",
+			Field:   "name",
+			Message: "%s must be between 1 and 200 characters",
+			Fn: func() bool {
+				return v.Name == nil || (*v.Name != "" && len(*v.Name) <= 200)
+			},
+		},
+		&validators.FuncValidator{
+			Name:    "instructions",
+			Field:   "instructions",
+			Message: "%s must have at least one step",
+			Fn: func() bool {
+				return v.Instructions == nil || len(*v.Instructions) > 0
+			},
+		},
+		&validators.FuncValidator{
+			Name:    "ingredients",
+			Field:   "ingredients",
+			Message: "%s must be a non-empty list of distinct, named ingredients with quantities of at most 100 characters",
+			Fn: func() bool {
+				if v.Ingredients == nil {
+					return true
+				}
+				if len(*v.Ingredients) == 0 {
+					return false
+				}
+				seen := make(map[string]bool, len(*v.Ingredients))
+				for _, ingredient := range *v.Ingredients {
+					key := strings.ToLower(ingredient.Name)
+					if key == "" || seen[key] || len(ingredient.Quantity) > 100 {
+						return false
+					}
+					seen[key] = true
+				}
+				return true
+			},
+		},
+		&validators.FuncValidator{
+			Name:    "img_url",
+			Field:   "img_url",
+			Message: "%s must be an http or https URL",
+			Fn: func() bool {
+				if v.ImgUrl == nil || *v.ImgUrl == "" {
+					return true
+				}
+				parsed, err := url.Parse(*v.ImgUrl)
+				return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" && len(*v.ImgUrl) <= 2048
+			},
+		},
+	}
+	checks = append(checks, maxLength("note", v.Note, 500))
+	if d := v.Details; d != nil {
+		checks = append(checks,
+			maxLength("details.meal_type", d.MealType, 50),
+			maxLength("details.food_class", d.FoodClass, 50),
+			maxLength("details.region", d.Region, 50),
+			maxLength("details.spiciness_level", d.SpicinessLevel, 50),
+			maxLength("details.main_ingredients", d.MainIngredients, 255),
+			maxLength("details.cooking_method", d.CookingMethod, 50),
+		)
+	}
+
+	err1 := validate.Validate(checks...)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+func (d *DetailsPatch) applyTo(details *Details) {
+	if d == nil {
+		return
+	}
+	set(&details.MealType, d.MealType)
+	set(&details.FoodClass, d.FoodClass)
+	set(&details.Region, d.Region)
+	set(&details.SpicinessLevel, d.SpicinessLevel)
+	set(&details.MainIngredients, d.MainIngredients)
+	set(&details.CookingMethod, d.CookingMethod)
+	set(&details.Description, d.Description)
+}
+
+// applyTo returns snapshot with the changes made.
+func (v PatchRequest) applyTo(snapshot Snapshot) Snapshot {
+	set(&snapshot.Name, v.Name)
+	set(&snapshot.Description, v.Description)
+	set(&snapshot.CookingTime, v.CookingTime)
+	set(&snapshot.ImgUrl, v.ImgUrl)
+	if v.Instructions != nil {
+		snapshot.Instructions = *v.Instructions
+	}
+	if v.Ingredients != nil {
+		snapshot.Ingredients = append([]IngredientQuantity(nil), *v.Ingredients...)
+		sort.Slice(snapshot.Ingredients, func(i, j int) bool {
+			return snapshot.Ingredients[i].Name < snapshot.Ingredients[j].Name
+		})
+	}
+	v.Details.applyTo(&snapshot.Details)
+	return snapshot
+}
+
+// note returns the change note, if any.
+func (v PatchRequest) note() string {
+	if v.Note == nil {
+		return ""
+	}
+	return *v.Note
+}
+
+func set(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func trim(fields ...*string) {
+	for _, field := range fields {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+}
+
+func maxLength(name string, field *string, max int) validate.Validator {
+	return &validators.FuncValidator{
+		Name:    name,
+		Field:   name,
+		Message: fmt.Sprintf("%%s must be at most %d characters", max),
+		Fn: func() bool {
+			return field == nil || len(*field) <= max
+		},
+	}
+}
+
+// RevertRequest restores an earlier revision. The precondition works as it
+// does for updates.
+type RevertRequest struct {
+	Note      string     `json:"note"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+func (v *RevertRequest) Bind(r *http.Request) error {
+	v.Note = strings.TrimSpace(v.Note)
+
+	err1 := validate.Validate(
+		&validators.StringLengthInRange{Name: "note", Field: v.Note, Max: 500, Message: fmt.Sprintf("%v must be at most 500 characters", "note")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package recipe
 
 import (
 	"Food/auth"
+	"Food/pkg/rating"
 	"Food/pkg/recipe/crawler"
 	"Food/pkg/user_preference"
 	"github.com/go-chi/chi/v5"
@@ -11,13 +12,15 @@ import (
 type Resource struct {
 	db          *sqlx.DB
 	crawlerList []crawler.ICrawler
+	authn       *auth.Authenticator
 }
 
 // NewResource creates and returns a resource.
-func NewResource(db *sqlx.DB, crawlerList []crawler.ICrawler) *Resource {
+func NewResource(db *sqlx.DB, crawlerList []crawler.ICrawler, authn *auth.Authenticator) *Resource {
 	return &Resource{
 		db:          db,
 		crawlerList: crawlerList,
+		authn:       authn,
 	}
 }
 
@@ -32,18 +35,37 @@ func (rs *Resource) Router() *chi.Mux {
 	hndlr := NewHandler(svc, usrPrefSvc)
 
 	r.Group(func(r chi.Router) {
-		r.Use(auth.MayAuthMiddleware)
+		r.Use(rs.authn.MayAuthMiddleware)
 		r.Post("/search", hndlr.search)
 	})
-	r.Get("/crawl", hndlr.crawl)
 	//r.Get("/generate-csv", hndlr.generateCsv)
+	r.Mount("/{id}/ratings", rating.NewResource(rs.db, rs.authn).Router())
 	r.Group(func(r chi.Router) {
-		r.Use(auth.MustAuthMiddleware)
-		r.Get("/{id}/like", hndlr.like)
+		r.Use(rs.authn.MustAuthMiddleware)
+		r.With(auth.RequireWriteScope).Get("/{id}/like", hndlr.like)
+		r.With(auth.RequireWriteScope).Put("/{id}/feedback", hndlr.feedback)
+		r.With(auth.RequireWriteScope).Delete("/{id}/feedback", hndlr.clearFeedback)
 		r.Get("/{id}", hndlr.get)
 		r.Get("/", hndlr.list)
-		r.Post("/", hndlr.save)
-		r.Delete("/{id}", hndlr.delete)
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireRole(auth.RoleAdmin, auth.RoleEditor))
+			r.Get("/{id}/revisions", hndlr.revisions)
+			r.Get("/{id}/revisions/diff", hndlr.diff)
+			r.Get("/{id}/revisions/{rev}", hndlr.revision)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireRole(auth.RoleAdmin, auth.RoleEditor), auth.RequireWriteScope)
+			r.Get("/crawl", hndlr.crawl)
+			r.Post("/", hndlr.save)
+			r.Put("/{id}", hndlr.replace)
+			r.Patch("/{id}", hndlr.patch)
+			r.Post("/{id}/revisions/{rev}/revert", hndlr.revert)
+			r.Delete("/{id}", hndlr.delete)
+		})
+
+		r.With(auth.RequireRole(auth.RoleAdmin), auth.RequireWriteScope).Post("/quantities/reparse", hndlr.reparseQuantities)
 	})
 
 	return r
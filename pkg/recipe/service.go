@@ -3,12 +3,15 @@ package recipe
 import (
 	liberror "Food/internal/errors"
 	"Food/pkg"
+	"Food/pkg/quantity"
 	"Food/pkg/recipe/crawler"
 	"Food/pkg/recipe/model"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"net/http"
 	"net/url"
 )
 
@@ -24,6 +27,8 @@ func NewService(repo *Repository, crawlerList []crawler.ICrawler) *Service {
 	}
 }
 
+// crawl saves new recipes and re-imports ones imported before. The result
+// is true for every recipe that was created or changed.
 func (s Service) crawl(ctx context.Context) (map[string]bool, error) {
 	recipeList := make([]model.RequestData, 0, len(s.crawlerList))
 	for _, c := range s.crawlerList {
@@ -34,13 +39,78 @@ func (s Service) crawl(ctx context.Context) (map[string]bool, error) {
 		}
 		recipeList = append(recipeList, *data...)
 	}
+	if len(recipeList) == 0 {
+		return map[string]bool{}, nil
+	}
+
+	ids, err := s.repo.importedIDs(ctx, recipeList)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("recipes.crawl", "recipe.importedIDs", "").WithError(err))
+	}
+
+	req := make(model.Request, 0, len(recipeList))
+	for _, data := range recipeList {
+		if _, ok := ids[data.Name]; !ok {
+			req = append(req, data)
+		}
+	}
+
+	successMap := map[string]bool{}
+	if len(req) > 0 {
+		successMap, err = s.save(ctx, req, revisionInfo{source: SourceCrawler, note: "Imported by crawler"})
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	req := model.Request(recipeList)
+	for _, data := range recipeList {
+		id, ok := ids[data.Name]
+		if !ok {
+			continue
+		}
+		successMap[data.Name], err = s.reimport(ctx, id, data)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return s.save(ctx, req)
+	return successMap, nil
 }
 
-func (s Service) save(ctx context.Context, recipes model.Request) (map[string]bool, error) {
+// reimport merges crawled data into a recipe imported before, as a new
+// revision. Only what the source changed since the last import is applied,
+// so editors' changes to anything else survive.
+func (s Service) reimport(ctx context.Context, id string, data model.RequestData) (bool, error) {
+	ingredients := make([]IngredientQuantity, len(data.Ingredients))
+	for i, ingredient := range data.Ingredients {
+		ingredients[i] = IngredientQuantity{Name: ingredient.Name, Quantity: ingredient.Quantity}
+	}
+	changes := PatchRequest{
+		Name:         &data.Name,
+		Description:  &data.Description,
+		CookingTime:  &data.CookingTime,
+		Instructions: (*[]string)(&data.Instructions),
+		ImgUrl:       &data.ImgUrl,
+		Ingredients:  &ingredients,
+	}
+	if err := changes.Bind(nil); err != nil {
+		log.WithFields(log.Fields{"service": "recipes.reimport", "recipe_id": id}).WithError(err).Warn("Skipping invalid crawled recipe")
+		return false, nil
+	}
+
+	changed, err := s.repo.reimport(ctx, id, data.SourceURL, changes.applyTo(Snapshot{}), revisionInfo{source: SourceCrawler, note: "Re-imported by crawler"})
+	if e, ok := err.(*liberror.ErrResponse); ok && e.HTTPStatusCode == http.StatusConflict {
+		log.WithFields(log.Fields{"service": "recipes.reimport", "recipe_id": id}).WithError(err).Warn("Skipping crawled recipe renamed to a taken name")
+		return false, nil
+	}
+	return changed, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("recipes.reimport", "recipe.reimport", "", log.Fields{"recipe_id": id}).WithError(err))
+}
+
+func (s Service) save(ctx context.Context, recipes model.Request, info revisionInfo) (map[string]bool, error) {
 	dupl := make(map[string]bool)
 	var uniqueRecipes []model.RequestData
 	for _, recipe := range recipes {
@@ -56,10 +126,10 @@ func (s Service) save(ctx context.Context, recipes model.Request) (map[string]bo
 			recipes[i].ID = uuid.New()
 		}
 	}
-	successMap, err := s.repo.processRecipesAndIngredients(ctx, recipes)
+	successMap, err := s.repo.processRecipesAndIngredients(ctx, recipes, info)
 	return successMap, liberror.CoverErr(err,
 		errors.New("service temporarily unavailable. Please try again later"),
-		pkg.Log("recipes.save", "recipe.processRecipesAndIngredients", "").WithError(err))
+		pkg.Log("recipes.save", "recipe.processRecipesAndIngredients", info.editorID).WithError(err))
 }
 
 func (s Service) delete(ctx context.Context, id string) (string, error) {
@@ -69,11 +139,144 @@ func (s Service) delete(ctx context.Context, id string) (string, error) {
 		pkg.Log("recipes.delete", "recipe.delete", id).WithError(err))
 }
 
-func (s Service) get(ctx context.Context, id string) (*Recipe, error) {
+// reviewPreviewSize is how many reviews ?include=reviews adds to a recipe.
+const reviewPreviewSize = 5
+
+// get returns the recipe aggregate as seen by userID, with the optional
+// parts named in include.
+func (s Service) get(ctx context.Context, id, userID string, include map[string]bool) (*Recipe, error) {
+	fail := func(repo string, err error) error {
+		return liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("recipes.get", repo, userID, log.Fields{"recipe_id": id}).WithError(err))
+	}
+
 	resp, err := s.repo.get(ctx, id)
-	return resp, liberror.CoverErr(err,
+	if err != nil {
+		return nil, fail("recipe.get", err)
+	}
+	if resp.Ingredients, err = s.repo.ingredients(ctx, resp.Id); err != nil {
+		return nil, fail("recipe.ingredients", err)
+	}
+	system, err := s.repo.unitSystem(ctx, userID)
+	if err != nil {
+		return nil, fail("recipe.unitSystem", err)
+	}
+	for i := range resp.Ingredients {
+		resp.Ingredients[i].localize(system)
+	}
+	if resp.Details, err = s.repo.details(ctx, resp.Id); err != nil {
+		return nil, fail("recipe.details", err)
+	}
+	if resp.AllergenWarnings, err = s.repo.allergenWarnings(ctx, resp.Id, userID); err != nil {
+		return nil, fail("recipe.allergenWarnings", err)
+	}
+	if resp.Viewer, err = s.repo.viewerState(ctx, resp.Id, userID); err != nil {
+		return nil, fail("recipe.viewerState", err)
+	}
+
+	if include[IncludeAllergens] {
+		if resp.Allergens, err = s.repo.allergens(ctx, resp.Id); err != nil {
+			return nil, fail("recipe.allergens", err)
+		}
+	}
+	if include[IncludeReviews] {
+		if resp.Reviews, err = s.repo.reviews(ctx, resp.Id, reviewPreviewSize); err != nil {
+			return nil, fail("recipe.reviews", err)
+		}
+	}
+	if include[IncludeCollections] {
+		if resp.Collections, err = s.repo.viewerCollections(ctx, resp.Id, userID); err != nil {
+			return nil, fail("recipe.viewerCollections", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// update applies the changes and returns the recipe as it now stands.
+func (s Service) update(ctx context.Context, id, userID, ifMatch string, changes PatchRequest) (*Recipe, error) {
+	_, err := s.repo.update(ctx, id, ifMatch, changes, revisionInfo{editorID: userID, source: SourceEdit, note: changes.note()})
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("recipes.update", "recipe.update", userID, log.Fields{"recipe_id": id}).WithError(err))
+	}
+	return s.get(ctx, id, userID, nil)
+}
+
+func (s Service) revisions(ctx context.Context, id string, queryParams url.Values) ([]Revision, *pkg.Pagination, error) {
+	page, pageSize, err := pkg.ParsePaginationParams(queryParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revisions, pagination, err := s.repo.revisions(ctx, id, page, pageSize)
+	return revisions, pagination, liberror.CoverErr(err,
 		errors.New("service temporarily unavailable. Please try again later"),
-		pkg.Log("recipes.get", "recipe.get", id).WithError(err))
+		pkg.Log("recipes.revisions", "recipe.revisions", "", log.Fields{"recipe_id": id}).WithError(err))
+}
+
+func (s Service) revision(ctx context.Context, id string, number int) (*Revision, error) {
+	revision, err := s.repo.revision(ctx, id, number)
+	return revision, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("recipes.revision", "recipe.revision", "", log.Fields{"recipe_id": id, "revision": number}).WithError(err))
+}
+
+// diff compares two revisions. to defaults to the latest revision and from
+// to the one before it.
+func (s Service) diff(ctx context.Context, id string, from, to int) (*RevisionDiff, error) {
+	newer, err := s.revision(ctx, id, to)
+	if err != nil {
+		return nil, err
+	}
+	if from == 0 {
+		from = newer.Revision - 1
+	}
+	if from < 1 {
+		return nil, liberror.New("There is no earlier revision to compare with", http.StatusBadRequest)
+	}
+
+	older, err := s.revision(ctx, id, from)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevisionDiff{
+		From:    older.Revision,
+		To:      newer.Revision,
+		Changes: diffSnapshots(*older.Snapshot, *newer.Snapshot),
+	}, nil
+}
+
+// revert makes an earlier revision current again, as a new revision.
+func (s Service) revert(ctx context.Context, id string, number int, userID, ifMatch string, request RevertRequest) (*Recipe, error) {
+	revision, err := s.revision(ctx, id, number)
+	if err != nil {
+		return nil, err
+	}
+
+	note := request.Note
+	if note == "" {
+		note = fmt.Sprintf("Reverted to revision %d", revision.Revision)
+	}
+
+	restore := UpdateRequest{Snapshot: *revision.Snapshot}
+	_, err = s.repo.update(ctx, id, ifMatch, restore.patch(), revisionInfo{editorID: userID, source: SourceRevert, note: note})
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("recipes.revert", "recipe.update", userID, log.Fields{"recipe_id": id, "revision": number}).WithError(err))
+	}
+	return s.get(ctx, id, userID, nil)
+}
+
+func (s Service) reparseQuantities(ctx context.Context, userID string) (int64, error) {
+	count, err := s.repo.reparseQuantities(ctx)
+	return count, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("recipes.reparseQuantities", "recipe.reparseQuantities", userID).WithError(err))
 }
 
 func (s Service) list(ctx context.Context, userID string, recipeName string) ([]ListResponse, error) {
@@ -85,7 +288,23 @@ func (s Service) list(ctx context.Context, userID string, recipeName string) ([]
 
 func (s Service) search(ctx context.Context, ingredients []string, queryParams url.Values, userID string) ([]ResponseData, *pkg.Pagination, error) {
 	recipes, pg, err := s.repo.search(ctx, ingredients, queryParams, userID)
-	return recipes, pg, liberror.CoverErr(err,
-		errors.New("service temporarily unavailable. Please try again later"),
-		pkg.Log("recipes.search", "recipe.search", "").WithError(err))
+	if err != nil {
+		return nil, nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("recipes.search", "recipe.search", "").WithError(err))
+	}
+
+	system, err := s.repo.unitSystem(ctx, userID)
+	if err != nil {
+		return nil, nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("recipes.search", "recipe.unitSystem", userID).WithError(err))
+	}
+	for i := range recipes {
+		for j, ingredient := range recipes[i].Ingredients {
+			recipes[i].Ingredients[j].Display = quantity.Localize(quantity.Parse(ingredient.Quantity), system).Format()
+		}
+	}
+
+	return recipes, pg, nil
 }
@@ -73,3 +73,47 @@ func (h Handler) get(w http.ResponseWriter, r *http.Request) {
 		Code:    http.StatusOK,
 	})
 }
+
+func (h Handler) update(w http.ResponseWriter, r *http.Request) {
+	var data UpdateRequest
+	if err := render.Bind(r, &data); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+
+	preference, err := h.svc.Update(r.Context(), userID, data)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    preference,
+		Message: "User preference updated successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) setAllergens(w http.ResponseWriter, r *http.Request) {
+	var data AllergensRequest
+	if err := render.Bind(r, &data); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	userID := r.Context().Value("user_id").(string)
+
+	preference, err := h.svc.SetAllergens(r.Context(), userID, data)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    preference,
+		Message: "Allergens updated successfully",
+		Code:    http.StatusOK,
+	})
+}
@@ -1,9 +1,12 @@
 package user_preference
 
-type UserPreference struct {
-	UserID       string   `json:"user_id" db:"user_id"`
-	LikedRecipes []Recipe `json:"liked_recipes" db:"liked_recipes"`
-}
+// Reactions a user can leave on a recipe they do not want. Both keep the
+// recipe out of their search results and meal plans; a dislike also counts
+// against similar recipes when plans are generated.
+const (
+	ReactionDislike = "dislike"
+	ReactionHide    = "hide"
+)
 
 type Recipe struct {
 	ID   string `db:"id"`
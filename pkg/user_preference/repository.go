@@ -9,6 +9,7 @@ import (
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"net/http"
+	"strings"
 )
 
 type Repository struct {
@@ -20,61 +21,53 @@ func NewRepository(db *sqlx.DB) *Repository {
 }
 
 func (r *Repository) get(ctx context.Context, userID string) ([]Recipe, error) {
-	var recipes []Recipe
-	query := `
+	recipes := []Recipe{}
+	err := r.db.SelectContext(ctx, &recipes, `
 		SELECT r.id, r.name
-		FROM recipes r
-		JOIN unnest(
-			(SELECT recipe_ids
-			 FROM user_preferences
-			 WHERE user_id = $1)
-		) as recipe_id ON r.id = recipe_id`
-	err := r.db.SelectContext(ctx, &recipes, query, userID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, liberror.New("No recipes found for the specified user", http.StatusNotFound)
-		}
+		FROM likes l
+		JOIN recipes r ON r.id = l.recipe_id
+		WHERE l.user_id = $1
+		ORDER BY l.created_at DESC`, userID)
+	if err != nil {
 		return nil, errors.Wrap(err, "SelectContext: failed to get recipes for user")
 	}
 
 	return recipes, nil
 }
 
-func (r *Repository) add(ctx context.Context, tx *sqlx.Tx, userID string, recipeIDs []uuid.UUID) error {
-	query := `
-        UPDATE user_preferences
-        SET recipe_ids = (
-            SELECT array_agg(DISTINCT id)
-            FROM unnest(array_cat(recipe_ids, $1::uuid[])) AS id
-        )
-        WHERE user_id = $2`
-	_, err := tx.ExecContext(ctx, query, pq.Array(recipeIDs), userID)
-	if err != nil {
-		return errors.Wrap(err, "ExecContext: failed to add recipes to user preferences")
+// getProfile returns the dietary profile. Users without a user_preferences
+// row get the defaults.
+func (r *Repository) getProfile(ctx context.Context, userID string) (*GetResponse, error) {
+	profile := GetResponse{
+		UserID:                userID,
+		DislikedIngredients:   pq.StringArray{},
+		AdditionalPreferences: []byte("{}"),
 	}
-	return nil
+	err := r.db.GetContext(ctx, &profile, `
+		SELECT user_id, vegetarian, gluten_free, cuisine_preference, disliked_ingredients,
+			additional_preferences, dietary_goals
+		FROM user_preferences
+		WHERE user_id = $1`, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.Wrap(err, "GetContext: failed to get dietary profile")
+	}
+
+	return &profile, nil
 }
 
-func (r *Repository) remove(ctx context.Context, tx *sqlx.Tx, userID string, recipeIDs []uuid.UUID) error {
-	query := `
-        UPDATE user_preferences
-        SET recipe_ids = (
-            SELECT array_agg(id)
-            FROM (
-                SELECT unnest(recipe_ids) AS id
-                EXCEPT
-                SELECT unnest($1::uuid[]) AS id_to_remove
-            ) AS filtered_ids
-        )
-        WHERE user_id = $2`
-	_, err := tx.ExecContext(ctx, query, pq.Array(recipeIDs), userID)
-	if err != nil {
-		return errors.Wrap(err, "ExecContext: failed to remove recipes from user preferences")
+func (r *Repository) allergens(ctx context.Context, userID string) (pq.StringArray, error) {
+	allergens := []string{}
+	err := r.db.SelectContext(ctx, &allergens, `
+		SELECT allergen FROM user_allergens WHERE user_id = $1 ORDER BY allergen`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get user allergens")
 	}
-	return nil
+	return pq.StringArray(allergens), nil
 }
 
-func (r *Repository) setLikeStatus(ctx context.Context, userID string, recipeIDs []string, like bool) error {
+// setAllergens replaces the user's allergen list. Unknown codes are rejected
+// rather than ignored so a typo never silently drops a protection.
+func (r *Repository) setAllergens(ctx context.Context, userID string, allergens []string) error {
 	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
@@ -91,36 +84,196 @@ func (r *Repository) setLikeStatus(ctx context.Context, userID string, recipeIDs
 		}
 	}()
 
-	recipeUUIDs := make([]uuid.UUID, len(recipeIDs))
-	for i, id := range recipeIDs {
-		recipeUUIDs[i] = uuid.MustParse(id)
+	var unknown []string
+	err = tx.SelectContext(ctx, &unknown, `
+		SELECT code FROM unnest($1::text[]) AS code
+		WHERE code NOT IN (SELECT code FROM allergens)`, pq.Array(allergens))
+	if err != nil {
+		return errors.Wrap(err, "SelectContext: failed to check allergen codes")
+	}
+	if len(unknown) > 0 {
+		err = liberror.New("Unknown allergens: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+		return err
 	}
 
-	if like {
-		_, err = tx.ExecContext(ctx, `
-			INSERT INTO likes (user_id, recipe_id)
-			SELECT $1, unnest($2::uuid[])
-			ON CONFLICT DO NOTHING`, userID, pq.Array(recipeUUIDs))
-		if err != nil {
-			return errors.Wrap(err, "ExecContext: failed to like recipes")
-		}
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_allergens WHERE user_id = $1`, userID)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to clear user allergens")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_allergens (user_id, allergen)
+		SELECT $1, unnest($2::text[])`, userID, pq.Array(allergens))
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to insert user allergens")
+	}
 
-		err = r.add(ctx, tx, userID, recipeUUIDs)
+	return nil
+}
+
+func (r *Repository) updateProfile(ctx context.Context, userID string, data UpdateRequest) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_preferences (user_id, vegetarian, gluten_free, cuisine_preference,
+			disliked_ingredients, additional_preferences, dietary_goals)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET
+			vegetarian = EXCLUDED.vegetarian,
+			gluten_free = EXCLUDED.gluten_free,
+			cuisine_preference = EXCLUDED.cuisine_preference,
+			disliked_ingredients = EXCLUDED.disliked_ingredients,
+			additional_preferences = EXCLUDED.additional_preferences,
+			dietary_goals = EXCLUDED.dietary_goals,
+			updated_at = CURRENT_TIMESTAMP`,
+		userID, data.Vegetarian, data.GlutenFree, data.CuisinePreference,
+		pq.Array(data.DislikedIngredients), []byte(data.AdditionalPreferences), data.DietaryGoals)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to update dietary profile")
+	}
+	return nil
+}
+
+// setLikeStatus likes or unlikes recipes. Every ID must be a valid recipe
+// ID, and liking also needs the recipe to exist.
+func (r *Repository) setLikeStatus(ctx context.Context, userID string, recipeIDs []string, like bool) error {
+	recipeUUIDs := make([]uuid.UUID, len(recipeIDs))
+	for i, id := range recipeIDs {
+		parsed, err := uuid.Parse(id)
 		if err != nil {
-			return err
+			return liberror.New("Invalid recipe ID: "+id, http.StatusBadRequest)
 		}
-	} else {
-		_, err = tx.ExecContext(ctx, `
+		recipeUUIDs[i] = parsed
+	}
+
+	if !like {
+		_, err := r.db.ExecContext(ctx, `
 			DELETE FROM likes WHERE user_id = $1 AND recipe_id = ANY($2::uuid[])`, userID, pq.Array(recipeUUIDs))
 		if err != nil {
 			return errors.Wrap(err, "ExecContext: failed to unlike recipes")
 		}
+		return nil
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
 
-		err = r.remove(ctx, tx, userID, recipeUUIDs)
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var unknown []string
+	err = tx.SelectContext(ctx, &unknown, `
+		SELECT id::text
+		FROM unnest($1::uuid[]) AS ids(id)
+		WHERE NOT EXISTS (SELECT 1 FROM recipes r WHERE r.id = ids.id)`, pq.Array(recipeUUIDs))
+	if err != nil {
+		return errors.Wrap(err, "SelectContext: failed to check recipe IDs")
+	}
+	if len(unknown) > 0 {
+		err = liberror.New("Unknown recipes: "+strings.Join(unknown, ", "), http.StatusBadRequest)
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO likes (user_id, recipe_id)
+		SELECT $1, unnest($2::uuid[])
+		ON CONFLICT DO NOTHING`, userID, pq.Array(recipeUUIDs))
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to like recipes")
+	}
+
+	// Liking a recipe takes back an earlier dislike or hide.
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM recipe_dislikes WHERE user_id = $1 AND recipe_id = ANY($2::uuid[])`, userID, pq.Array(recipeUUIDs))
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to clear recipe dislikes")
+	}
+
+	return err
+}
+
+// feedback returns the recipes the user left the given reaction on.
+func (r *Repository) feedback(ctx context.Context, userID, reaction string) ([]Recipe, error) {
+	recipes := []Recipe{}
+	err := r.db.SelectContext(ctx, &recipes, `
+		SELECT r.id, r.name
+		FROM recipe_dislikes d
+		JOIN recipes r ON r.id = d.recipe_id
+		WHERE d.user_id = $1 AND d.kind = $2
+		ORDER BY d.created_at DESC`, userID, reaction)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to get recipe feedback")
+	}
+	return recipes, nil
+}
+
+// setFeedback records a dislike or hide, replacing any earlier reaction to
+// the recipe. A dislike also withdraws the user's like.
+func (r *Repository) setFeedback(ctx context.Context, userID, recipeID, reaction string) error {
+	recipeUUID, err := uuid.Parse(recipeID)
+	if err != nil {
+		return liberror.New("Invalid recipe ID", http.StatusBadRequest)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO recipe_dislikes (user_id, recipe_id, kind)
+		SELECT $1, id, $3 FROM recipes WHERE id = $2
+		ON CONFLICT (user_id, recipe_id) DO UPDATE
+		SET kind = EXCLUDED.kind, created_at = CURRENT_TIMESTAMP`, userID, recipeUUID, reaction)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to save recipe feedback")
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+	if count == 0 {
+		err = liberror.New("Recipe not found", http.StatusNotFound)
+		return err
+	}
+
+	if reaction == ReactionDislike {
+		_, err = tx.ExecContext(ctx, `DELETE FROM likes WHERE user_id = $1 AND recipe_id = $2`, userID, recipeUUID)
 		if err != nil {
-			return err
+			return errors.Wrap(err, "ExecContext: failed to unlike recipe")
 		}
 	}
 
 	return err
 }
+
+func (r *Repository) clearFeedback(ctx context.Context, userID, recipeID string) error {
+	if _, err := uuid.Parse(recipeID); err != nil {
+		return liberror.New("Invalid recipe ID", http.StatusBadRequest)
+	}
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM recipe_dislikes WHERE user_id = $1 AND recipe_id = $2`, userID, recipeID)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to clear recipe feedback")
+	}
+	return nil
+}
@@ -1,11 +1,27 @@
 package user_preference
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"github.com/gobuffalo/validate"
+	"github.com/gobuffalo/validate/validators"
 	"github.com/lib/pq"
 	"net/http"
+	"regexp"
+	"strings"
 )
 
+const (
+	maxAllergens                 = 20
+	maxDislikedIngredients       = 50
+	maxAdditionalPreferencesSize = 4096
+)
+
+// ingredientNamePattern keeps disliked ingredients to plain names; they are
+// matched with ILIKE so wildcards would widen the match.
+var ingredientNamePattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} '\-]{0,99}$`)
+
 type AddRequest struct {
 	RecipeIds []string `json:"recipe_ids"`
 }
@@ -15,11 +31,144 @@ func (v *AddRequest) Bind(r *http.Request) error {
 }
 
 type GetResponse struct {
-	UserID                string          `json:"user_id"`
+	UserID                string          `json:"user_id" db:"user_id"`
+	Vegetarian            bool            `json:"vegetarian" db:"vegetarian"`
+	GlutenFree            bool            `json:"gluten_free" db:"gluten_free"`
+	CuisinePreference     string          `json:"cuisine_preference" db:"cuisine_preference"`
+	DislikedIngredients   pq.StringArray  `json:"disliked_ingredients" db:"disliked_ingredients"`
+	AdditionalPreferences json.RawMessage `json:"additional_preferences" db:"additional_preferences"`
+	DietaryGoals          string          `json:"dietary_goals" db:"dietary_goals"`
+	Allergens             pq.StringArray  `json:"allergens" db:"-"`
+	LikedRecipes          []Recipe        `json:"liked_recipes" db:"-"`
+	DislikedRecipes       []Recipe        `json:"disliked_recipes" db:"-"`
+	HiddenRecipes         []Recipe        `json:"hidden_recipes" db:"-"`
+}
+
+// UpdateRequest replaces the whole dietary profile; omitted fields are reset.
+type UpdateRequest struct {
 	Vegetarian            bool            `json:"vegetarian"`
 	GlutenFree            bool            `json:"gluten_free"`
 	CuisinePreference     string          `json:"cuisine_preference"`
-	DislikedIngredients   pq.StringArray  `json:"disliked_ingredients"`
+	DislikedIngredients   []string        `json:"disliked_ingredients"`
 	AdditionalPreferences json.RawMessage `json:"additional_preferences"`
 	DietaryGoals          string          `json:"dietary_goals"`
 }
+
+func (v *UpdateRequest) Bind(r *http.Request) error {
+	v.CuisinePreference = strings.TrimSpace(v.CuisinePreference)
+	v.DietaryGoals = strings.TrimSpace(v.DietaryGoals)
+
+	seen := make(map[string]bool, len(v.DislikedIngredients))
+	disliked := make([]string, 0, len(v.DislikedIngredients))
+	for _, name := range v.DislikedIngredients {
+		name = strings.Join(strings.Fields(strings.ToLower(name)), " ")
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		disliked = append(disliked, name)
+	}
+	v.DislikedIngredients = disliked
+
+	additional := bytes.TrimSpace(v.AdditionalPreferences)
+	if len(additional) == 0 || bytes.Equal(additional, []byte("null")) {
+		additional = []byte("{}")
+	}
+	v.AdditionalPreferences = additional
+
+	err1 := validate.Validate(
+		&validators.StringLengthInRange{Name: "cuisine_preference", Field: v.CuisinePreference, Max: 50, Message: fmt.Sprintf("%v must be at most 50 characters", "cuisine_preference")},
+		&validators.StringLengthInRange{Name: "dietary_goals", Field: v.DietaryGoals, Max: 255, Message: fmt.Sprintf("%v must be at most 255 characters", "dietary_goals")},
+		&validators.FuncValidator{
+			Name:    "disliked_ingredients",
+			Field:   "disliked_ingredients",
+			Message: fmt.Sprintf("%%s must list at most %d ingredient names of letters, digits, spaces, apostrophes and hyphens", maxDislikedIngredients),
+			Fn: func() bool {
+				if len(v.DislikedIngredients) > maxDislikedIngredients {
+					return false
+				}
+				for _, name := range v.DislikedIngredients {
+					if !ingredientNamePattern.MatchString(name) {
+						return false
+					}
+				}
+				return true
+			},
+		},
+		&validators.FuncValidator{
+			Name:    "additional_preferences",
+			Field:   "additional_preferences",
+			Message: fmt.Sprintf("%%s must be a JSON object of at most %d bytes", maxAdditionalPreferencesSize),
+			Fn: func() bool {
+				var object map[string]interface{}
+				return len(v.AdditionalPreferences) <= maxAdditionalPreferencesSize &&
+					json.Unmarshal(v.AdditionalPreferences, &object) == nil && object != nil
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type FeedbackRequest struct {
+	Reaction string `json:"reaction"`
+}
+
+func (v *FeedbackRequest) Bind(r *http.Request) error {
+	v.Reaction = strings.TrimSpace(strings.ToLower(v.Reaction))
+
+	err1 := validate.Validate(
+		&validators.FuncValidator{
+			Name:    "reaction",
+			Field:   "reaction",
+			Message: "%s must be one of dislike or hide",
+			Fn: func() bool {
+				return v.Reaction == ReactionDislike || v.Reaction == ReactionHide
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+// AllergensRequest replaces the user's allergen list with codes from the
+// allergens table, e.g. "peanut" or "shellfish".
+type AllergensRequest struct {
+	Allergens []string `json:"allergens"`
+}
+
+func (v *AllergensRequest) Bind(r *http.Request) error {
+	seen := make(map[string]bool, len(v.Allergens))
+	allergens := make([]string, 0, len(v.Allergens))
+	for _, code := range v.Allergens {
+		code = strings.TrimSpace(strings.ToLower(code))
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		allergens = append(allergens, code)
+	}
+	v.Allergens = allergens
+
+	err1 := validate.Validate(
+		&validators.FuncValidator{
+			Name:    "allergens",
+			Field:   "allergens",
+			Message: fmt.Sprintf("%%s must list at most %d allergens", maxAllergens),
+			Fn: func() bool {
+				return len(v.Allergens) <= maxAllergens
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
@@ -7,13 +7,15 @@ import (
 )
 
 type Resource struct {
-	db *sqlx.DB
+	db    *sqlx.DB
+	authn *auth.Authenticator
 }
 
 // NewResource creates and returns a resource.
-func NewResource(db *sqlx.DB) *Resource {
+func NewResource(db *sqlx.DB, authn *auth.Authenticator) *Resource {
 	return &Resource{
-		db: db,
+		db:    db,
+		authn: authn,
 	}
 }
 
@@ -24,9 +26,11 @@ func (rs *Resource) Router() *chi.Mux {
 	svc := NewService(repo)
 	hndlr := NewHandler(svc)
 
-	r.Use(auth.MustAuthMiddleware)
-	r.Post("/", hndlr.add)
-	r.Delete("/", hndlr.delete)
+	r.Use(rs.authn.MustAuthMiddleware)
+	r.With(auth.RequireWriteScope).Post("/", hndlr.add)
+	r.With(auth.RequireWriteScope).Delete("/", hndlr.delete)
+	r.With(auth.RequireRoleOrOwner("id"), auth.RequireWriteScope).Put("/", hndlr.update)
+	r.With(auth.RequireRoleOrOwner("id"), auth.RequireWriteScope).Put("/allergens", hndlr.setAllergens)
 	r.Get("/", hndlr.get)
 	return r
 }
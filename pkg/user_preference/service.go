@@ -22,16 +22,72 @@ func (s *Service) Save(ctx context.Context, userID string, req AddRequest, liked
 		pkg.Log("user_preference.Save", "user_preference.setLikeStatus", userID).WithError(err))
 }
 
-func (s *Service) Get(ctx context.Context, userID string) (*UserPreference, error) {
+// Get returns the dietary profile together with the liked recipes.
+func (s *Service) Get(ctx context.Context, userID string) (*GetResponse, error) {
+	profile, err := s.repo.getProfile(ctx, userID)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("user_preference.Get", "user_preference.getProfile", userID).WithError(err))
+	}
+
+	if profile.Allergens, err = s.repo.allergens(ctx, userID); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("user_preference.Get", "user_preference.allergens", userID).WithError(err))
+	}
+
 	recipes, err := s.repo.get(ctx, userID)
 	if err != nil {
 		return nil, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
 			pkg.Log("user_preference.Get", "user_preference.get", userID).WithError(err))
 	}
+	profile.LikedRecipes = recipes
+
+	if profile.DislikedRecipes, err = s.repo.feedback(ctx, userID, ReactionDislike); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("user_preference.Get", "user_preference.feedback", userID).WithError(err))
+	}
+	if profile.HiddenRecipes, err = s.repo.feedback(ctx, userID, ReactionHide); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("user_preference.Get", "user_preference.feedback", userID).WithError(err))
+	}
+
+	return profile, nil
+}
+
+func (s *Service) Update(ctx context.Context, userID string, req UpdateRequest) (*GetResponse, error) {
+	if err := s.repo.updateProfile(ctx, userID, req); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("user_preference.Update", "user_preference.updateProfile", userID).WithError(err))
+	}
+	return s.Get(ctx, userID)
+}
 
-	return &UserPreference{
-		UserID:       userID,
-		LikedRecipes: recipes,
-	}, nil
+func (s *Service) SetAllergens(ctx context.Context, userID string, req AllergensRequest) (*GetResponse, error) {
+	if err := s.repo.setAllergens(ctx, userID, req.Allergens); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("user_preference.SetAllergens", "user_preference.setAllergens", userID).WithError(err))
+	}
+	return s.Get(ctx, userID)
+}
+
+// SetFeedback records that the user dislikes or wants to hide a recipe.
+func (s *Service) SetFeedback(ctx context.Context, userID, recipeID string, req FeedbackRequest) error {
+	err := s.repo.setFeedback(ctx, userID, recipeID, req.Reaction)
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("user_preference.SetFeedback", "user_preference.setFeedback", userID).WithError(err))
+}
+
+func (s *Service) ClearFeedback(ctx context.Context, userID, recipeID string) error {
+	err := s.repo.clearFeedback(ctx, userID, recipeID)
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("user_preference.ClearFeedback", "user_preference.clearFeedback", userID).WithError(err))
 }
@@ -1,8 +1,58 @@
 package users
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"Food/auth"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"golang.org/x/crypto/bcrypt"
+	"sync"
+)
 
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 	return string(bytes), err
 }
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash is compared against when the email is unknown so a
+// failed login costs the same time whether or not the account exists.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, _ := bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+		dummyHash = string(hash)
+	})
+	return dummyHash
+}
+
+// newOpaqueToken returns a random URL-safe token and the SHA-256 hash that
+// is persisted in its place.
+func newOpaqueToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// newAPIKey returns a random key with the recognisable auth.APIKeyPrefix,
+// its display prefix and the hash that is persisted in its place.
+func newAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = auth.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:len(auth.APIKeyPrefix)+8], auth.HashAPIKey(key), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -2,8 +2,12 @@ package users
 
 import (
 	"Food/pkg"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"io"
+	"net"
 	"net/http"
 )
 
@@ -44,7 +48,39 @@ func (h Handler) login(w http.ResponseWriter, r *http.Request) {
 		pkg.Render(w, r, err)
 		return
 	}
-	user, token, err := h.svc.login(r.Context(), loginReq)
+	user, tokens, challenge, err := h.svc.login(r.Context(), loginReq, clientFromRequest(r))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if challenge != nil {
+		pkg.Render(w, r, pkg.ApiResponse{
+			Data:    challenge,
+			Message: "Two-factor authentication code required",
+			Code:    http.StatusOK,
+		})
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data: struct {
+			User UserResponse `json:"user"`
+			*TokenResponse
+		}{User: user.Response(), TokenResponse: tokens},
+		Message: "User logged in successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) loginMFA(w http.ResponseWriter, r *http.Request) {
+	var mfaReq MFALoginRequest
+	if err := render.Bind(r, &mfaReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	user, tokens, err := h.svc.loginMFA(r.Context(), mfaReq, clientFromRequest(r))
 	if err != nil {
 		pkg.Render(w, r, err)
 		return
@@ -52,14 +88,55 @@ func (h Handler) login(w http.ResponseWriter, r *http.Request) {
 
 	pkg.Render(w, r, pkg.ApiResponse{
 		Data: struct {
-			User  UserResponse `json:"user"`
-			Token string       `json:"token"`
-		}{User: user.Response(), Token: token},
+			User UserResponse `json:"user"`
+			*TokenResponse
+		}{User: user.Response(), TokenResponse: tokens},
 		Message: "User logged in successfully",
 		Code:    http.StatusOK,
 	})
 }
 
+func (h Handler) refresh(w http.ResponseWriter, r *http.Request) {
+	var refreshReq RefreshRequest
+	if err := render.Bind(r, &refreshReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	tokens, err := h.svc.refresh(r.Context(), refreshReq)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    tokens,
+		Message: "Token refreshed successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) logout(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	// The body is optional: an empty one only revokes the access token.
+	var logoutReq LogoutRequest
+	if err := render.Bind(r, &logoutReq); err != nil && !errors.Is(err, io.EOF) {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.logout(r.Context(), userID, logoutReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Message: "User logged out successfully",
+		Code:    http.StatusOK,
+	})
+}
+
 func (h Handler) delete(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	delId, err := h.svc.delete(r.Context(), id)
@@ -70,11 +147,26 @@ func (h Handler) delete(w http.ResponseWriter, r *http.Request) {
 
 	pkg.Render(w, r, pkg.ApiResponse{
 		Data:    delId,
-		Message: "User successfully deleted",
+		Message: "User and personal data successfully erased",
 		Code:    http.StatusOK,
 	})
 }
 
+// export is served as a download rather than wrapped in ApiResponse so the
+// file is the archive itself.
+func (h Handler) export(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	export, err := h.svc.export(r.Context(), id)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%s-export.json"`, id))
+	w.Header().Set("Cache-Control", "no-store")
+	render.JSON(w, r, export)
+}
+
 func (h Handler) get(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	user, err := h.svc.get(r.Context(), id)
@@ -124,3 +216,299 @@ func (h Handler) update(w http.ResponseWriter, r *http.Request) {
 		Code:    http.StatusOK,
 	})
 }
+
+func (h Handler) updateRole(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var roleRequest RoleRequest
+	if err := render.Bind(r, &roleRequest); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	uId, err := h.svc.updateRole(r.Context(), id, roleRequest)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    uId,
+		Message: "User role updated successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var forgotReq ForgotPasswordRequest
+	if err := render.Bind(r, &forgotReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.requestPasswordReset(r.Context(), forgotReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Message: "If the email address is registered, a password reset link has been sent",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var resetReq ResetPasswordRequest
+	if err := render.Bind(r, &resetReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.resetPassword(r.Context(), resetReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Message: "Password reset successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var changeReq ChangePasswordRequest
+	if err := render.Bind(r, &changeReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.changePassword(r.Context(), id, changeReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Message: "Password changed successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var verifyReq VerifyEmailRequest
+	if err := render.Bind(r, &verifyReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	uId, err := h.svc.verifyEmail(r.Context(), verifyReq)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    uId,
+		Message: "Email address verified successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if err := h.svc.resendVerification(r.Context(), id); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Message: "Verification email sent",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) unlock(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	uId, err := h.svc.unlock(r.Context(), id)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    uId,
+		Message: "User account unlocked successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	enrollment, err := h.svc.enrollTOTP(r.Context(), id)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    enrollment,
+		Message: "Scan the code with your authenticator app, then confirm with a code",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var codeReq TOTPCodeRequest
+	if err := render.Bind(r, &codeReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	codes, err := h.svc.confirmTOTP(r.Context(), id, codeReq)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    codes,
+		Message: "Two-factor authentication enabled. Store the recovery codes somewhere safe",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var codeReq TOTPCodeRequest
+	if err := render.Bind(r, &codeReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	codes, err := h.svc.regenerateRecoveryCodes(r.Context(), id, codeReq)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    codes,
+		Message: "Recovery codes regenerated",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var disableReq DisableTOTPRequest
+	if err := render.Bind(r, &disableReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	if err := h.svc.disableTOTP(r.Context(), id, disableReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Message: "Two-factor authentication disabled",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var keyReq CreateAPIKeyRequest
+	if err := render.Bind(r, &keyReq); err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	key, err := h.svc.createAPIKey(r.Context(), id, keyReq)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    key,
+		Message: "API key created. Copy it now, it will not be shown again",
+		Code:    http.StatusCreated,
+	})
+}
+
+func (h Handler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	keys, err := h.svc.listAPIKeys(r.Context(), id)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    keys,
+		Message: "API keys retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	keyID, err := h.svc.revokeAPIKey(r.Context(), id, chi.URLParam(r, "keyId"))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    keyID,
+		Message: "API key revoked successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) listSessions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	sessions, err := h.svc.listSessions(r.Context(), id)
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    sessions,
+		Message: "Sessions retrieved successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+func (h Handler) revokeSession(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	sid, err := h.svc.revokeSession(r.Context(), id, chi.URLParam(r, "sid"))
+	if err != nil {
+		pkg.Render(w, r, err)
+		return
+	}
+
+	pkg.Render(w, r, pkg.ApiResponse{
+		Data:    sid,
+		Message: "Session signed out successfully",
+		Code:    http.StatusOK,
+	})
+}
+
+// clientFromRequest takes the IP from RemoteAddr, which pkg.RealIP has
+// already replaced with the forwarded address when behind a trusted proxy.
+func clientFromRequest(r *http.Request) Client {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	return Client{IP: host, UserAgent: userAgent}
+}
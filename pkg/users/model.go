@@ -1,37 +1,81 @@
 package users
 
-import "time"
+import (
+	"encoding/json"
+	"github.com/lib/pq"
+	"time"
+)
 
 type User struct {
-	ID           string    `json:"id" db:"id"`
-	Username     string    `json:"username" db:"username"`
-	Email        string    `json:"email" db:"email"`
-	Password     string    `json:"password" db:"password"`
-	PasswordHash string    `db:"password_hash"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID              string     `json:"id" db:"id"`
+	Username        string     `json:"username" db:"username"`
+	Email           string     `json:"email" db:"email"`
+	Password        string     `json:"password" db:"password"`
+	PasswordHash    string     `db:"password_hash"`
+	Role            string     `json:"role" db:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	TOTPSecret      *string    `json:"-" db:"totp_secret"`
+	TOTPEnabledAt   *time.Time `json:"-" db:"totp_enabled_at"`
+	TOTPLastStep    int64      `json:"-" db:"totp_last_step"`
+	DisplayName     *string    `json:"display_name" db:"display_name"`
+	AvatarURL       *string    `json:"avatar_url" db:"avatar_url"`
+	HouseholdSize   int        `json:"household_size" db:"household_size"`
+	Timezone        string     `json:"timezone" db:"timezone"`
+	Locale          string     `json:"locale" db:"locale"`
+	Units           string     `json:"units" db:"units"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+func (u User) MFAEnabled() bool {
+	return u.TOTPEnabledAt != nil && u.TOTPSecret != nil
 }
 
 type Users []User
 
 type UserResponse struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	Role          string    `json:"role"`
+	EmailVerified bool      `json:"email_verified"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	DisplayName   string    `json:"display_name"`
+	AvatarURL     string    `json:"avatar_url"`
+	HouseholdSize int       `json:"household_size"`
+	Timezone      string    `json:"timezone"`
+	Locale        string    `json:"locale"`
+	Units         string    `json:"units"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 func (u User) Response() UserResponse {
 	return UserResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		Email:     u.Email,
-		CreatedAt: u.CreatedAt,
-		UpdatedAt: u.UpdatedAt,
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		Role:          u.Role,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		MFAEnabled:    u.MFAEnabled(),
+		DisplayName:   stringValue(u.DisplayName),
+		AvatarURL:     stringValue(u.AvatarURL),
+		HouseholdSize: u.HouseholdSize,
+		Timezone:      u.Timezone,
+		Locale:        u.Locale,
+		Units:         u.Units,
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
 	}
 }
 
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
 func (u Users) Response() []UserResponse {
 	var response = make([]UserResponse, len(u))
 	for _, user := range u {
@@ -39,3 +83,202 @@ func (u Users) Response() []UserResponse {
 	}
 	return response
 }
+
+type RefreshToken struct {
+	ID         string     `db:"id"`
+	UserID     string     `db:"user_id"`
+	SessionID  *string    `db:"session_id"`
+	TokenHash  string     `db:"token_hash"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	ReplacedBy *string    `db:"replaced_by"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// Client describes the device a request comes from.
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type Session struct {
+	ID         string     `db:"id"`
+	UserID     string     `db:"user_id"`
+	UserAgent  string     `db:"user_agent"`
+	IP         string     `db:"ip"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastSeenAt time.Time  `db:"last_seen_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// Current marks the session the request was made from.
+	Current bool `json:"current"`
+}
+
+func (s Session) Response(currentID string) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IP:         s.IP,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		Current:    s.ID == currentID,
+	}
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type APIKey struct {
+	ID         string     `json:"id" db:"id"`
+	UserID     string     `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	KeyHash    string     `json:"-" db:"key_hash"`
+	Scope      string     `json:"scope" db:"scope"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreatedAPIKey carries the raw key. It is only returned once, when the key
+// is created.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// Export is the personal data archive returned by GET /users/{id}/export.
+type Export struct {
+	ExportedAt time.Time        `json:"exported_at"`
+	Profile    UserResponse     `json:"profile"`
+	Likes      []ExportedRecipe `json:"likes"`
+	// Preferences repeats Likes. Liked recipes used to be kept in
+	// user_preferences and exported under this key; it stays for one more
+	// release so existing consumers can move to likes.
+	Preferences []ExportedRecipe     `json:"preferences"`
+	Ratings     []ExportedRating     `json:"ratings"`
+	Feedback    []ExportedFeedback   `json:"recipe_feedback"`
+	Collections []ExportedCollection `json:"collections"`
+	Events      []ExportedEvent      `json:"recipe_events"`
+	Onboarding  []ExportedAnswer     `json:"onboarding_answers"`
+	Revisions   []ExportedRevision   `json:"recipe_revisions"`
+	Diet        *ExportedDiet        `json:"dietary_profile"`
+	Allergens   []string             `json:"allergens"`
+	MealPlans   []ExportedMeal       `json:"meal_plans"`
+	Household   *ExportedHousehold   `json:"household"`
+	Sessions    []SessionResponse    `json:"sessions"`
+	APIKeys     []APIKey             `json:"api_keys"`
+}
+
+type ExportedRecipe struct {
+	RecipeID string `json:"recipe_id" db:"recipe_id"`
+	Name     string `json:"name" db:"name"`
+}
+
+type ExportedRating struct {
+	RecipeID   string         `json:"recipe_id" db:"recipe_id"`
+	RecipeName string         `json:"recipe_name" db:"recipe_name"`
+	Rating     int            `json:"rating" db:"rating"`
+	Review     *string        `json:"review" db:"review"`
+	PhotoURLs  pq.StringArray `json:"photo_urls" db:"photo_urls"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+type ExportedFeedback struct {
+	RecipeID  string    `json:"recipe_id" db:"recipe_id"`
+	Name      string    `json:"name" db:"name"`
+	Reaction  string    `json:"reaction" db:"reaction"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type ExportedCollection struct {
+	ID            string         `json:"id" db:"id"`
+	Name          string         `json:"name" db:"name"`
+	Description   string         `json:"description" db:"description"`
+	CoverImageURL string         `json:"cover_image_url" db:"cover_image_url"`
+	Visibility    string         `json:"visibility" db:"visibility"`
+	RecipeIDs     pq.StringArray `json:"recipe_ids" db:"recipe_ids"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" db:"updated_at"`
+}
+
+type ExportedEvent struct {
+	RecipeID   string    `json:"recipe_id" db:"recipe_id"`
+	Type       string    `json:"type" db:"type"`
+	OccurredAt time.Time `json:"occurred_at" db:"occurred_at"`
+}
+
+type ExportedAnswer struct {
+	RecipeID   string    `json:"recipe_id" db:"recipe_id"`
+	Rating     int       `json:"rating" db:"rating"`
+	AnsweredAt time.Time `json:"answered_at" db:"answered_at"`
+}
+
+type ExportedRevision struct {
+	RecipeID  string    `json:"recipe_id" db:"recipe_id"`
+	Revision  int       `json:"revision" db:"revision"`
+	Source    string    `json:"source" db:"source"`
+	Note      string    `json:"note" db:"note"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type ExportedMeal struct {
+	WeekStartDate time.Time `json:"week_start_date" db:"week_start_date"`
+	DayOfWeek     string    `json:"day_of_week" db:"day_of_week"`
+	MealType      string    `json:"meal_type" db:"meal_type"`
+	RecipeID      string    `json:"recipe_id" db:"recipe_id"`
+	RecipeName    string    `json:"recipe_name" db:"recipe_name"`
+	Servings      int       `json:"servings" db:"servings"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+type ExportedDiet struct {
+	Vegetarian            bool            `json:"vegetarian" db:"vegetarian"`
+	GlutenFree            bool            `json:"gluten_free" db:"gluten_free"`
+	CuisinePreference     string          `json:"cuisine_preference" db:"cuisine_preference"`
+	DislikedIngredients   pq.StringArray  `json:"disliked_ingredients" db:"disliked_ingredients"`
+	AdditionalPreferences json.RawMessage `json:"additional_preferences" db:"additional_preferences"`
+	DietaryGoals          string          `json:"dietary_goals" db:"dietary_goals"`
+}
+
+type ExportedHousehold struct {
+	ID       string    `json:"id" db:"id"`
+	Name     string    `json:"name" db:"name"`
+	Role     string    `json:"role" db:"role"`
+	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
+}
+
+// MFAChallenge is returned by login instead of tokens when the account has
+// 2FA enabled. The challenge token is exchanged at /users/login/mfa.
+type MFAChallenge struct {
+	Status         string `json:"status"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int64  `json:"expires_in"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+const (
+	purposePasswordReset     = "password_reset"
+	purposeEmailVerification = "email_verification"
+	purposeMFAChallenge      = "mfa_challenge"
+)
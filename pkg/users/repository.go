@@ -2,11 +2,15 @@ package users
 
 import (
 	liberror "Food/internal/errors"
+	"Food/pkg/household"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type Repository struct {
@@ -67,20 +71,93 @@ func (r *Repository) save(ctx context.Context, data AddRequest) (*User, error) {
 	}
 
 	_, err = tx.ExecContext(ctx, `
-		INSERT INTO user_preferences (user_id, recipe_ids)
-		VALUES ($1, '{}')`, user.ID)
+		INSERT INTO user_preferences (user_id)
+		VALUES ($1)`, user.ID)
 	if err != nil {
 		return nil, errors.Wrap(err, "ExecContext: failed to insert user preferences")
 	}
 
+	if _, err = household.CreateSolo(ctx, tx, user.ID, data.Username+"'s household"); err != nil {
+		return nil, err
+	}
+
 	return &user, nil
 }
 
-func (r Repository) delete(ctx context.Context, id string) (string, error) {
-	_, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+// erase deletes the user and every row that references them in a single
+// transaction and records the erasure in user_erasures. Tables added with
+// ON DELETE CASCADE go with the users row; the older ones are listed here.
+func (r *Repository) erase(ctx context.Context, id, erasedBy string) (string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var email string
+	err = tx.GetContext(ctx, &email, `SELECT email FROM users WHERE id = $1 FOR UPDATE`, id)
 	if err != nil {
-		return id, errors.Wrap(err, "ExecContext: failed to delete user")
+		if errors.Is(err, sql.ErrNoRows) {
+			err = liberror.New("No user found with the specified ID", http.StatusNotFound)
+			return "", err
+		}
+		return "", errors.Wrap(err, "GetContext: failed to lock user")
+	}
+
+	removed := map[string]int64{}
+	for _, table := range []string{"likes", "user_preferences"} {
+		var res sql.Result
+		res, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, id)
+		if err != nil {
+			return "", errors.Wrapf(err, "ExecContext: failed to delete %s", table)
+		}
+		if removed[table], err = res.RowsAffected(); err != nil {
+			return "", errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+		}
+	}
+
+	// Meal plans belong to the household, so the rest of the household keeps
+	// the ones this user generated. A household of one goes with its plans
+	// when the user leaves it.
+	res, err := tx.ExecContext(ctx, `UPDATE meal_plans SET user_id = NULL WHERE user_id = $1`, id)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to anonymise meal plans")
+	}
+	if removed["meal_plans_anonymised"], err = res.RowsAffected(); err != nil {
+		return "", errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+
+	if err = household.Leave(ctx, tx, id); err != nil {
+		return "", err
 	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to delete user")
+	}
+
+	removedJSON, err := json.Marshal(removed)
+	if err != nil {
+		return "", errors.Wrap(err, "json.Marshal: failed to encode erasure summary")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_erasures (user_id, email_hash, erased_by, removed)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4)`, id, hashToken(strings.ToLower(email)), erasedBy, removedJSON)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to record erasure")
+	}
+
 	return id, nil
 }
 
@@ -108,16 +185,31 @@ func (r Repository) findByEmail(ctx context.Context, email string) (*User, error
 }
 
 func (r Repository) update(ctx context.Context, id string, data UpdateRequest) (string, error) {
-	var u User
-	err := r.db.GetContext(ctx, &u, "SELECT * FROM users WHERE email = $1 AND id != $2", data.Email, id)
-	if u != (User{}) {
-		return "", liberror.New("Email already exists", http.StatusConflict)
-	}
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return "", errors.Wrap(err, "GetContext: failed to get user by email and ID")
+	if data.Email != nil {
+		var u User
+		err := r.db.GetContext(ctx, &u, "SELECT * FROM users WHERE email = $1 AND id != $2", *data.Email, id)
+		if err == nil {
+			return "", liberror.New("Email already exists", http.StatusConflict)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", errors.Wrap(err, "GetContext: failed to get user by email and ID")
+		}
 	}
 
-	res, err := r.db.ExecContext(ctx, `UPDATE users SET username = $1, email = $2 WHERE id = $3`, data.Name, data.Email, id)
+	// NULL parameters keep the current value; see UpdateRequest.
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE users SET
+			display_name = CASE WHEN $1::text IS NULL THEN display_name ELSE NULLIF($1, '') END,
+			email_verified_at = CASE WHEN $2::text IS NULL OR email = $2 THEN email_verified_at END,
+			email = COALESCE($2, email),
+			avatar_url = CASE WHEN $3::text IS NULL THEN avatar_url ELSE NULLIF($3, '') END,
+			household_size = COALESCE($4, household_size),
+			timezone = COALESCE($5, timezone),
+			locale = COALESCE($6, locale),
+			units = COALESCE($7, units),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8`,
+		data.Name, data.Email, data.AvatarURL, data.HouseholdSize, data.Timezone, data.Locale, data.Units, id)
 	if err != nil {
 		return "", errors.Wrap(err, "ExecContext: failed to update user")
 	}
@@ -125,8 +217,790 @@ func (r Repository) update(ctx context.Context, id string, data UpdateRequest) (
 	if count, err := res.RowsAffected(); err != nil {
 		return "", errors.Wrap(err, "RowsAffected: failed to get rows affected count")
 	} else if count != 1 {
-		return "", errors.New("No rows affected")
+		return "", liberror.New("No user found with the specified ID", http.StatusNotFound)
 	}
 
 	return id, nil
 }
+
+func (r Repository) updateRole(ctx context.Context, id string, role string) (string, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, role, id)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to update user role")
+	}
+
+	if count, err := res.RowsAffected(); err != nil {
+		return "", errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	} else if count != 1 {
+		return "", liberror.New("No user found with the specified ID", http.StatusNotFound)
+	}
+
+	return id, nil
+}
+
+// createSession records a signed-in device together with its first refresh
+// token.
+func (r *Repository) createSession(ctx context.Context, userID string, client Client, tokenHash string, expiresAt time.Time) (string, error) {
+	var sessionID string
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = tx.QueryRowxContext(ctx, `
+		INSERT INTO sessions (user_id, user_agent, ip)
+		VALUES ($1, $2, $3)
+		RETURNING id`, userID, client.UserAgent, client.IP).Scan(&sessionID)
+	if err != nil {
+		return "", errors.Wrap(err, "QueryRowxContext: failed to insert session")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`, userID, sessionID, tokenHash, expiresAt)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to insert refresh token")
+	}
+
+	return sessionID, nil
+}
+
+// rotateRefreshToken swaps the token identified by oldHash for a new one in a
+// single transaction. Presenting a token that was already rotated means it
+// leaked, so every session and refresh token the user holds is revoked.
+func (r *Repository) rotateRefreshToken(ctx context.Context, oldHash, newHash string, expiresAt time.Time) (*RefreshToken, error) {
+	var current RefreshToken
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = tx.GetContext(ctx, &current, `SELECT * FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`, oldHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = liberror.New("Invalid refresh token", http.StatusUnauthorized)
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "GetContext: failed to get refresh token")
+	}
+
+	// Tokens revoked by logout or a remote sign-out were never replaced and
+	// are simply refused.
+	if current.RevokedAt != nil && current.ReplacedBy == nil {
+		err = liberror.New("Refresh token has been revoked", http.StatusUnauthorized)
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		err = revokeSessions(ctx, tx, current.UserID, "")
+		if err != nil {
+			return nil, errors.Wrap(err, "revokeSessions: failed to revoke refresh token family")
+		}
+		// err is nil here, so the deferred commit keeps the family revocation
+		// even though the request itself is rejected.
+		return nil, liberror.New("Refresh token has already been used", http.StatusUnauthorized)
+	}
+
+	if current.ExpiresAt.Before(time.Now()) {
+		err = liberror.New("Refresh token has expired", http.StatusUnauthorized)
+		return nil, err
+	}
+
+	var next RefreshToken
+	err = tx.GetContext(ctx, &next, `
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *`, current.UserID, current.SessionID, newHash, expiresAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetContext: failed to insert refresh token")
+	}
+
+	if current.SessionID != nil {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE sessions SET last_seen_at = CURRENT_TIMESTAMP WHERE id = $1`, *current.SessionID)
+		if err != nil {
+			return nil, errors.Wrap(err, "ExecContext: failed to touch session")
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $1
+		WHERE id = $2`, next.ID, current.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "ExecContext: failed to revoke rotated refresh token")
+	}
+
+	return &next, nil
+}
+
+func (r Repository) revokeRefreshToken(ctx context.Context, userID, tokenHash string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND token_hash = $2 AND revoked_at IS NULL`, userID, tokenHash)
+	return errors.Wrap(err, "ExecContext: failed to revoke refresh token")
+}
+
+func (r *Repository) revokeAllSessions(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = revokeSessions(ctx, tx, userID, "")
+	return err
+}
+
+// revokeSessions signs out every session of the user except keepSessionID
+// (none when empty) and revokes their refresh tokens, including legacy ones
+// that belong to no session.
+func revokeSessions(ctx context.Context, tx *sqlx.Tx, userID, keepSessionID string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL AND id::text <> $2`, userID, keepSessionID)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to revoke sessions")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL AND session_id::text IS DISTINCT FROM $2`, userID, keepSessionID)
+	return errors.Wrap(err, "ExecContext: failed to revoke refresh tokens")
+}
+
+func (r Repository) listSessions(ctx context.Context, userID string, seenSince time.Time) ([]Session, error) {
+	sessions := []Session{}
+	err := r.db.SelectContext(ctx, &sessions, `
+		SELECT * FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at > $2
+		ORDER BY last_seen_at DESC`, userID, seenSince)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to list sessions")
+	}
+	return sessions, nil
+}
+
+// revokeSession signs out one device. Its access tokens are refused by the
+// auth middleware from the next request on.
+func (r *Repository) revokeSession(ctx context.Context, userID, sessionID string) (string, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, sessionID, userID)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to revoke session")
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return "", errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+	if count != 1 {
+		err = liberror.New("No active session found with the specified ID", http.StatusNotFound)
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE session_id = $1 AND revoked_at IS NULL`, sessionID)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to revoke session refresh tokens")
+	}
+
+	return sessionID, nil
+}
+
+// saveUserToken stores a new single-use token and invalidates any earlier
+// unused token with the same purpose, so only the latest email link works.
+func (r *Repository) saveUserToken(ctx context.Context, userID, purpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to invalidate previous user tokens")
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`, userID, purpose, tokenHash, expiresAt)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to insert user token")
+	}
+
+	return err
+}
+
+// consumeUserToken marks the token as used and returns its owner. The
+// UPDATE only matches unused, unexpired tokens so each one works once.
+func consumeUserToken(ctx context.Context, tx *sqlx.Tx, purpose, tokenHash string) (string, error) {
+	var userID string
+	err := tx.GetContext(ctx, &userID, `
+		UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id`, tokenHash, purpose)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", liberror.New("Invalid or expired token", http.StatusBadRequest)
+		}
+		return "", errors.Wrap(err, "GetContext: failed to consume user token")
+	}
+	return userID, nil
+}
+
+func (r *Repository) resetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+	var userID string
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	userID, err = consumeUserToken(ctx, tx, purposePasswordReset, tokenHash)
+	if err != nil {
+		return "", err
+	}
+
+	if err = updatePassword(ctx, tx, userID, passwordHash, ""); err != nil {
+		return "", err
+	}
+
+	return userID, nil
+}
+
+func (r *Repository) changePassword(ctx context.Context, id, passwordHash, keepSessionID string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = updatePassword(ctx, tx, id, passwordHash, keepSessionID)
+	return err
+}
+
+// updatePassword also signs out every other session so other devices have
+// to sign in again with the new password.
+func updatePassword(ctx context.Context, tx *sqlx.Tx, id, passwordHash, keepSessionID string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE users SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`, passwordHash, id)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to update password")
+	}
+
+	return revokeSessions(ctx, tx, id, keepSessionID)
+}
+
+func (r *Repository) verifyEmail(ctx context.Context, tokenHash string) (string, error) {
+	var userID string
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	userID, err = consumeUserToken(ctx, tx, purposeEmailVerification, tokenHash)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND email_verified_at IS NULL`, userID)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to mark email as verified")
+	}
+
+	return userID, nil
+}
+
+// findUserToken returns the owner of an unused, unexpired token without
+// consuming it.
+func (r Repository) findUserToken(ctx context.Context, purpose, tokenHash string) (string, error) {
+	var userID string
+	err := r.db.GetContext(ctx, &userID, `
+		SELECT user_id FROM user_tokens
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP`, tokenHash, purpose)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", liberror.New("Invalid or expired token", http.StatusUnauthorized)
+		}
+		return "", errors.Wrap(err, "GetContext: failed to get user token")
+	}
+	return userID, nil
+}
+
+func (r *Repository) consumeMFAChallenge(ctx context.Context, tokenHash string) (string, error) {
+	var userID string
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	userID, err = consumeUserToken(ctx, tx, purposeMFAChallenge, tokenHash)
+	return userID, err
+}
+
+// setTOTPSecret stores a pending secret. It refuses to overwrite the secret
+// of an account that already has 2FA enabled.
+func (r Repository) setTOTPSecret(ctx context.Context, id, secret string) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE users SET totp_secret = $1, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND totp_enabled_at IS NULL`, secret, id)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to set totp secret")
+	}
+
+	if count, err := res.RowsAffected(); err != nil {
+		return errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	} else if count != 1 {
+		return liberror.New("Two-factor authentication is already enabled", http.StatusConflict)
+	}
+
+	return nil
+}
+
+// useTOTPStep records step as the last accepted code. The conditional
+// UPDATE makes concurrent submissions of the same code fail.
+func (r Repository) useTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`, step, id)
+	if err != nil {
+		return false, errors.Wrap(err, "ExecContext: failed to update totp step")
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+	return count == 1, nil
+}
+
+func (r Repository) useRecoveryCode(ctx context.Context, id, codeHash string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE user_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, id, codeHash)
+	if err != nil {
+		return false, errors.Wrap(err, "ExecContext: failed to use recovery code")
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+	return count == 1, nil
+}
+
+// enableTOTP activates the pending secret and replaces the recovery codes.
+func (r *Repository) enableTOTP(ctx context.Context, id string, step int64, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE users SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`, step, id)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to enable totp")
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	}
+	if count != 1 {
+		err = liberror.New("Two-factor authentication is already enabled", http.StatusConflict)
+		return err
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, id, codeHashes)
+	return err
+}
+
+func (r *Repository) regenerateRecoveryCodes(ctx context.Context, id string, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = replaceRecoveryCodes(ctx, tx, id, codeHashes)
+	return err
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, id string, codeHashes []string) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, id)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to delete recovery codes")
+	}
+
+	for _, hash := range codeHashes {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, id, hash)
+		if err != nil {
+			return errors.Wrap(err, "ExecContext: failed to insert recovery code")
+		}
+	}
+	return nil
+}
+
+func (r *Repository) disableTOTP(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "BeginTxx: failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, id)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to disable totp")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, id)
+	if err != nil {
+		return errors.Wrap(err, "ExecContext: failed to delete recovery codes")
+	}
+
+	return nil
+}
+
+func (r Repository) saveAPIKey(ctx context.Context, key APIKey) (*APIKey, error) {
+	var saved APIKey
+	err := r.db.GetContext(ctx, &saved, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scope, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *`, key.UserID, key.Name, key.Prefix, key.KeyHash, key.Scope, key.ExpiresAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetContext: failed to insert api key")
+	}
+	return &saved, nil
+}
+
+func (r Repository) listAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	keys := []APIKey{}
+	err := r.db.SelectContext(ctx, &keys, `
+		SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to list api keys")
+	}
+	return keys, nil
+}
+
+func (r Repository) revokeAPIKey(ctx context.Context, userID, keyID string) (string, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`, keyID, userID)
+	if err != nil {
+		return "", errors.Wrap(err, "ExecContext: failed to revoke api key")
+	}
+
+	if count, err := res.RowsAffected(); err != nil {
+		return "", errors.Wrap(err, "RowsAffected: failed to get rows affected count")
+	} else if count != 1 {
+		return "", liberror.New("No active API key found with the specified ID", http.StatusNotFound)
+	}
+
+	return keyID, nil
+}
+
+func (r Repository) exportLikes(ctx context.Context, userID string) ([]ExportedRecipe, error) {
+	recipes := []ExportedRecipe{}
+	err := r.db.SelectContext(ctx, &recipes, `
+		SELECT l.recipe_id, r.name
+		FROM likes l
+		JOIN recipes r ON r.id = l.recipe_id
+		WHERE l.user_id = $1
+		ORDER BY r.name`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to export likes")
+	}
+	return recipes, nil
+}
+
+func (r Repository) exportRatings(ctx context.Context, userID string) ([]ExportedRating, error) {
+	ratings := []ExportedRating{}
+	err := r.db.SelectContext(ctx, &ratings, `
+		SELECT rr.recipe_id, r.name AS recipe_name, rr.rating, rr.review, rr.photo_urls,
+			rr.created_at, rr.updated_at
+		FROM recipe_ratings rr
+		JOIN recipes r ON r.id = rr.recipe_id
+		WHERE rr.user_id = $1
+		ORDER BY rr.created_at`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to export ratings")
+	}
+	return ratings, nil
+}
+
+func (r Repository) exportFeedback(ctx context.Context, userID string) ([]ExportedFeedback, error) {
+	feedback := []ExportedFeedback{}
+	err := r.db.SelectContext(ctx, &feedback, `
+		SELECT d.recipe_id, r.name, d.kind AS reaction, d.created_at
+		FROM recipe_dislikes d
+		JOIN recipes r ON r.id = d.recipe_id
+		WHERE d.user_id = $1
+		ORDER BY d.created_at`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to export recipe feedback")
+	}
+	return feedback, nil
+}
+
+func (r Repository) exportCollections(ctx context.Context, userID string) ([]ExportedCollection, error) {
+	collections := []ExportedCollection{}
+	err := r.db.SelectContext(ctx, &collections, `
+		SELECT c.id, c.name, c.description, c.cover_image_url, c.visibility,
+			ARRAY(
+				SELECT cr.recipe_id::text FROM collection_recipes cr
+				WHERE cr.collection_id = c.id ORDER BY cr.position
+			) AS recipe_ids,
+			c.created_at, c.updated_at
+		FROM collections c
+		WHERE c.user_id = $1
+		ORDER BY c.name`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to export collections")
+	}
+	return collections, nil
+}
+
+func (r Repository) exportEvents(ctx context.Context, userID string) ([]ExportedEvent, error) {
+	events := []ExportedEvent{}
+	err := r.db.SelectContext(ctx, &events, `
+		SELECT recipe_id, type, occurred_at
+		FROM recipe_events
+		WHERE user_id = $1
+		ORDER BY occurred_at`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to export recipe events")
+	}
+	return events, nil
+}
+
+func (r Repository) exportOnboarding(ctx context.Context, userID string) ([]ExportedAnswer, error) {
+	answers := []ExportedAnswer{}
+	err := r.db.SelectContext(ctx, &answers, `
+		SELECT recipe_id, rating, answered_at
+		FROM onboarding_answers
+		WHERE user_id = $1
+		ORDER BY answered_at`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to export onboarding answers")
+	}
+	return answers, nil
+}
+
+// exportRevisions lists the recipe changes the user made as an editor.
+// Deleting the account keeps the revisions but forgets who made them.
+func (r Repository) exportRevisions(ctx context.Context, userID string) ([]ExportedRevision, error) {
+	revisions := []ExportedRevision{}
+	err := r.db.SelectContext(ctx, &revisions, `
+		SELECT recipe_id, revision, source, note, created_at
+		FROM recipe_revisions
+		WHERE editor_id = $1
+		ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to export recipe revisions")
+	}
+	return revisions, nil
+}
+
+func (r Repository) exportDiet(ctx context.Context, userID string) (*ExportedDiet, error) {
+	var diet ExportedDiet
+	err := r.db.GetContext(ctx, &diet, `
+		SELECT vegetarian, gluten_free, cuisine_preference, disliked_ingredients,
+			additional_preferences, dietary_goals
+		FROM user_preferences
+		WHERE user_id = $1`, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "GetContext: failed to export dietary profile")
+	}
+	return &diet, nil
+}
+
+func (r Repository) exportAllergens(ctx context.Context, userID string) ([]string, error) {
+	allergens := []string{}
+	err := r.db.SelectContext(ctx, &allergens, `
+		SELECT allergen FROM user_allergens WHERE user_id = $1 ORDER BY allergen`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to export allergens")
+	}
+	return allergens, nil
+}
+
+func (r Repository) exportMealPlans(ctx context.Context, userID string) ([]ExportedMeal, error) {
+	meals := []ExportedMeal{}
+	err := r.db.SelectContext(ctx, &meals, `
+		SELECT mp.week_start_date, mp.day_of_week, mp.meal_type, mp.recipe_id,
+			COALESCE(r.name, '') AS recipe_name, mp.servings, mp.created_at
+		FROM meal_plans mp
+		LEFT JOIN recipes r ON r.id = mp.recipe_id
+		WHERE mp.user_id = $1
+		ORDER BY mp.week_start_date, mp.day_of_week, mp.meal_type`, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "SelectContext: failed to export meal plans")
+	}
+	return meals, nil
+}
+
+func (r Repository) exportHousehold(ctx context.Context, userID string) (*ExportedHousehold, error) {
+	var household ExportedHousehold
+	err := r.db.GetContext(ctx, &household, `
+		SELECT h.id, h.name, hm.role, hm.joined_at
+		FROM household_members hm
+		JOIN households h ON h.id = hm.household_id
+		WHERE hm.user_id = $1`, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "GetContext: failed to export household")
+	}
+	return &household, nil
+}
@@ -1,11 +1,15 @@
 package users
 
 import (
+	"Food/auth"
 	"fmt"
 	"github.com/gobuffalo/validate"
 	"github.com/gobuffalo/validate/validators"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strings"
+	"time"
 )
 
 type AddRequest struct {
@@ -57,11 +61,329 @@ func (v *LoginRequest) Bind(r *http.Request) error {
 	return nil
 }
 
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+
+	maxHouseholdSize = 20
+)
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// UpdateRequest is a partial update: fields left out of the body keep their
+// value. An empty name or avatar_url clears it.
 type UpdateRequest struct {
-	Name  string `json:"name"`
+	// Name is the display name shown to other users.
+	Name          *string `json:"name"`
+	Email         *string `json:"email"`
+	AvatarURL     *string `json:"avatar_url"`
+	HouseholdSize *int    `json:"household_size"`
+	Timezone      *string `json:"timezone"`
+	Locale        *string `json:"locale"`
+	Units         *string `json:"units"`
+}
+
+func (u *UpdateRequest) Bind(r *http.Request) error {
+	trim := func(s *string) {
+		if s != nil {
+			*s = strings.TrimSpace(*s)
+		}
+	}
+	trim(u.Name)
+	trim(u.Email)
+	trim(u.AvatarURL)
+	trim(u.Timezone)
+	trim(u.Locale)
+	if u.Email != nil {
+		*u.Email = strings.ToLower(*u.Email)
+	}
+	if u.Units != nil {
+		*u.Units = strings.TrimSpace(strings.ToLower(*u.Units))
+	}
+
+	var checks []validate.Validator
+	if u.Name != nil {
+		checks = append(checks, &validators.StringLengthInRange{Name: "name", Field: *u.Name, Max: 100, Message: fmt.Sprintf("%v must be at most 100 characters", "name")})
+	}
+	if u.Email != nil {
+		checks = append(checks, &validators.EmailIsPresent{Name: "email", Field: *u.Email, Message: fmt.Sprintf("%v is invalid", "email")})
+	}
+	if u.AvatarURL != nil && *u.AvatarURL != "" {
+		checks = append(checks, &validators.FuncValidator{
+			Name:    "avatar_url",
+			Field:   "avatar_url",
+			Message: "%s must be an http or https URL",
+			Fn: func() bool {
+				parsed, err := url.Parse(*u.AvatarURL)
+				return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+			},
+		})
+	}
+	if u.HouseholdSize != nil {
+		checks = append(checks, &validators.FuncValidator{
+			Name:    "household_size",
+			Field:   "household_size",
+			Message: fmt.Sprintf("%%s must be between 1 and %d", maxHouseholdSize),
+			Fn: func() bool {
+				return *u.HouseholdSize >= 1 && *u.HouseholdSize <= maxHouseholdSize
+			},
+		})
+	}
+	if u.Timezone != nil {
+		checks = append(checks, &validators.FuncValidator{
+			Name:    "timezone",
+			Field:   "timezone",
+			Message: "%s must be an IANA time zone such as Africa/Lagos",
+			Fn: func() bool {
+				_, err := time.LoadLocation(*u.Timezone)
+				return *u.Timezone != "" && *u.Timezone != "Local" && err == nil
+			},
+		})
+	}
+	if u.Locale != nil {
+		checks = append(checks, &validators.FuncValidator{
+			Name:    "locale",
+			Field:   "locale",
+			Message: "%s must be a language tag such as en or en-NG",
+			Fn: func() bool {
+				return len(*u.Locale) <= 35 && localePattern.MatchString(*u.Locale)
+			},
+		})
+	}
+	if u.Units != nil {
+		checks = append(checks, &validators.FuncValidator{
+			Name:    "units",
+			Field:   "units",
+			Message: "%s must be one of metric or imperial",
+			Fn: func() bool {
+				return *u.Units == UnitsMetric || *u.Units == UnitsImperial
+			},
+		})
+	}
+
+	err1 := validate.Validate(checks...)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (v *RoleRequest) Bind(r *http.Request) error {
+	v.Role = strings.TrimSpace(strings.ToLower(v.Role))
+
+	err1 := validate.Validate(
+		&validators.FuncValidator{
+			Name:    "role",
+			Field:   "role",
+			Message: "%s must be one of admin, editor or user",
+			Fn: func() bool {
+				return auth.ValidRole(v.Role)
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (v *RefreshRequest) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "refresh_token", Field: v.RefreshToken, Message: fmt.Sprintf("%s is missing", "refresh_token")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	// AllDevices revokes every refresh token the user holds.
+	AllDevices bool `json:"all_devices"`
+}
+
+func (v *LogoutRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+type ForgotPasswordRequest struct {
 	Email string `json:"email"`
 }
 
-func (u UpdateRequest) Bind(r *http.Request) error {
+func (v *ForgotPasswordRequest) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.EmailIsPresent{Name: "email", Field: v.Email, Message: fmt.Sprintf("%v is invalid", "email")},
+	)
+
+	v.Email = strings.TrimSpace(strings.ToLower(v.Email))
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type ResetPasswordRequest struct {
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+func (v *ResetPasswordRequest) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "token", Field: v.Token, Message: fmt.Sprintf("%v is missing", "token")},
+		&validators.StringIsPresent{Name: "password", Field: v.Password, Message: fmt.Sprintf("%v is missing", "password")},
+		&validators.FuncValidator{
+			Name:    "confirm_password",
+			Field:   "confirm_password",
+			Message: "Password doesn't match",
+			Fn: func() bool {
+				return v.Password == v.ConfirmPassword
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+func (v *ChangePasswordRequest) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "current_password", Field: v.CurrentPassword, Message: fmt.Sprintf("%v is missing", "current_password")},
+		&validators.StringIsPresent{Name: "password", Field: v.Password, Message: fmt.Sprintf("%v is missing", "password")},
+		&validators.FuncValidator{
+			Name:    "confirm_password",
+			Field:   "confirm_password",
+			Message: "Password doesn't match",
+			Fn: func() bool {
+				return v.Password == v.ConfirmPassword
+			},
+		},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (v *VerifyEmailRequest) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "token", Field: v.Token, Message: fmt.Sprintf("%v is missing", "token")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type MFALoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	// Code is either a code from the authenticator app or a recovery code.
+	Code string `json:"code"`
+}
+
+func (v *MFALoginRequest) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "challenge_token", Field: v.ChallengeToken, Message: fmt.Sprintf("%v is missing", "challenge_token")},
+		&validators.StringIsPresent{Name: "code", Field: v.Code, Message: fmt.Sprintf("%v is missing", "code")},
+	)
+
+	v.Code = strings.TrimSpace(v.Code)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (v *TOTPCodeRequest) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "code", Field: v.Code, Message: fmt.Sprintf("%v is missing", "code")},
+	)
+
+	v.Code = strings.TrimSpace(v.Code)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type DisableTOTPRequest struct {
+	Password string `json:"password"`
+}
+
+func (v *DisableTOTPRequest) Bind(r *http.Request) error {
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "password", Field: v.Password, Message: fmt.Sprintf("%v is missing", "password")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
+	return nil
+}
+
+type CreateAPIKeyRequest struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+	// ExpiresInDays is optional; keys without it stay valid until revoked.
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+func (v *CreateAPIKeyRequest) Bind(r *http.Request) error {
+	v.Name = strings.TrimSpace(v.Name)
+	v.Scope = strings.TrimSpace(strings.ToLower(v.Scope))
+	if v.Scope == "" {
+		v.Scope = auth.ScopeRead
+	}
+
+	err1 := validate.Validate(
+		&validators.StringIsPresent{Name: "name", Field: v.Name, Message: fmt.Sprintf("%v is missing", "name")},
+		&validators.StringLengthInRange{Name: "name", Field: v.Name, Max: 100, Message: fmt.Sprintf("%v must be at most 100 characters", "name")},
+		&validators.FuncValidator{
+			Name:    "scope",
+			Field:   "scope",
+			Message: "%s must be one of read or write",
+			Fn: func() bool {
+				return auth.ValidScope(v.Scope)
+			},
+		},
+		&validators.IntIsGreaterThan{Name: "expires_in_days", Field: v.ExpiresInDays, Compared: -1, Message: fmt.Sprintf("%v must not be negative", "expires_in_days")},
+	)
+	if err1.HasAny() {
+		return err1
+	}
+
 	return nil
 }
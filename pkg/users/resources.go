@@ -2,20 +2,31 @@ package users
 
 import (
 	"Food/auth"
+	"Food/config"
+	"Food/pkg/collection"
+	"Food/pkg/event"
+	"Food/pkg/mailer"
 	"Food/pkg/mealplan"
+	"Food/pkg/onboarding"
 	"Food/pkg/user_preference"
 	"github.com/go-chi/chi/v5"
 	"github.com/jmoiron/sqlx"
 )
 
 type Resource struct {
-	db *sqlx.DB
+	db     *sqlx.DB
+	authn  *auth.Authenticator
+	cfg    *config.Config
+	mailer mailer.Mailer
 }
 
 // NewResource creates and returns a resource.
-func NewResource(db *sqlx.DB) *Resource {
+func NewResource(db *sqlx.DB, authn *auth.Authenticator, cfg *config.Config, mailer mailer.Mailer) *Resource {
 	return &Resource{
-		db: db,
+		db:     db,
+		authn:  authn,
+		cfg:    cfg,
+		mailer: mailer,
 	}
 }
 
@@ -23,24 +34,67 @@ func (rs *Resource) Router() *chi.Mux {
 	r := chi.NewRouter()
 
 	repo := NewRepository(rs.db)
-	svc := NewService(repo)
+	throttle := NewLoginThrottle(NewAttemptStore(rs.cfg.Accounts.LoginThrottle, rs.db), rs.cfg.Accounts.LoginThrottle)
+	svc := NewService(repo, rs.authn, rs.cfg, rs.mailer, throttle)
 	hndlr := NewHandler(svc)
 
 	r.Post("/login", hndlr.login)
+	r.Post("/login/mfa", hndlr.loginMFA)
+	r.Post("/token/refresh", hndlr.refresh)
+	r.Post("/password/forgot", hndlr.forgotPassword)
+	r.Post("/password/reset", hndlr.resetPassword)
+	r.Post("/email/verify", hndlr.verifyEmail)
 	r.Post("/", hndlr.save)
 
 	r.Group(func(r chi.Router) {
-		r.Use(auth.MustAuthMiddleware)
+		r.Use(rs.authn.MustAuthMiddleware)
+
+		r.With(auth.DenyAPIKeys).Post("/logout", hndlr.logout)
 
 		r.Route("/{id}", func(r chi.Router) {
-			r.Mount("/preferences", user_preference.NewResource(rs.db).Router())
-			r.Mount("/meal-plans", mealplan.NewResource(rs.db).Router())
+			r.Mount("/preferences", user_preference.NewResource(rs.db, rs.authn).Router())
+			r.Mount("/meal-plans", mealplan.NewResource(rs.db, rs.authn).Router())
+			r.Mount("/collections", collection.NewResource(rs.db, rs.authn).Router())
+			r.Mount("/events", event.NewResource(rs.db, rs.authn).Router())
+			r.Mount("/onboarding", onboarding.NewResource(rs.db, rs.authn).Router())
 			r.Get("/", hndlr.get)
-			r.Delete("/", hndlr.delete)
-			r.Put("/", hndlr.update)
+
+			// Account settings need an interactive sign-in; API keys are
+			// for recipe and meal plan integrations only.
+			r.Group(func(r chi.Router) {
+				r.Use(auth.DenyAPIKeys)
+				r.With(auth.RequireRoleOrOwner("id", auth.RoleAdmin)).Delete("/", hndlr.delete)
+				r.With(auth.RequireRoleOrOwner("id", auth.RoleAdmin)).Put("/", hndlr.update)
+				r.With(auth.RequireRoleOrOwner("id", auth.RoleAdmin)).Get("/export", hndlr.export)
+				r.With(auth.RequireRole(auth.RoleAdmin)).Put("/role", hndlr.updateRole)
+				r.With(auth.RequireRole(auth.RoleAdmin)).Post("/unlock", hndlr.unlock)
+				r.With(auth.RequireRoleOrOwner("id")).Put("/password", hndlr.changePassword)
+				r.With(auth.RequireRoleOrOwner("id")).Post("/email/verification", hndlr.resendVerification)
+
+				r.Route("/mfa/totp", func(r chi.Router) {
+					r.Use(auth.RequireRoleOrOwner("id"))
+					r.Post("/", hndlr.enrollTOTP)
+					r.Post("/confirm", hndlr.confirmTOTP)
+					r.Post("/recovery-codes", hndlr.regenerateRecoveryCodes)
+					r.Delete("/", hndlr.disableTOTP)
+				})
+
+				r.Route("/sessions", func(r chi.Router) {
+					r.Use(auth.RequireRoleOrOwner("id", auth.RoleAdmin))
+					r.Get("/", hndlr.listSessions)
+					r.Delete("/{sid}", hndlr.revokeSession)
+				})
+
+				r.Route("/api-keys", func(r chi.Router) {
+					r.Use(auth.RequireRoleOrOwner("id"))
+					r.Post("/", hndlr.createAPIKey)
+					r.Get("/", hndlr.listAPIKeys)
+					r.Delete("/{keyId}", hndlr.revokeAPIKey)
+				})
+			})
 		})
 
-		r.Get("/", hndlr.list)
+		r.With(auth.RequireRole(auth.RoleAdmin), auth.DenyAPIKeys).Get("/", hndlr.list)
 
 	})
 
@@ -1,9 +1,13 @@
 package users
 
 import (
+	"Food/auth"
+	"Food/config"
 	liberror "Food/internal/errors"
 	"Food/pkg"
+	"Food/pkg/mailer"
 	"context"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
@@ -12,18 +16,105 @@ import (
 )
 
 type Service struct {
-	repo *Repository
+	repo     *Repository
+	authn    *auth.Authenticator
+	cfg      *config.Config
+	mailer   mailer.Mailer
+	throttle *LoginThrottle
 }
 
-func NewService(repo *Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo *Repository, authn *auth.Authenticator, cfg *config.Config, mailer mailer.Mailer, throttle *LoginThrottle) *Service {
+	return &Service{repo: repo, authn: authn, cfg: cfg, mailer: mailer, throttle: throttle}
 }
 
+// delete erases the account and all personal data. The caller, the user
+// themselves or an admin, is recorded in the audit trail.
 func (s Service) delete(ctx context.Context, id string) (string, error) {
-	resp, err := s.repo.delete(ctx, id)
+	erasedBy, _ := ctx.Value("user_id").(string)
+	resp, err := s.repo.erase(ctx, id, erasedBy)
 	return resp, liberror.CoverErr(err,
 		errors.New("service temporarily unavailable. Please try again later"),
-		pkg.Log("users.delete", "users.delete", id).WithError(err))
+		pkg.Log("users.delete", "users.erase", id).WithError(err))
+}
+
+// export gathers every piece of personal data held about the user.
+func (s Service) export(ctx context.Context, id string) (*Export, error) {
+	user, err := s.repo.get(ctx, id)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.get", id).WithError(err))
+	}
+
+	export := &Export{
+		ExportedAt: time.Now().UTC(),
+		Profile:    user.Response(),
+	}
+
+	if export.Likes, err = s.repo.exportLikes(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportLikes", id).WithError(err))
+	}
+	export.Preferences = export.Likes
+	if export.Ratings, err = s.repo.exportRatings(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportRatings", id).WithError(err))
+	}
+	if export.Feedback, err = s.repo.exportFeedback(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportFeedback", id).WithError(err))
+	}
+	if export.Collections, err = s.repo.exportCollections(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportCollections", id).WithError(err))
+	}
+	if export.Events, err = s.repo.exportEvents(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportEvents", id).WithError(err))
+	}
+	if export.Onboarding, err = s.repo.exportOnboarding(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportOnboarding", id).WithError(err))
+	}
+	if export.Revisions, err = s.repo.exportRevisions(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportRevisions", id).WithError(err))
+	}
+	if export.Diet, err = s.repo.exportDiet(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportDiet", id).WithError(err))
+	}
+	if export.Allergens, err = s.repo.exportAllergens(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportAllergens", id).WithError(err))
+	}
+	if export.MealPlans, err = s.repo.exportMealPlans(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportMealPlans", id).WithError(err))
+	}
+	if export.Household, err = s.repo.exportHousehold(ctx, id); err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.export", "users.exportHousehold", id).WithError(err))
+	}
+	if export.Sessions, err = s.listSessions(ctx, id); err != nil {
+		return nil, err
+	}
+	if export.APIKeys, err = s.listAPIKeys(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return export, nil
 }
 
 func (s Service) update(ctx context.Context, id string, request UpdateRequest) (string, error) {
@@ -33,6 +124,13 @@ func (s Service) update(ctx context.Context, id string, request UpdateRequest) (
 		pkg.Log("users.update", "users.update", id).WithError(err))
 }
 
+func (s Service) updateRole(ctx context.Context, id string, request RoleRequest) (string, error) {
+	resp, err := s.repo.updateRole(ctx, id, request.Role)
+	return resp, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.updateRole", "users.updateRole", id).WithError(err))
+}
+
 func (s Service) save(ctx context.Context, request AddRequest) (*User, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -43,9 +141,20 @@ func (s Service) save(ctx context.Context, request AddRequest) (*User, error) {
 	request.PasswordHash = string(hashedPassword)
 
 	save, err := s.repo.save(ctx, request)
-	return save, liberror.CoverErr(err,
-		errors.New("service temporarily unavailable. Please try again later"),
-		pkg.Log("users.save", "users.save", "").WithError(err))
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.save", "users.save", "").WithError(err))
+	}
+
+	// Signup succeeds even if the email cannot be sent; the user can ask
+	// for a new verification link later.
+	save.Email = request.Email
+	if err := s.sendVerificationEmail(ctx, save); err != nil {
+		pkg.Log("users.save", "users.sendVerificationEmail", save.ID).WithError(err).Error("failed to send verification email")
+	}
+
+	return save, nil
 }
 
 func (s Service) get(ctx context.Context, id string) (*User, error) {
@@ -62,35 +171,577 @@ func (s Service) list(ctx context.Context) (Users, error) {
 		pkg.Log("users.list", "users.list", "").WithError(err))
 }
 
-func (s Service) login(ctx context.Context, request LoginRequest) (*User, string, error) {
+// login checks the credentials behind the per-account and per-IP throttle.
+// Unknown emails and wrong passwords produce the same error and take the
+// same bcrypt time so accounts cannot be enumerated. Accounts with 2FA
+// enabled get an MFAChallenge instead of tokens.
+func (s Service) login(ctx context.Context, request LoginRequest, client Client) (*User, *TokenResponse, *MFAChallenge, error) {
+	keys := []string{accountKey(request.Email), ipKey(client.IP)}
+	if err := s.throttle.Attempt(ctx, keys...); err != nil {
+		return nil, nil, nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.login", "users.throttle.Attempt", request.Email).WithError(err))
+	}
+
 	user, err := s.repo.findByEmail(ctx, request.Email)
 	if err != nil {
-		return nil, "", liberror.CoverErr(err,
+		if _, ok := err.(*liberror.ErrResponse); !ok {
+			return nil, nil, nil, liberror.CoverErr(err,
+				errors.New("service temporarily unavailable. Please try again later"),
+				pkg.Log("users.login", "users.findByEmail", request.Email).WithError(err))
+		}
+		user = nil
+	}
+
+	passwordHash := dummyPasswordHash()
+	if user != nil {
+		passwordHash = user.PasswordHash
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(request.Password))
+	if user == nil || err != nil {
+		return nil, nil, nil, liberror.ErrInvalidCredentials
+	}
+
+	// The account counter is only cleared once the second factor has been
+	// checked, otherwise a stolen password would allow unlimited code guesses.
+	// The right password still does not count as a failure.
+	if user.MFAEnabled() {
+		if err := s.throttle.Forgive(ctx, keys...); err != nil {
+			pkg.Log("users.login", "users.throttle.Forgive", request.Email).WithError(err).Error("failed to forgive login attempt")
+		}
+		ttl := s.cfg.Accounts.MFAChallengeExpiry.Duration
+		token, err := s.newUserToken(ctx, user.ID, purposeMFAChallenge, ttl)
+		if err != nil {
+			return nil, nil, nil, liberror.CoverErr(err,
+				errors.New("service temporarily unavailable. Please try again later"),
+				pkg.Log("users.login", "users.newUserToken", user.ID).WithError(err))
+		}
+		return nil, nil, &MFAChallenge{
+			Status:         "mfa_required",
+			ChallengeToken: token,
+			ExpiresIn:      int64(ttl.Seconds()),
+		}, nil
+	}
+
+	if err := s.throttle.Reset(ctx, keys[0]); err != nil {
+		pkg.Log("users.login", "users.throttle.Reset", request.Email).WithError(err).Error("failed to reset login attempts")
+	}
+	if err := s.throttle.Forgive(ctx, keys[1]); err != nil {
+		pkg.Log("users.login", "users.throttle.Forgive", request.Email).WithError(err).Error("failed to forgive login attempt")
+	}
+
+	tokens, err := s.issueTokens(ctx, user, client)
+	if err != nil {
+		return nil, nil, nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.login", "users.issueTokens", request.Email).WithError(err))
+	}
+
+	return user, tokens, nil, nil
+}
+
+// loginMFA exchanges a challenge token and a TOTP or recovery code for the
+// real tokens. Wrong codes count against the same throttle as passwords.
+func (s Service) loginMFA(ctx context.Context, request MFALoginRequest, client Client) (*User, *TokenResponse, error) {
+	challengeHash := hashToken(request.ChallengeToken)
+	userID, err := s.repo.findUserToken(ctx, purposeMFAChallenge, challengeHash)
+	if err != nil {
+		return nil, nil, liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
-			pkg.Log("users.login", "users.findByEmail", request.Email).WithError(err))
+			pkg.Log("users.loginMFA", "users.findUserToken", "").WithError(err))
 	}
 
-	if user == nil {
-		return nil, "", liberror.New("User does not exist, please sign up!", http.StatusBadRequest)
+	user, err := s.repo.get(ctx, userID)
+	if err != nil {
+		return nil, nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.loginMFA", "users.get", userID).WithError(err))
+	}
+
+	keys := []string{accountKey(user.Email), ipKey(client.IP)}
+	if err := s.throttle.Attempt(ctx, keys...); err != nil {
+		return nil, nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.loginMFA", "users.throttle.Attempt", userID).WithError(err))
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, request.Code, true)
+	if err != nil {
+		return nil, nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.loginMFA", "users.checkSecondFactor", userID).WithError(err))
+	}
+	if !ok {
+		return nil, nil, liberror.New("Invalid authentication code", http.StatusUnauthorized)
+	}
+
+	if _, err := s.repo.consumeMFAChallenge(ctx, challengeHash); err != nil {
+		return nil, nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.loginMFA", "users.consumeMFAChallenge", userID).WithError(err))
+	}
+
+	if err := s.throttle.Reset(ctx, keys[0]); err != nil {
+		pkg.Log("users.loginMFA", "users.throttle.Reset", userID).WithError(err).Error("failed to reset login attempts")
+	}
+	if err := s.throttle.Forgive(ctx, keys[1]); err != nil {
+		pkg.Log("users.loginMFA", "users.throttle.Forgive", userID).WithError(err).Error("failed to forgive login attempt")
+	}
+
+	tokens, err := s.issueTokens(ctx, user, client)
+	if err != nil {
+		return nil, nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.loginMFA", "users.issueTokens", userID).WithError(err))
+	}
+
+	return user, tokens, nil
+}
+
+// checkSecondFactor accepts a code from the authenticator app and, when
+// allowRecovery is set, an unused recovery code. Accepted codes are burnt.
+func (s Service) checkSecondFactor(ctx context.Context, user *User, code string, allowRecovery bool) (bool, error) {
+	if !user.MFAEnabled() {
+		return false, nil
+	}
+
+	if step, ok := verifyTOTP(*user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		return s.repo.useTOTPStep(ctx, user.ID, step)
+	}
+
+	if !allowRecovery {
+		return false, nil
+	}
+	return s.repo.useRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+}
+
+// enrollTOTP generates a new secret. It only takes effect once confirmTOTP
+// has seen a valid code, so an abandoned enrollment cannot lock anyone out.
+func (s Service) enrollTOTP(ctx context.Context, id string) (*TOTPEnrollment, error) {
+	user, err := s.repo.get(ctx, id)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.enrollTOTP", "users.get", id).WithError(err))
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.enrollTOTP", "users.newTOTPSecret", id).WithError(err))
+	}
+
+	err = s.repo.setTOTPSecret(ctx, id, secret)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.enrollTOTP", "users.setTOTPSecret", id).WithError(err))
+	}
+
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    totpURI(s.cfg.Accounts.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// confirmTOTP enables 2FA and returns the recovery codes. This is the only
+// time they are shown.
+func (s Service) confirmTOTP(ctx context.Context, id string, request TOTPCodeRequest) (*RecoveryCodes, error) {
+	user, err := s.repo.get(ctx, id)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.confirmTOTP", "users.get", id).WithError(err))
+	}
+
+	if user.MFAEnabled() {
+		return nil, liberror.New("Two-factor authentication is already enabled", http.StatusConflict)
+	}
+	if user.TOTPSecret == nil {
+		return nil, liberror.New("Start two-factor enrollment first", http.StatusBadRequest)
+	}
+
+	step, ok := verifyTOTP(*user.TOTPSecret, request.Code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return nil, liberror.New("Invalid authentication code", http.StatusBadRequest)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.confirmTOTP", "users.newRecoveryCodes", id).WithError(err))
+	}
+
+	err = s.repo.enableTOTP(ctx, id, step, hashes)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.confirmTOTP", "users.enableTOTP", id).WithError(err))
+	}
+
+	return &RecoveryCodes{Codes: codes}, nil
+}
+
+// regenerateRecoveryCodes replaces every recovery code. It needs a code
+// from the authenticator app so a hijacked session cannot mint new ones.
+func (s Service) regenerateRecoveryCodes(ctx context.Context, id string, request TOTPCodeRequest) (*RecoveryCodes, error) {
+	user, err := s.repo.get(ctx, id)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.regenerateRecoveryCodes", "users.get", id).WithError(err))
+	}
+
+	if !user.MFAEnabled() {
+		return nil, liberror.New("Two-factor authentication is not enabled", http.StatusBadRequest)
+	}
+
+	ok, err := s.checkSecondFactor(ctx, user, request.Code, false)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.regenerateRecoveryCodes", "users.checkSecondFactor", id).WithError(err))
+	}
+	if !ok {
+		return nil, liberror.New("Invalid authentication code", http.StatusBadRequest)
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.regenerateRecoveryCodes", "users.newRecoveryCodes", id).WithError(err))
+	}
+
+	err = s.repo.regenerateRecoveryCodes(ctx, id, hashes)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.regenerateRecoveryCodes", "users.regenerateRecoveryCodes", id).WithError(err))
+	}
+
+	return &RecoveryCodes{Codes: codes}, nil
+}
+
+func (s Service) disableTOTP(ctx context.Context, id string, request DisableTOTPRequest) error {
+	user, err := s.repo.get(ctx, id)
+	if err != nil {
+		return liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.disableTOTP", "users.get", id).WithError(err))
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.Password))
 	if err != nil {
-		return nil, "", liberror.New("Invalid password", http.StatusBadRequest)
+		return liberror.New("Current password is incorrect", http.StatusBadRequest)
+	}
+
+	err = s.repo.disableTOTP(ctx, id)
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.disableTOTP", "users.disableTOTP", id).WithError(err))
+}
+
+func (s Service) unlock(ctx context.Context, id string) (string, error) {
+	user, err := s.repo.get(ctx, id)
+	if err != nil {
+		return "", liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.unlock", "users.get", id).WithError(err))
+	}
+
+	err = s.throttle.Reset(ctx, accountKey(user.Email))
+	return id, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.unlock", "users.throttle.Reset", id).WithError(err))
+}
+
+func (s Service) createAPIKey(ctx context.Context, userID string, request CreateAPIKeyRequest) (*CreatedAPIKey, error) {
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.createAPIKey", "users.newAPIKey", userID).WithError(err))
+	}
+
+	apiKey := APIKey{
+		UserID:  userID,
+		Name:    request.Name,
+		Prefix:  prefix,
+		KeyHash: hash,
+		Scope:   request.Scope,
+	}
+	if request.ExpiresInDays > 0 {
+		expiresAt := time.Now().UTC().AddDate(0, 0, request.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	saved, err := s.repo.saveAPIKey(ctx, apiKey)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.createAPIKey", "users.saveAPIKey", userID).WithError(err))
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	return &CreatedAPIKey{APIKey: *saved, Key: key}, nil
+}
+
+func (s Service) listAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	resp, err := s.repo.listAPIKeys(ctx, userID)
+	return resp, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.listAPIKeys", "users.listAPIKeys", userID).WithError(err))
+}
+
+func (s Service) revokeAPIKey(ctx context.Context, userID, keyID string) (string, error) {
+	resp, err := s.repo.revokeAPIKey(ctx, userID, keyID)
+	return resp, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.revokeAPIKey", "users.revokeAPIKey", userID).WithError(err))
+}
+
+// issueTokens starts a session for the client and mints a fresh access
+// token and refresh token for it.
+func (s Service) issueTokens(ctx context.Context, user *User, client Client) (*TokenResponse, error) {
+	refreshToken, refreshHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, errors.Wrap(err, "newOpaqueToken: failed to generate refresh token")
+	}
+
+	sessionID, err := s.repo.createSession(ctx, user.ID, client, refreshHash, time.Now().UTC().Add(s.cfg.JWT.RefreshExpiry.Duration))
+	if err != nil {
+		return nil, err
+	}
+
+	return s.accessToken(user, sessionID, refreshToken)
+}
+
+func (s Service) accessToken(user *User, sessionID, refreshToken string) (*TokenResponse, error) {
+	claims := jwt.MapClaims{
 		"user_id": user.ID,
 		"email":   user.Email,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
+		"role":    user.Role,
+	}
+	if sessionID != "" {
+		claims["sid"] = sessionID
+	}
+
+	tokenString, err := s.authn.Sign(claims)
+	if err != nil {
+		return nil, errors.Wrap(err, "jwt.SignedString: failed to sign access token")
+	}
+
+	return &TokenResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.authn.Expiry().Seconds()),
+	}, nil
+}
+
+func (s Service) refresh(ctx context.Context, request RefreshRequest) (*TokenResponse, error) {
+	refreshToken, refreshHash, err := newOpaqueToken()
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.refresh", "users.newOpaqueToken", "").WithError(err))
+	}
+
+	next, err := s.repo.rotateRefreshToken(ctx, hashToken(request.RefreshToken), refreshHash,
+		time.Now().UTC().Add(s.cfg.JWT.RefreshExpiry.Duration))
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.refresh", "users.rotateRefreshToken", "").WithError(err))
+	}
+
+	user, err := s.repo.get(ctx, next.UserID)
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.refresh", "users.get", next.UserID).WithError(err))
+	}
+
+	var sessionID string
+	if next.SessionID != nil {
+		sessionID = *next.SessionID
+	}
+
+	tokens, err := s.accessToken(user, sessionID, refreshToken)
+	return tokens, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.refresh", "users.accessToken", next.UserID).WithError(err))
+}
+
+// logout revokes the access token used for the request and ends the
+// current session, or every session with AllDevices.
+func (s Service) logout(ctx context.Context, userID string, request LogoutRequest) error {
+	err := s.authn.Revoke(ctx, auth.ClaimsFromContext(ctx))
+	if err != nil {
+		return liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.logout", "auth.Revoke", userID).WithError(err))
+	}
+
+	sessionID := auth.SessionIDFromContext(ctx)
+	switch {
+	case request.AllDevices:
+		err = s.repo.revokeAllSessions(ctx, userID)
+	case sessionID != "":
+		_, err = s.repo.revokeSession(ctx, userID, sessionID)
+		if _, ok := err.(*liberror.ErrResponse); ok {
+			err = nil
+		}
+	case request.RefreshToken != "":
+		err = s.repo.revokeRefreshToken(ctx, userID, hashToken(request.RefreshToken))
+	}
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.logout", "users.revokeRefreshToken", userID).WithError(err))
+}
+
+// listSessions returns the devices that are signed in. Sessions idle for
+// longer than a refresh token lives can no longer be resumed and are left out.
+func (s Service) listSessions(ctx context.Context, userID string) ([]SessionResponse, error) {
+	sessions, err := s.repo.listSessions(ctx, userID, time.Now().UTC().Add(-s.cfg.JWT.RefreshExpiry.Duration))
+	if err != nil {
+		return nil, liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.listSessions", "users.listSessions", userID).WithError(err))
+	}
+
+	currentID := auth.SessionIDFromContext(ctx)
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, session.Response(currentID))
+	}
+	return response, nil
+}
+
+func (s Service) revokeSession(ctx context.Context, userID, sessionID string) (string, error) {
+	resp, err := s.repo.revokeSession(ctx, userID, sessionID)
+	return resp, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.revokeSession", "users.revokeSession", userID).WithError(err))
+}
+
+// requestPasswordReset emails a reset link. Unknown addresses are not
+// reported so the endpoint cannot be used to discover accounts.
+func (s Service) requestPasswordReset(ctx context.Context, request ForgotPasswordRequest) error {
+	user, err := s.repo.findByEmail(ctx, request.Email)
+	if err != nil {
+		if _, ok := err.(*liberror.ErrResponse); ok {
+			return nil
+		}
+		return liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.requestPasswordReset", "users.findByEmail", request.Email).WithError(err))
+	}
+
+	token, err := s.newUserToken(ctx, user.ID, purposePasswordReset, s.cfg.Accounts.PasswordResetExpiry.Duration)
+	if err != nil {
+		return liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.requestPasswordReset", "users.newUserToken", user.ID).WithError(err))
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s/reset-password?token=%s\n\nIf you did not ask for a password reset you can ignore this email.\n",
+			user.Username, s.cfg.Accounts.PasswordResetExpiry.Duration, s.cfg.PublicURL, token),
 	})
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.requestPasswordReset", "mailer.Send", user.ID).WithError(err))
+}
 
-	tokenString, err := token.SignedString([]byte("your_secret_key"))
+func (s Service) resetPassword(ctx context.Context, request ResetPasswordRequest) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, "", liberror.CoverErr(err,
+		return liberror.CoverErr(err, errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.resetPassword", "bcrypt.GenerateFromPassword", "").WithError(err))
+	}
+
+	_, err = s.repo.resetPassword(ctx, hashToken(request.Token), string(hashedPassword))
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.resetPassword", "users.resetPassword", "").WithError(err))
+}
+
+func (s Service) changePassword(ctx context.Context, id string, request ChangePasswordRequest) error {
+	user, err := s.repo.get(ctx, id)
+	if err != nil {
+		return liberror.CoverErr(err,
+			errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.changePassword", "users.get", id).WithError(err))
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(request.CurrentPassword))
+	if err != nil {
+		return liberror.New("Current password is incorrect", http.StatusBadRequest)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return liberror.CoverErr(err, errors.New("service temporarily unavailable. Please try again later"),
+			pkg.Log("users.changePassword", "bcrypt.GenerateFromPassword", id).WithError(err))
+	}
+
+	err = s.repo.changePassword(ctx, id, string(hashedPassword), auth.SessionIDFromContext(ctx))
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.changePassword", "users.changePassword", id).WithError(err))
+}
+
+func (s Service) resendVerification(ctx context.Context, id string) error {
+	user, err := s.repo.get(ctx, id)
+	if err != nil {
+		return liberror.CoverErr(err,
 			errors.New("service temporarily unavailable. Please try again later"),
-			pkg.Log("users.login", "jwt.SignedString", request.Email).WithError(err))
+			pkg.Log("users.resendVerification", "users.get", id).WithError(err))
 	}
 
-	return user, tokenString, nil
+	if user.EmailVerifiedAt != nil {
+		return liberror.New("Email address is already verified", http.StatusConflict)
+	}
+
+	err = s.sendVerificationEmail(ctx, user)
+	return liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.resendVerification", "users.sendVerificationEmail", id).WithError(err))
+}
+
+func (s Service) verifyEmail(ctx context.Context, request VerifyEmailRequest) (string, error) {
+	userID, err := s.repo.verifyEmail(ctx, hashToken(request.Token))
+	return userID, liberror.CoverErr(err,
+		errors.New("service temporarily unavailable. Please try again later"),
+		pkg.Log("users.verifyEmail", "users.verifyEmail", "").WithError(err))
+}
+
+func (s Service) sendVerificationEmail(ctx context.Context, user *User) error {
+	token, err := s.newUserToken(ctx, user.ID, purposeEmailVerification, s.cfg.Accounts.EmailVerificationExpiry.Duration)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Welcome!\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s/verify-email?token=%s\n",
+			s.cfg.Accounts.EmailVerificationExpiry.Duration, s.cfg.PublicURL, token),
+	})
+}
+
+func (s Service) newUserToken(ctx context.Context, userID, purpose string, ttl time.Duration) (string, error) {
+	token, tokenHash, err := newOpaqueToken()
+	if err != nil {
+		return "", errors.Wrap(err, "newOpaqueToken: failed to generate user token")
+	}
+
+	if err := s.repo.saveUserToken(ctx, userID, purpose, tokenHash, time.Now().UTC().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
 }
@@ -0,0 +1,241 @@
+package users
+
+import (
+	"Food/config"
+	liberror "Food/internal/errors"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttemptStore keeps login attempt counters. Keys are "account:<email>" or
+// "ip:<address>". Every attempt is counted before the credentials are
+// checked, and checking the block and counting happen in one step, so
+// concurrent attempts cannot all get in under the limit.
+type AttemptStore interface {
+	// Attempt counts an attempt against key unless the key is blocked. The
+	// count starts again from one when the previous attempt is older than
+	// window. After the nth attempt the key is blocked for delays[n-1], or
+	// for lockout once n is past the end of delays. It returns whether the
+	// attempt was allowed and, if not, when the block ends.
+	Attempt(ctx context.Context, key string, window time.Duration, delays []time.Duration, lockout time.Duration) (bool, time.Time, error)
+	// Forgive takes back one attempt that turned out to be legitimate.
+	Forgive(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+func NewAttemptStore(cfg config.LoginThrottle, db *sqlx.DB) AttemptStore {
+	if cfg.Store == "memory" {
+		return NewMemoryAttemptStore()
+	}
+	return NewPostgresAttemptStore(db)
+}
+
+type LoginThrottle struct {
+	store  AttemptStore
+	policy config.LoginThrottle
+}
+
+func NewLoginThrottle(store AttemptStore, policy config.LoginThrottle) *LoginThrottle {
+	return &LoginThrottle{store: store, policy: policy}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Attempt counts a login attempt against every key and rejects it while
+// any of the keys is delayed or locked. The attempt counts as a failure
+// until Forgive or Reset says otherwise.
+func (t *LoginThrottle) Attempt(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		maxFailures := t.policy.AccountMaxFailures
+		if strings.HasPrefix(key, "ip:") {
+			maxFailures = t.policy.IPMaxFailures
+		}
+
+		allowed, until, err := t.store.Attempt(ctx, key, t.policy.Window.Duration, t.delays(maxFailures), t.policy.LockoutDuration.Duration)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			wait := time.Until(until).Round(time.Second)
+			if wait < time.Second {
+				wait = time.Second
+			}
+			return liberror.New(fmt.Sprintf("Too many failed login attempts. Try again in %s", wait), http.StatusTooManyRequests)
+		}
+	}
+	return nil
+}
+
+// delays is the wait after each attempt short of maxFailures: nothing for
+// the free attempts, then BaseDelay doubling up to MaxDelay.
+func (t *LoginThrottle) delays(maxFailures int) []time.Duration {
+	delays := make([]time.Duration, 0, maxFailures-1)
+	for failures := 1; failures < maxFailures; failures++ {
+		var delay time.Duration
+		if failures > t.policy.FreeAttempts {
+			exp := float64(failures - t.policy.FreeAttempts - 1)
+			delay = time.Duration(float64(t.policy.BaseDelay.Duration) * math.Pow(2, exp))
+			if delay > t.policy.MaxDelay.Duration || delay <= 0 {
+				delay = t.policy.MaxDelay.Duration
+			}
+		}
+		delays = append(delays, delay)
+	}
+	return delays
+}
+
+// Forgive takes back the attempt counted against every key, for example
+// from the client IP once the login has succeeded.
+func (t *LoginThrottle) Forgive(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := t.store.Forgive(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *LoginThrottle) Reset(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := t.store.Reset(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryAttempt struct {
+	failures      int
+	lastFailureAt time.Time
+	blockedUntil  time.Time
+}
+
+// MemoryAttemptStore keeps counters in process. It is only suitable for a
+// single instance; counters are lost on restart.
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*memoryAttempt
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]*memoryAttempt)}
+}
+
+func (s *MemoryAttemptStore) Attempt(ctx context.Context, key string, window time.Duration, delays []time.Duration, lockout time.Duration) (bool, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	a, ok := s.attempts[key]
+	if ok && a.blockedUntil.After(now) {
+		return false, a.blockedUntil, nil
+	}
+	if !ok || now.Sub(a.lastFailureAt) > window {
+		a = &memoryAttempt{}
+		s.attempts[key] = a
+	}
+	a.failures++
+	a.lastFailureAt = now
+	block := lockout
+	if a.failures <= len(delays) {
+		block = delays[a.failures-1]
+	}
+	a.blockedUntil = now.Add(block)
+	return true, time.Time{}, nil
+}
+
+func (s *MemoryAttemptStore) Forgive(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.attempts[key]; ok && a.failures > 0 {
+		a.failures--
+	}
+	return nil
+}
+
+func (s *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// PostgresAttemptStore shares counters between instances through the
+// login_attempts table.
+type PostgresAttemptStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresAttemptStore(db *sqlx.DB) *PostgresAttemptStore {
+	return &PostgresAttemptStore{db: db}
+}
+
+// Attempt relies on the row lock taken by INSERT ... ON CONFLICT DO UPDATE:
+// concurrent attempts on a key run one after another, and a blocked key
+// matches the WHERE clause of no update, so no row is returned.
+func (s *PostgresAttemptStore) Attempt(ctx context.Context, key string, window time.Duration, delays []time.Duration, lockout time.Duration) (bool, time.Time, error) {
+	seconds := make([]float64, len(delays))
+	for i, delay := range delays {
+		seconds[i] = delay.Seconds()
+	}
+
+	// Times are written in UTC, like the rest of the schema's TIMESTAMP
+	// columns, so blocked_until reads back correctly in Go.
+	var counted int
+	err := s.db.GetContext(ctx, &counted, `
+		INSERT INTO login_attempts AS a (key, failures, last_failure_at, blocked_until)
+		VALUES ($1, 1, $5::timestamp,
+			$5::timestamp + make_interval(secs => COALESCE(($3::float8[])[1], $4)))
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN a.last_failure_at < $5::timestamp - make_interval(secs => $2) THEN 1
+				ELSE a.failures + 1
+			END,
+			last_failure_at = $5::timestamp,
+			blocked_until = $5::timestamp + make_interval(secs => COALESCE(($3::float8[])[CASE
+				WHEN a.last_failure_at < $5::timestamp - make_interval(secs => $2) THEN 1
+				ELSE a.failures + 1
+			END], $4))
+		WHERE a.blocked_until IS NULL OR a.blocked_until <= $5::timestamp
+		RETURNING failures`, key, window.Seconds(), pq.Array(seconds), lockout.Seconds(), time.Now().UTC())
+	if err == nil {
+		return true, time.Time{}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, time.Time{}, errors.Wrap(err, "GetContext: failed to record login attempt")
+	}
+
+	var until sql.NullTime
+	err = s.db.GetContext(ctx, &until, `SELECT blocked_until FROM login_attempts WHERE key = $1`, key)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, time.Time{}, errors.Wrap(err, "GetContext: failed to get login block")
+	}
+	return false, until.Time, nil
+}
+
+func (s *PostgresAttemptStore) Forgive(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE login_attempts SET failures = GREATEST(failures - 1, 0) WHERE key = $1`, key)
+	return errors.Wrap(err, "ExecContext: failed to forgive login attempt")
+}
+
+func (s *PostgresAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	return errors.Wrap(err, "ExecContext: failed to reset login attempts")
+}